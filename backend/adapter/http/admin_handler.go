@@ -0,0 +1,96 @@
+package http
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"quickshare/core/service"
+	web "quickshare/pkg"
+	"strconv"
+	"strings"
+)
+
+// maxStorageEventSize bounds the body of a notification, S3 sends one record per message
+const maxStorageEventSize = 1 << 20
+
+type AdminHandler struct {
+	reconcileService    *service.ReconcileService
+	storageEventService *service.StorageEventService
+}
+
+func NewAdminHandler(reconcileService *service.ReconcileService, storageEventService *service.StorageEventService) *AdminHandler {
+	return &AdminHandler{
+		reconcileService:    reconcileService,
+		storageEventService: storageEventService,
+	}
+}
+
+// Reconcile runs a storage/database reconciliation, ?fix=true also repairs what it finds
+func (h *AdminHandler) Reconcile(w http.ResponseWriter, r *http.Request) {
+	fix := false
+	if value := r.URL.Query().Get("fix"); value != "" {
+		var err error
+		fix, err = strconv.ParseBool(value)
+		if err != nil {
+			web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: "fix must be a boolean"})
+			return
+		}
+	}
+
+	log.Println("starting reconcile, fix =", fix)
+
+	report, err := h.reconcileService.Reconcile(fix)
+	if err != nil {
+		log.Println("error reconciling storage", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to reconcile storage"})
+		return
+	}
+
+	web.WriteJSON(w, http.StatusOK, report)
+}
+
+// StorageEvents receives bucket notifications pushed over HTTP (MinIO webhook
+// target, relays of the SQS messages...) and confirms the matching uploads
+func (h *AdminHandler) StorageEvents(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxStorageEventSize))
+	if err != nil {
+		web.WriteJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: "notification is too large"})
+		return
+	}
+
+	result, err := h.storageEventService.HandleNotification(body)
+	if errors.Is(err, service.ErrInvalidStorageEvent) {
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		log.Println("error handling storage event", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to handle storage event"})
+		return
+	}
+
+	web.WriteJSON(w, http.StatusOK, result)
+}
+
+// requireAdminToken only lets requests with "Authorization: Bearer <token>" through,
+// with no token configured the admin API is disabled
+func requireAdminToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				web.WriteJSON(w, http.StatusNotFound, errorResponse{Error: "admin API is disabled"})
+				return
+			}
+
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				web.WriteJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid admin token"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
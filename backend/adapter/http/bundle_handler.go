@@ -0,0 +1,104 @@
+package http
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"quickshare/core/service"
+	web "quickshare/pkg"
+
+	"github.com/gorilla/mux"
+)
+
+// maxBundleRequestSize leaves room for MaxBundleMembers files with long paths
+const maxBundleRequestSize = 1 << 20
+
+type BundleHandler struct {
+	bundleService *service.BundleService
+}
+
+func NewBundleHandler(bundleService *service.BundleService) *BundleHandler {
+	return &BundleHandler{bundleService: bundleService}
+}
+
+// CreateBundle records the bundle and returns the upload URL of each member
+func (h *BundleHandler) CreateBundle(w http.ResponseWriter, r *http.Request) {
+	var request service.BundleRequest
+
+	if !readStrictJSON(w, r, maxBundleRequestSize, &request) {
+		return
+	}
+
+	bundle, err := h.bundleService.CreateBundle(&request)
+	switch {
+	case errors.Is(err, service.ErrInvalidBundle), errors.Is(err, service.ErrFileTooLarge), errors.Is(err, service.ErrInvalidEncryption):
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+	case err != nil:
+		log.Println("error creating bundle", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to create bundle"})
+	default:
+		web.WriteJSON(w, http.StatusCreated, bundle)
+	}
+}
+
+// ConfirmBundle confirms the members still pending and completes the bundle
+func (h *BundleHandler) ConfirmBundle(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	bundle, err := h.bundleService.ConfirmBundle(id)
+	if err != nil {
+		h.writeError(w, "confirming", err)
+		return
+	}
+
+	web.WriteJSON(w, http.StatusOK, bundle)
+}
+
+// ListMembers returns the members of a bundle, each one can be downloaded on its own through /download/{id}
+func (h *BundleHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	members, err := h.bundleService.Members(id)
+	if err != nil {
+		h.writeError(w, "listing", err)
+		return
+	}
+
+	web.WriteJSON(w, http.StatusOK, bundleMembersResponse{Items: members})
+}
+
+// Download streams the zip of the bundle, an error past the first byte can only cut the response short
+func (h *BundleHandler) Download(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	archive, err := h.bundleService.OpenArchive(id)
+	if err != nil {
+		h.writeError(w, "downloading", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", web.ContentDisposition("attachment", archive.Name))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := archive.WriteTo(w); err != nil {
+		log.Printf("error streaming bundle %s: %v", id, err)
+	}
+}
+
+func (h *BundleHandler) writeError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		web.WriteJSON(w, http.StatusNotFound, errorResponse{Error: "bundle not found"})
+	case errors.Is(err, service.ErrNotABundle):
+		web.WriteJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+	case errors.Is(err, service.ErrUploadDeleted), errors.Is(err, service.ErrUploadExpired), errors.Is(err, service.ErrBundleConfirmed), errors.Is(err, service.ErrBundleNotReady):
+		web.WriteJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+	case errors.Is(err, service.ErrMimeTypeNotAllowed):
+		web.WriteJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: err.Error()})
+	default:
+		log.Println("error "+action+" bundle", err)
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+	}
+}
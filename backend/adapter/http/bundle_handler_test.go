@@ -0,0 +1,67 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"quickshare/core/service"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBundleHandler_CreateBundleRejectsInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantFields []service.FieldError
+	}{
+		{
+			name:       "unknown field",
+			body:       `{"name":"photos","status":"completed","files":[{"file_name":"a.jpg","file_size":10}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantFields: []service.FieldError{{Field: "status", Message: "is not a known field"}},
+		},
+		{
+			name:       "unknown member field",
+			body:       `{"name":"photos","files":[{"file_name":"a.jpg","file_size":10,"mime":"image/jpeg"}]}`,
+			wantStatus: http.StatusBadRequest,
+			wantFields: []service.FieldError{{Field: "mime", Message: "is not a known field"}},
+		},
+		{
+			name:       "trailing data",
+			body:       `{"name":"photos","files":[{"file_name":"a.jpg","file_size":10}]} {}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "too large",
+			body:       `{"name":"` + strings.Repeat("x", maxBundleRequestSize) + `","files":[]}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "control character in a member path",
+			body:       `{"name":"photos","files":[{"file_name":"a/b\r\n.jpg","file_size":10}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/bundles", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			newContractRouter().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			var body errorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error == "" || !reflect.DeepEqual(body.Fields, tt.wantFields) {
+				t.Errorf("expected fields %v, got %+v", tt.wantFields, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"quickshare/core/model"
+	"quickshare/core/service"
+	"quickshare/pkg/qrcode"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gorilla/mux"
+)
+
+const testAdminToken = "admin-secret"
+
+// pageRoutes are served by the router but aren't API operations
+var pageRoutes = map[string]bool{"/ui/": true}
+
+func init() {
+	// the bodies that aren't JSON are checked against their content type only
+	openapi3filter.RegisterBodyDecoder("text/html", rawBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("image/svg+xml", rawBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("image/png", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("image/jpeg", openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("application/zip", openapi3filter.FileBodyDecoder)
+}
+
+func rawBodyDecoder(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encodingFn openapi3filter.EncodingFn) (interface{}, error) {
+	content, err := io.ReadAll(body)
+	return string(content), err
+}
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		t.Fatalf("openapi.json doesn't load: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("openapi.json is not a valid OpenAPI 3 document: %v", err)
+	}
+	return doc
+}
+
+// newContractRouter wires the real handlers and services over in-memory repositories
+func newContractRouter() *mux.Router {
+	now := time.Now().UTC()
+	hourAgo, inAnHour := now.Add(-time.Hour), now.Add(time.Hour)
+	upload := func(id string, status string) *model.UploadObject {
+		return &model.UploadObject{
+			ID: id, Kind: model.UploadKindFile, FileName: id + ".pdf", FileSize: 9, MimeType: "application/pdf",
+			ObjectKey: "uploads/" + id + "/" + id + ".pdf", Status: status, ExpiresAt: inAnHour, CreatedAt: hourAgo, UpdatedAt: hourAgo,
+		}
+	}
+
+	store := &fakeStore{
+		uploadObjects: map[string]*model.UploadObject{},
+		shortLinks:    map[string]*model.ShortLink{},
+		previews:      map[string]*model.Preview{},
+		webhooks: map[string]*model.Webhook{
+			"wh_1": {ID: "wh_1", URL: "https://hooks.example.com", Events: []string{model.EventUploadCompleted}, Active: true, CreatedAt: hourAgo},
+		},
+		deliveries: map[int64]*model.WebhookDelivery{
+			1: {ID: 1, WebhookID: "wh_1", EventID: "ev_1", EventType: model.EventUploadCompleted, Status: model.DeliveryStatusDead, Attempts: 10, LastStatusCode: 500, NextAttemptAt: hourAgo, CreatedAt: hourAgo},
+		},
+	}
+	for _, uploadObject := range []*model.UploadObject{
+		upload("up_done", model.UploadStatusCompleted),
+		upload("up_pending", model.UploadStatusPending),
+		upload("up_quarantined", model.UploadStatusQuarantined),
+		upload("up_member", model.UploadStatusCompleted),
+		upload("up_member_pending", model.UploadStatusPending),
+		upload("up_image", model.UploadStatusCompleted),
+	} {
+		store.uploadObjects[uploadObject.ID] = uploadObject
+	}
+	store.uploadObjects["up_done"].ConfirmedAt = &hourAgo
+	store.uploadObjects["up_quarantined"].QuarantineReason = "Eicar-Signature"
+	store.uploadObjects["up_expired"] = upload("up_expired", model.UploadStatusCompleted)
+	store.uploadObjects["up_expired"].ExpiresAt = hourAgo
+	store.uploadObjects["up_deleted"] = upload("up_deleted", model.UploadStatusCompleted)
+	store.uploadObjects["up_deleted"].DeletedAt = &hourAgo
+	store.uploadObjects["up_sse_c"] = upload("up_sse_c", model.UploadStatusCompleted)
+	store.uploadObjects["up_sse_c"].StorageEncryption = &model.StorageEncryption{Mode: model.StorageEncryptionSSEC, KeyID: "sha256:0011"}
+	store.uploadObjects["up_image"].MimeType = "image/png"
+	store.uploadObjects["up_image"].PreviewStatus = model.PreviewStatusReady
+	store.previews["up_image/medium"] = &model.Preview{UploadID: "up_image", Size: "medium", ObjectKey: "previews/up_image/medium.jpg", MimeType: "image/jpeg", Width: 4, Height: 3, FileSize: 4}
+
+	for id, members := range map[string][]string{"bn_done": {"up_member"}, "bn_pending": {"up_member_pending"}, "bn_empty": nil} {
+		bundle := upload(id, model.UploadStatusCompleted)
+		bundle.Kind, bundle.FileName, bundle.MimeType, bundle.ObjectKey = model.UploadKindBundle, id, "application/zip", ""
+		if id == "bn_pending" {
+			bundle.Status = model.UploadStatusPending
+		}
+		store.uploadObjects[id] = bundle
+		for _, member := range members {
+			store.uploadObjects[member].BundleID = id
+		}
+	}
+
+	store.shortLinks["k3Xb9qRt"] = &model.ShortLink{ID: "sl_1", Slug: "k3Xb9qRt", OriginalLink: "/download/up_done", UploadID: "up_done", CreatedAt: hourAgo, ExpiresAt: inAnHour}
+	store.shortLinks["expired1"] = &model.ShortLink{ID: "sl_2", Slug: "expired1", OriginalLink: "/download/up_expired", UploadID: "up_expired", CreatedAt: hourAgo, ExpiresAt: hourAgo}
+
+	blobStorage := &fakeBlobStorage{contents: map[string][]byte{"previews/up_image/medium.jpg": {0xff, 0xd8, 0xff, 0xd9}}}
+	uploadObjectService := service.NewUploadObjectService(store, blobStorage, store, service.UploadObjectServiceConfig{
+		PresignExpiry:     15 * time.Minute,
+		DefaultTTL:        24 * time.Hour,
+		MaxFileSize:       1 << 30,
+		DeleteGracePeriod: 7 * 24 * time.Hour,
+	})
+	shortLinkService := service.NewShortLinkService(store, store)
+	bundleHandler := NewBundleHandler(service.NewBundleService(store, blobStorage, uploadObjectService))
+
+	handler := NewHandler(
+		NewUploadObjectHandler(uploadObjectService, bundleHandler),
+		NewHealthHandler(service.NewHealthService()),
+		NewAdminHandler(service.NewReconcileService(store, blobStorage, uploadObjectService), service.NewStorageEventService(store, uploadObjectService, "quickshare-assets")),
+		NewWebhookHandler(service.NewWebhookService(store)),
+		NewShortLinkHandler(shortLinkService),
+		bundleHandler,
+		NewPreviewHandler(service.NewPreviewService(store, store, blobStorage)),
+		NewQRCodeHandler(uploadObjectService, shortLinkService, QRCodeOptions{Size: 128, Level: qrcode.Medium}),
+		NewUIHandler(),
+		testAdminToken,
+	)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	return router
+}
+
+func TestOpenAPISpec_CoversEveryRoute(t *testing.T) {
+	doc := loadSpec(t)
+	documented := map[string]bool{}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	routed := map[string]bool{}
+	err := newContractRouter().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || pageRoutes[path] {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// subrouter prefixes have no methods of their own
+			return nil
+		}
+		for _, method := range methods {
+			routed[method+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for operation := range routed {
+		if !documented[operation] {
+			t.Errorf("%s is routed but missing from openapi.json", operation)
+		}
+	}
+	for operation := range documented {
+		if !routed[operation] {
+			t.Errorf("%s is in openapi.json but not routed", operation)
+		}
+	}
+}
+
+func TestOpenAPISpec_Contract(t *testing.T) {
+	doc := loadSpec(t)
+	specRouter, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notification := `{"Records":[{"eventName":"ObjectCreated:Put","s3":{"bucket":{"name":"quickshare-assets"},"object":{"key":"uploads/up_pending/up_pending.pdf","size":9}}}]}`
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		header http.Header
+		// invalid requests break the spec on purpose, only their response is checked
+		invalid    bool
+		wantStatus int
+	}{
+		{method: "GET", path: "/openapi.json", wantStatus: 200},
+		{method: "GET", path: "/", wantStatus: 200},
+		{method: "GET", path: "/health", wantStatus: 200},
+		{method: "GET", path: "/livez", wantStatus: 200},
+		{method: "GET", path: "/readyz", wantStatus: 200},
+
+		{method: "GET", path: "/uploads?status=completed&limit=10", header: adminHeader(), wantStatus: 200},
+		{method: "GET", path: "/uploads?limit=0", header: adminHeader(), invalid: true, wantStatus: 400},
+		{method: "GET", path: "/uploads?cursor=bogus", header: adminHeader(), wantStatus: 400},
+		{method: "GET", path: "/uploads", wantStatus: 401},
+		{method: "GET", path: "/uploads/trash", header: adminHeader(), wantStatus: 200},
+		{method: "GET", path: "/uploads/trash", header: http.Header{"Authorization": {"Bearer wrong"}}, wantStatus: 401},
+		{method: "POST", path: "/upload", body: `{"file_name":"report.pdf","file_size":1024,"mime_type":"application/pdf"}`, wantStatus: 200},
+		{method: "POST", path: "/upload", body: `{"file_name":"huge.iso","file_size":2147483648}`, wantStatus: 400},
+		{method: "POST", path: "/upload", body: `{"file_name":"../../etc/passwd","file_size":1,"mime_type":"pdf","expires_at":"2001-01-01T00:00:00Z"}`, wantStatus: 400},
+		{method: "POST", path: "/upload", body: `{"id":"mine","file_name":"report.pdf","file_size":1}`, invalid: true, wantStatus: 400},
+		{method: "POST", path: "/upload", body: `{"file_name":"report.pdf","file_size":"1"}`, invalid: true, wantStatus: 400},
+		{method: "POST", path: "/upload", body: `{"file_name":"` + strings.Repeat("a", 70<<10) + `","file_size":1}`, invalid: true, wantStatus: 413},
+		{method: "GET", path: "/upload/up_done", wantStatus: 200},
+		{method: "GET", path: "/upload/up_missing", wantStatus: 404},
+		{method: "DELETE", path: "/upload/up_done", wantStatus: 200},
+		{method: "DELETE", path: "/upload/up_deleted", wantStatus: 409},
+		{method: "POST", path: "/upload/up_deleted/restore", wantStatus: 200},
+		{method: "POST", path: "/upload/up_done/restore", wantStatus: 409},
+		{method: "POST", path: "/upload/up_pending/confirm", wantStatus: 200},
+		{method: "POST", path: "/upload/bn_done/confirm", wantStatus: 409},
+		{method: "POST", path: "/upload/up_quarantined/confirm", wantStatus: 409},
+		{method: "GET", path: "/upload/up_image/preview", wantStatus: 200},
+		{method: "GET", path: "/upload/up_image/preview?size=huge", invalid: true, wantStatus: 400},
+		{method: "GET", path: "/upload/up_done/preview", wantStatus: 404},
+		{method: "GET", path: "/upload/up_done/qr.png", wantStatus: 200},
+		{method: "GET", path: "/upload/up_pending/qr.png", wantStatus: 409},
+		{method: "GET", path: "/upload/up_expired/qr.png", wantStatus: 410},
+		{method: "GET", path: "/upload/up_quarantined/qr.png", wantStatus: 403},
+		{method: "POST", path: "/upload/up_done/links", wantStatus: 201},
+		{method: "POST", path: "/upload/up_missing/links", wantStatus: 404},
+
+		{method: "POST", path: "/bundles", body: `{"name":"photos","files":[{"file_name":"a/1.jpg","file_size":10,"mime_type":"image/jpeg"}]}`, wantStatus: 201},
+		{method: "POST", path: "/bundles", body: `{"name":"photos","files":[]}`, wantStatus: 400},
+		{method: "POST", path: "/bundles", body: `{"name":"photos","files":[{"file_name":"a\\1.jpg","file_size":10}]}`, wantStatus: 400},
+		{method: "POST", path: "/bundles/bn_pending/confirm", wantStatus: 200},
+		{method: "POST", path: "/bundles/bn_done/confirm", wantStatus: 409},
+		{method: "GET", path: "/bundles/bn_done/members", wantStatus: 200},
+		{method: "GET", path: "/bundles/bn_empty/members", wantStatus: 200},
+		{method: "GET", path: "/bundles/up_done/members", wantStatus: 404},
+
+		{method: "GET", path: "/download/up_done", wantStatus: 200},
+		{method: "GET", path: "/download/up_done", header: http.Header{"Accept": {"text/html"}}, wantStatus: 200},
+		{method: "GET", path: "/download/up_done?download=1", wantStatus: 302},
+		{method: "GET", path: "/download/bn_done?download=1", wantStatus: 200},
+		{method: "GET", path: "/download/up_quarantined", wantStatus: 403},
+		{method: "GET", path: "/download/up_missing", header: http.Header{"Accept": {"text/html"}}, wantStatus: 404},
+		{method: "GET", path: "/s/k3Xb9qRt", wantStatus: 302},
+		{method: "GET", path: "/s/expired1", wantStatus: 410},
+		{method: "GET", path: "/s/missing1", wantStatus: 404},
+		{method: "GET", path: "/s/k3Xb9qRt/qr.svg", wantStatus: 200},
+		{method: "GET", path: "/s/expired1/qr.svg", wantStatus: 410},
+
+		{method: "POST", path: "/admin/reconcile", wantStatus: 401},
+		{method: "POST", path: "/admin/reconcile?fix=false", header: adminHeader(), wantStatus: 200},
+		{method: "POST", path: "/admin/storage-events", body: notification, header: adminHeader(), wantStatus: 200},
+		{method: "POST", path: "/admin/storage-events", body: `{"Records":"nope"}`, header: adminHeader(), wantStatus: 400},
+		{method: "POST", path: "/webhooks", body: `{"url":"https://hooks.example.com/quickshare","events":["upload.completed"]}`, header: adminHeader(), wantStatus: 201},
+		{method: "POST", path: "/webhooks", body: `{"url":"ftp://hooks.example.com"}`, header: adminHeader(), wantStatus: 400},
+		{method: "GET", path: "/webhooks", header: adminHeader(), wantStatus: 200},
+		{method: "DELETE", path: "/webhooks/wh_1", header: adminHeader(), wantStatus: 204},
+		{method: "DELETE", path: "/webhooks/wh_missing", header: adminHeader(), wantStatus: 404},
+		{method: "GET", path: "/webhooks/wh_1/deliveries?status=dead", header: adminHeader(), wantStatus: 200},
+		{method: "GET", path: "/webhooks/wh_1/deliveries?limit=0", header: adminHeader(), invalid: true, wantStatus: 400},
+		{method: "POST", path: "/webhooks/deliveries/1/redeliver", header: adminHeader(), wantStatus: 202},
+		{method: "POST", path: "/webhooks/deliveries/9/redeliver", header: adminHeader(), wantStatus: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+
+			route, pathParams, err := specRouter.FindRoute(req)
+			if err != nil {
+				t.Fatalf("no operation in openapi.json: %v", err)
+			}
+			input := &openapi3filter.RequestValidationInput{
+				Request:    req,
+				PathParams: pathParams,
+				Route:      route,
+				Options: &openapi3filter.Options{
+					AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+					IncludeResponseStatus: true,
+				},
+			}
+			if err := openapi3filter.ValidateRequest(context.Background(), input); err != nil && !tt.invalid {
+				t.Fatalf("the test request doesn't match openapi.json: %v", err)
+			}
+
+			// the validation consumed the body
+			req.Body = io.NopCloser(strings.NewReader(tt.body))
+			recorder := httptest.NewRecorder()
+			newContractRouter().ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, recorder.Code, recorder.Body)
+			}
+			assertResponseMatches(t, input, route, recorder)
+		})
+	}
+}
+
+func assertResponseMatches(t *testing.T, input *openapi3filter.RequestValidationInput, route *routers.Route, recorder *httptest.ResponseRecorder) {
+	t.Helper()
+
+	err := openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 recorder.Code,
+		Header:                 recorder.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(recorder.Body.Bytes())),
+		Options:                input.Options,
+	})
+	if err != nil {
+		t.Errorf("%s %s answered %d with a body that doesn't match openapi.json: %v\n%.300s", route.Method, route.Path, recorder.Code, err, recorder.Body)
+	}
+}
+
+func adminHeader() http.Header {
+	return http.Header{"Authorization": {"Bearer " + testAdminToken}}
+}
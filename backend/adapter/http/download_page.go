@@ -0,0 +1,206 @@
+package http
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"quickshare/core/model"
+	"quickshare/core/service"
+	web "quickshare/pkg"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var pages = template.Must(template.New("pages").Funcs(template.FuncMap{"humanSize": humanSize}).ParseFS(templateFS, "templates/*.html"))
+
+type downloadPage struct {
+	Upload      *model.UploadObject
+	MimeType    string
+	Bundle      bool
+	Encrypted   bool
+	ExpiresAt   string
+	ExpiresIn   string
+	DownloadURL string
+	PreviewURL  string
+	Nonce       string
+}
+
+type errorPage struct {
+	Title   string
+	Message string
+}
+
+// acceptsHTML tells whether the client prefers HTML to JSON, a tie (*/*, no Accept) goes to JSON
+func acceptsHTML(r *http.Request) bool {
+	htmlQuality, jsonQuality := 0.0, 0.0
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+		switch mediaType {
+		case "text/html":
+			htmlQuality = max(htmlQuality, quality)
+		case "application/json", "*/*":
+			jsonQuality = max(jsonQuality, quality)
+		}
+	}
+	return htmlQuality > jsonQuality
+}
+
+// downloadPage renders the landing page of a share link. Viewing it records no download,
+// the button goes through downloadFile.
+func (h *UploadObjectHandler) downloadPage(w http.ResponseWriter, r *http.Request, id string) {
+	uploadObject, err := h.uploadObjectService.GetSharedUpload(id)
+	if err != nil {
+		writeErrorPage(w, err)
+		return
+	}
+
+	page := downloadPage{
+		Upload:      uploadObject,
+		MimeType:    uploadObject.MimeType,
+		Bundle:      uploadObject.Kind == model.UploadKindBundle,
+		Encrypted:   uploadObject.Encryption != nil,
+		ExpiresAt:   uploadObject.ExpiresAt.UTC().Format(time.RFC3339),
+		ExpiresIn:   expiresIn(time.Until(uploadObject.ExpiresAt)),
+		DownloadURL: "/download/" + url.PathEscape(id) + "?download=1",
+	}
+	if uploadObject.DetectedMimeType != "" {
+		page.MimeType = uploadObject.DetectedMimeType
+	}
+	if uploadObject.PreviewStatus == model.PreviewStatusReady {
+		page.PreviewURL = "/upload/" + url.PathEscape(id) + "/preview?size=large"
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	page.Nonce = base64.StdEncoding.EncodeToString(nonce)
+	renderPage(w, http.StatusOK, "download.html", &page, page.Nonce)
+}
+
+// downloadFile sends the browser to the object itself, through a redirect when the
+// presigned URL works on its own and through the server when it needs signed headers
+func (h *UploadObjectHandler) downloadFile(w http.ResponseWriter, r *http.Request, id string) {
+	download, err := h.uploadObjectService.GetDownloadURL(id)
+	if errors.Is(err, service.ErrUploadIsBundle) {
+		h.bundleHandler.Download(w, r)
+		return
+	}
+	if err != nil {
+		writeErrorPage(w, err)
+		return
+	}
+	if len(download.Headers) == 0 {
+		http.Redirect(w, r, download.URL, http.StatusFound)
+		return
+	}
+
+	uploadObject, content, err := h.uploadObjectService.OpenObject(id)
+	if err != nil {
+		writeErrorPage(w, err)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", uploadObject.MimeType)
+	w.Header().Set("Content-Length", strconv.FormatInt(uploadObject.FileSize, 10))
+	w.Header().Set("Content-Disposition", web.ContentDisposition("attachment", uploadObject.FileName))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("error streaming upload %s: %v", id, err)
+	}
+}
+
+func writeErrorPage(w http.ResponseWriter, err error) {
+	status, page := http.StatusBadRequest, errorPage{Title: "File unavailable", Message: err.Error()}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		status, page = http.StatusNotFound, errorPage{Title: "File not found", Message: "This link doesn't point to any file."}
+	case errors.Is(err, service.ErrUploadDeleted):
+		status, page = http.StatusGone, errorPage{Title: "File deleted", Message: "This file has been deleted by its owner."}
+	case errors.Is(err, service.ErrUploadExpired):
+		status, page = http.StatusGone, errorPage{Title: "Link expired", Message: "This file is no longer shared."}
+	case errors.Is(err, service.ErrUploadQuarantined):
+		status, page = http.StatusForbidden, errorPage{Title: "File unavailable", Message: "This file is held for review and can't be downloaded."}
+	case errors.Is(err, service.ErrUploadNotCompleted):
+		status, page = http.StatusConflict, errorPage{Title: "Upload in progress", Message: "This file isn't fully uploaded yet, try again in a moment."}
+	default:
+		log.Println("error rendering download page", err)
+	}
+	renderPage(w, status, "error.html", &page, "")
+}
+
+// renderPage writes a page of templates/, the scripts of the page run only with its nonce
+func renderPage(w http.ResponseWriter, status int, name string, data interface{}, nonce string) {
+	scripts := "'none'"
+	if nonce != "" {
+		scripts = "'nonce-" + nonce + "'"
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; img-src 'self'; style-src 'unsafe-inline'; script-src "+scripts+"; frame-ancestors 'none'")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	if err := pages.ExecuteTemplate(w, name, data); err != nil {
+		log.Printf("error rendering %s: %v", name, err)
+	}
+}
+
+// expiresIn is the server side version of the countdown of download.html, e.g. "in 2d 3h"
+func expiresIn(remaining time.Duration) string {
+	seconds := int64(remaining.Seconds())
+	if seconds <= 0 {
+		return "now"
+	}
+
+	var parts []string
+	for _, unit := range []struct {
+		suffix  string
+		seconds int64
+	}{{"d", 86400}, {"h", 3600}, {"m", 60}, {"s", 1}} {
+		if len(parts) == 2 {
+			break
+		}
+		n := seconds / unit.seconds
+		if n > 0 || len(parts) > 0 {
+			parts = append(parts, fmt.Sprintf("%d%s", n, unit.suffix))
+		}
+		seconds -= n * unit.seconds
+	}
+	return "in " + strings.Join(parts, " ")
+}
+
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
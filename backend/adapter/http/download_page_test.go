@@ -0,0 +1,175 @@
+package http
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"quickshare/core/service"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptsHTML(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{accept: "", want: false},
+		{accept: "*/*", want: false},
+		{accept: "application/json", want: false},
+		{accept: "text/html", want: true},
+		// what browsers send for a navigation
+		{accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: true},
+		// ties go to JSON
+		{accept: "text/html, application/json", want: false},
+		{accept: "text/html;q=0.5, */*;q=0.5", want: false},
+		{accept: "text/html;q=0.9, application/json", want: false},
+		{accept: "application/json;q=0.1, text/html;q=0.2", want: true},
+		{accept: "text/html;q=0", want: false},
+		{accept: "text/html;;, application/json", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/download/up_done", nil)
+			req.Header.Set("Accept", tt.accept)
+			if got := acceptsHTML(req); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExpiresIn(t *testing.T) {
+	tests := []struct {
+		remaining time.Duration
+		want      string
+	}{
+		{remaining: -time.Minute, want: "now"},
+		{remaining: 500 * time.Millisecond, want: "now"},
+		{remaining: 45 * time.Second, want: "in 45s"},
+		{remaining: 90 * time.Second, want: "in 1m 30s"},
+		{remaining: time.Hour + 5*time.Second, want: "in 1h 0m"},
+		{remaining: 51*time.Hour + 4*time.Minute, want: "in 2d 3h"},
+		{remaining: 30 * 24 * time.Hour, want: "in 30d 0h"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remaining.String(), func(t *testing.T) {
+			if got := expiresIn(tt.remaining); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUploadObjectHandler_DownloadFile(t *testing.T) {
+	tests := []struct {
+		name         string
+		id           string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{name: "public object is a redirect", id: "up_done", wantStatus: http.StatusFound, wantLocation: "https://storage.test/uploads/up_done/up_done.pdf"},
+		{name: "object needing signed headers is streamed", id: "up_sse_c", wantStatus: http.StatusOK, wantBody: "%PDF-1.7\n"},
+		{name: "quarantined upload", id: "up_quarantined", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/download/"+tt.id+"?download=1", nil)
+			rec := httptest.NewRecorder()
+			newContractRouter().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			if location := rec.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("expected Location %q, got %q", tt.wantLocation, location)
+			}
+			if tt.wantBody == "" {
+				return
+			}
+			if rec.Body.String() != tt.wantBody {
+				t.Errorf("expected the object content, got %q", rec.Body)
+			}
+			wantHeaders := map[string]string{
+				"Content-Type":           "application/pdf",
+				"Content-Length":         "9",
+				"Content-Disposition":    `attachment; filename="up_sse_c.pdf"`,
+				"X-Content-Type-Options": "nosniff",
+			}
+			for name, want := range wantHeaders {
+				if got := rec.Header().Get(name); got != want {
+					t.Errorf("expected %s %q, got %q", name, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadObjectHandler_DownloadPage(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/download/up_done", nil)
+	req.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+	newContractRouter().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"up_done.pdf", "/download/up_done?download=1", "in 59m"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected the page to contain %q", want)
+		}
+	}
+	// the inline script runs with the nonce of the policy only
+	policy := rec.Header().Get("Content-Security-Policy")
+	start := strings.Index(policy, "'nonce-")
+	if start < 0 {
+		t.Fatalf("expected a script nonce in the policy, got %q", policy)
+	}
+	nonce := policy[start+len("'nonce-") : start+strings.Index(policy[start+1:], "'")+1]
+	// html/template writes the + of the base64 nonce as &#43;
+	if !strings.Contains(html.UnescapeString(body), `nonce="`+nonce+`"`) {
+		t.Errorf("expected the script to carry the nonce %s of the policy", nonce)
+	}
+}
+
+func TestWriteErrorPage(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantTitle  string
+	}{
+		{err: sql.ErrNoRows, wantStatus: http.StatusNotFound, wantTitle: "File not found"},
+		{err: service.ErrUploadDeleted, wantStatus: http.StatusGone, wantTitle: "File deleted"},
+		{err: service.ErrUploadExpired, wantStatus: http.StatusGone, wantTitle: "Link expired"},
+		{err: service.ErrUploadQuarantined, wantStatus: http.StatusForbidden, wantTitle: "File unavailable"},
+		{err: service.ErrUploadNotCompleted, wantStatus: http.StatusConflict, wantTitle: "Upload in progress"},
+		{err: fmt.Errorf("failed to open: %w", service.ErrUploadExpired), wantStatus: http.StatusGone, wantTitle: "Link expired"},
+		{err: errors.New("storage unreachable"), wantStatus: http.StatusBadRequest, wantTitle: "File unavailable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeErrorPage(rec, tt.err)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantTitle) {
+				t.Errorf("expected the %q page, got %s", tt.wantTitle, rec.Body)
+			}
+			if policy := rec.Header().Get("Content-Security-Policy"); !strings.Contains(policy, "script-src 'none'") {
+				t.Errorf("expected no script to run on error pages, got %q", policy)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package http
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fakeStore keeps every table the handlers reach in memory, the methods the
+// tests don't need are left to the embedded interfaces and panic when called
+type fakeStore struct {
+	repository.UploadObjectRepository
+	repository.WebhookRepository
+
+	uploadObjects map[string]*model.UploadObject
+	shortLinks    map[string]*model.ShortLink
+	previews      map[string]*model.Preview
+	webhooks      map[string]*model.Webhook
+	deliveries    map[int64]*model.WebhookDelivery
+}
+
+func (f *fakeStore) CreateUploadObject(uploadObject *model.UploadObject) (*model.UploadObject, error) {
+	now := time.Now().UTC()
+	uploadObject.CreatedAt, uploadObject.UpdatedAt = now, now
+	created := *uploadObject
+	f.uploadObjects[uploadObject.ID] = &created
+	return uploadObject, nil
+}
+
+func (f *fakeStore) GetUploadObject(id string) (*model.UploadObject, error) {
+	uploadObject, ok := f.uploadObjects[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *uploadObject
+	return &copied, nil
+}
+
+func (f *fakeStore) UpdateUploadObject(id string, uploadObject *model.UploadObject) (*model.UploadObject, error) {
+	updated := *uploadObject
+	f.uploadObjects[id] = &updated
+	return uploadObject, nil
+}
+
+func (f *fakeStore) CreateUploadObjectAndPublish(uploadObject *model.UploadObject, event *model.WebhookEvent) (*model.UploadObject, error) {
+	return f.CreateUploadObject(uploadObject)
+}
+
+func (f *fakeStore) CreateUploadObjectsAndPublish(uploadObjects []*model.UploadObject, events []*model.WebhookEvent) error {
+	for _, uploadObject := range uploadObjects {
+		if _, err := f.CreateUploadObject(uploadObject); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) UpdateUploadObjectAndPublish(id string, uploadObject *model.UploadObject, event *model.WebhookEvent) (*model.UploadObject, error) {
+	return f.UpdateUploadObject(id, uploadObject)
+}
+
+func (f *fakeStore) TransitionUploadObject(id string, from string, uploadObject *model.UploadObject, event *model.WebhookEvent) (*model.UploadObject, error) {
+	stored, ok := f.uploadObjects[id]
+	if !ok || stored.Status != from || stored.DeletedAt != nil {
+		return nil, sql.ErrNoRows
+	}
+	return f.UpdateUploadObject(id, uploadObject)
+}
+
+func (f *fakeStore) ListUploadObjects(filter repository.UploadObjectFilter, cursor string, limit int) ([]*model.UploadObject, string, error) {
+	if cursor != "" {
+		return nil, "", repository.ErrInvalidCursor
+	}
+	var found []*model.UploadObject
+	for _, uploadObject := range f.uploadObjects {
+		trashed := uploadObject.DeletedAt != nil
+		if (filter.Trashed == trashed || filter.IncludeTrashed) && (filter.Status == "" || uploadObject.Status == filter.Status) {
+			copied := *uploadObject
+			found = append(found, &copied)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ID < found[j].ID })
+	return found, "", nil
+}
+
+func (f *fakeStore) FindUploadObjectsByObjectKeys(objectKeys []string) ([]*model.UploadObject, error) {
+	var found []*model.UploadObject
+	for _, uploadObject := range f.uploadObjects {
+		for _, key := range objectKeys {
+			if uploadObject.ObjectKey == key {
+				copied := *uploadObject
+				found = append(found, &copied)
+			}
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeStore) ListBundleMembers(bundleID string) ([]*model.UploadObject, error) {
+	var members []*model.UploadObject
+	for _, uploadObject := range f.uploadObjects {
+		if uploadObject.BundleID == bundleID {
+			copied := *uploadObject
+			members = append(members, &copied)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].FileName < members[j].FileName })
+	return members, nil
+}
+
+func (f *fakeStore) CreateShortLink(shortLink *model.ShortLink) (*model.ShortLink, error) {
+	shortLink.CreatedAt = time.Now().UTC()
+	created := *shortLink
+	f.shortLinks[shortLink.Slug] = &created
+	return shortLink, nil
+}
+
+func (f *fakeStore) GetShortLinkBySlug(slug string) (*model.ShortLink, error) {
+	shortLink, ok := f.shortLinks[slug]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *shortLink
+	return &copied, nil
+}
+
+func (f *fakeStore) SavePreview(preview *model.Preview) (*model.Preview, error) {
+	saved := *preview
+	f.previews[preview.UploadID+"/"+preview.Size] = &saved
+	return preview, nil
+}
+
+func (f *fakeStore) GetPreview(uploadID string, size string) (*model.Preview, error) {
+	preview, ok := f.previews[uploadID+"/"+size]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *preview
+	return &copied, nil
+}
+
+func (f *fakeStore) PublishEvent(event *model.WebhookEvent) error {
+	return nil
+}
+
+func (f *fakeStore) CreateWebhook(webhook *model.Webhook) (*model.Webhook, error) {
+	webhook.CreatedAt = time.Now().UTC()
+	created := *webhook
+	f.webhooks[webhook.ID] = &created
+	return webhook, nil
+}
+
+func (f *fakeStore) GetWebhook(id string) (*model.Webhook, error) {
+	webhook, ok := f.webhooks[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *webhook
+	return &copied, nil
+}
+
+func (f *fakeStore) ListWebhooks() ([]*model.Webhook, error) {
+	webhooks := []*model.Webhook{}
+	for _, webhook := range f.webhooks {
+		copied := *webhook
+		copied.Secret = ""
+		webhooks = append(webhooks, &copied)
+	}
+	return webhooks, nil
+}
+
+func (f *fakeStore) DeleteWebhook(id string) error {
+	if _, ok := f.webhooks[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(f.webhooks, id)
+	return nil
+}
+
+func (f *fakeStore) ListWebhookDeliveries(webhookID string, status string, limit int) ([]*model.WebhookDelivery, error) {
+	deliveries := []*model.WebhookDelivery{}
+	for _, delivery := range f.deliveries {
+		if delivery.WebhookID == webhookID && (status == "" || delivery.Status == status) {
+			copied := *delivery
+			deliveries = append(deliveries, &copied)
+		}
+	}
+	return deliveries, nil
+}
+
+func (f *fakeStore) RedeliverWebhookDelivery(id int64) (*model.WebhookDelivery, error) {
+	delivery, ok := f.deliveries[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	delivery.Status = model.DeliveryStatusPending
+	delivery.NextAttemptAt = time.Now().UTC()
+	copied := *delivery
+	return &copied, nil
+}
+
+type fakeBlobStorage struct {
+	repository.BlobStorageRepository
+
+	// contents of the objects, a missing key reads as a small PDF
+	contents map[string][]byte
+}
+
+func (f *fakeBlobStorage) GeneratePresignedUploadURL(objectKey string, expiresIn time.Duration, fileName string) (*repository.PresignedRequest, error) {
+	return &repository.PresignedRequest{URL: "https://storage.test/" + objectKey + "?X-Amz-Signature=test"}, nil
+}
+
+func (f *fakeBlobStorage) GeneratePresignedDownloadURL(objectKey string, encryption *model.StorageEncryption, expiresIn time.Duration, fileName string) (*repository.PresignedRequest, error) {
+	presigned := &repository.PresignedRequest{URL: "https://storage.test/" + objectKey + "?X-Amz-Signature=test"}
+	// like S3, customer keys must be sent along, the URL doesn't work on its own
+	if encryption != nil && encryption.Mode == model.StorageEncryptionSSEC {
+		presigned.Headers = map[string]string{"X-Amz-Server-Side-Encryption-Customer-Key": "test"}
+	}
+	return presigned, nil
+}
+
+func (f *fakeBlobStorage) GetPublicURL(objectKey string) string {
+	return "https://storage.test/" + objectKey
+}
+
+func (f *fakeBlobStorage) StorageEncryption() *model.StorageEncryption {
+	return nil
+}
+
+func (f *fakeBlobStorage) ObjectExists(objectKey string, encryption *model.StorageEncryption) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeBlobStorage) GetObjectMetadata(objectKey string, encryption *model.StorageEncryption) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func (f *fakeBlobStorage) ReadRange(objectKey string, encryption *model.StorageEncryption, offset int64, length int64) ([]byte, error) {
+	content, ok := f.contents[objectKey]
+	if !ok {
+		content = []byte("%PDF-1.7\n")
+	}
+	return content[offset:min(offset+length, int64(len(content)))], nil
+}
+
+func (f *fakeBlobStorage) Open(objectKey string, encryption *model.StorageEncryption) (io.ReadCloser, error) {
+	content, _ := f.ReadRange(objectKey, encryption, 0, 1<<20)
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (f *fakeBlobStorage) List(prefix string, continuationToken string) ([]repository.BlobObject, string, error) {
+	var objects []repository.BlobObject
+	for key, content := range f.contents {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, repository.BlobObject{Key: key, Size: int64(len(content)), LastModified: time.Now()})
+		}
+	}
+	return objects, "", nil
+}
+
+func (f *fakeBlobStorage) Delete(objectKey string) error {
+	delete(f.contents, objectKey)
+	return nil
+}
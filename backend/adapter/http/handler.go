@@ -8,22 +8,67 @@ import (
 
 type handler struct {
 	uploadObjectHandler *UploadObjectHandler
+	healthHandler       *HealthHandler
+	adminHandler        *AdminHandler
+	webhookHandler      *WebhookHandler
+	shortLinkHandler    *ShortLinkHandler
+	bundleHandler       *BundleHandler
+	previewHandler      *PreviewHandler
+	qrCodeHandler       *QRCodeHandler
+	uiHandler           *UIHandler
+	adminToken          string
 }
 
-func NewHandler(uploadObjectHandler *UploadObjectHandler) *handler {
+func NewHandler(uploadObjectHandler *UploadObjectHandler, healthHandler *HealthHandler, adminHandler *AdminHandler, webhookHandler *WebhookHandler, shortLinkHandler *ShortLinkHandler, bundleHandler *BundleHandler, previewHandler *PreviewHandler, qrCodeHandler *QRCodeHandler, uiHandler *UIHandler, adminToken string) *handler {
 	return &handler{
 		uploadObjectHandler: uploadObjectHandler,
+		healthHandler:       healthHandler,
+		adminHandler:        adminHandler,
+		webhookHandler:      webhookHandler,
+		shortLinkHandler:    shortLinkHandler,
+		bundleHandler:       bundleHandler,
+		previewHandler:      previewHandler,
+		qrCodeHandler:       qrCodeHandler,
+		uiHandler:           uiHandler,
+		adminToken:          adminToken,
 	}
 }
 
-func (h *handler) Hello(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Hello, World!"))
-}
-
 func (h *handler) RegisterRoutes(router *mux.Router) {
-	router.HandleFunc("/health", h.Hello).Methods("GET")
+	router.HandleFunc("/", h.uiHandler.Index).Methods("GET")
+	router.PathPrefix("/ui/").HandlerFunc(h.uiHandler.Assets).Methods("GET")
+	router.HandleFunc("/openapi.json", OpenAPI).Methods("GET")
+	router.HandleFunc("/health", h.healthHandler.Livez).Methods("GET")
+	router.HandleFunc("/livez", h.healthHandler.Livez).Methods("GET")
+	router.HandleFunc("/readyz", h.healthHandler.Readyz).Methods("GET")
+	// the listings give away the id of every upload, they are for the operators only
+	router.Handle("/uploads", requireAdminToken(h.adminToken)(http.HandlerFunc(h.uploadObjectHandler.ListUploads))).Methods("GET")
+	router.Handle("/uploads/trash", requireAdminToken(h.adminToken)(http.HandlerFunc(h.uploadObjectHandler.ListTrash))).Methods("GET")
 	router.HandleFunc("/upload", h.uploadObjectHandler.UploadObject).Methods("POST")
+	router.HandleFunc("/upload/{id}", h.uploadObjectHandler.GetUpload).Methods("GET")
+	router.HandleFunc("/upload/{id}", h.uploadObjectHandler.DeleteUpload).Methods("DELETE")
+	router.HandleFunc("/upload/{id}/restore", h.uploadObjectHandler.RestoreUpload).Methods("POST")
 	router.HandleFunc("/upload/{id}/confirm", h.uploadObjectHandler.ConfirmUpload).Methods("POST")
+	router.HandleFunc("/upload/{id}/preview", h.previewHandler.Preview).Methods("GET")
+	router.HandleFunc("/upload/{id}/qr.png", h.qrCodeHandler.Upload).Methods("GET")
+	router.HandleFunc("/upload/{id}/links", h.shortLinkHandler.CreateShortLink).Methods("POST")
+	router.HandleFunc("/bundles", h.bundleHandler.CreateBundle).Methods("POST")
+	router.HandleFunc("/bundles/{id}/confirm", h.bundleHandler.ConfirmBundle).Methods("POST")
+	router.HandleFunc("/bundles/{id}/members", h.bundleHandler.ListMembers).Methods("GET")
 	router.HandleFunc("/download/{id}", h.uploadObjectHandler.Download).Methods("GET")
+	router.HandleFunc("/s/{slug}", h.shortLinkHandler.Resolve).Methods("GET")
+	router.HandleFunc("/s/{slug}/qr.svg", h.qrCodeHandler.ShortLink).Methods("GET")
+
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(requireAdminToken(h.adminToken))
+	admin.HandleFunc("/reconcile", h.adminHandler.Reconcile).Methods("POST")
+	admin.HandleFunc("/storage-events", h.adminHandler.StorageEvents).Methods("POST")
+
+	webhooks := router.PathPrefix("/webhooks").Subrouter()
+	webhooks.Use(requireAdminToken(h.adminToken))
+	webhooks.HandleFunc("", h.webhookHandler.CreateWebhook).Methods("POST")
+	webhooks.HandleFunc("", h.webhookHandler.ListWebhooks).Methods("GET")
+	webhooks.HandleFunc("/{id}", h.webhookHandler.DeleteWebhook).Methods("DELETE")
+	webhooks.HandleFunc("/{id}/deliveries", h.webhookHandler.ListDeliveries).Methods("GET")
+	webhooks.HandleFunc("/deliveries/{id}/redeliver", h.webhookHandler.Redeliver).Methods("POST")
 }
\ No newline at end of file
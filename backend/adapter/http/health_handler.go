@@ -0,0 +1,32 @@
+package http
+
+import (
+	"net/http"
+	"quickshare/core/service"
+	web "quickshare/pkg"
+)
+
+type HealthHandler struct {
+	healthService *service.HealthService
+}
+
+func NewHealthHandler(healthService *service.HealthService) *HealthHandler {
+	return &HealthHandler{healthService: healthService}
+}
+
+// Livez only tells the process is up, it never touches dependencies
+func (h *HealthHandler) Livez(w http.ResponseWriter, r *http.Request) {
+	web.WriteJSON(w, http.StatusOK, statusResponse{Status: service.HealthStatusUp})
+}
+
+// Readyz checks every dependency and answers 503 when one of them is down
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.healthService.Readiness()
+
+	status := http.StatusOK
+	if report.Status != service.HealthStatusUp {
+		status = http.StatusServiceUnavailable
+	}
+
+	web.WriteJSON(w, status, report)
+}
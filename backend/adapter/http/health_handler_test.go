@@ -0,0 +1,35 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"quickshare/core/service"
+	"testing"
+)
+
+func TestHealthHandler_Readyz(t *testing.T) {
+	tests := []struct {
+		name       string
+		check      service.HealthCheck
+		wantStatus int
+	}{
+		{name: "every dependency up", check: func() error { return nil }, wantStatus: http.StatusOK},
+		{name: "one dependency down", check: func() error { return errors.New("connection refused") }, wantStatus: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			healthService := service.NewHealthService()
+			healthService.Register("blob_storage", func() error { return nil })
+			healthService.Register("database", tt.check)
+
+			rec := httptest.NewRecorder()
+			NewHealthHandler(healthService).Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+		})
+	}
+}
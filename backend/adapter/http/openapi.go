@@ -0,0 +1,19 @@
+package http
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec describes the API, clients are generated from it. Keep it in
+// step with the handlers, the contract tests fail when they drift apart.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPISpec)
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"quickshare/core/service"
+	web "quickshare/pkg"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type PreviewHandler struct {
+	previewService *service.PreviewService
+}
+
+func NewPreviewHandler(previewService *service.PreviewService) *PreviewHandler {
+	return &PreviewHandler{previewService: previewService}
+}
+
+// Preview streams the thumbnail of an image upload, ?size= is small, medium (default) or large
+func (h *PreviewHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	preview, content, err := h.previewService.OpenPreview(id, r.URL.Query().Get("size"))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		web.WriteJSON(w, http.StatusNotFound, errorResponse{Error: "upload not found"})
+		return
+	case errors.Is(err, service.ErrPreviewNotAvailable):
+		web.WriteJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+		return
+	case errors.Is(err, service.ErrUploadQuarantined):
+		web.WriteJSON(w, http.StatusForbidden, errorResponse{Error: err.Error()})
+		return
+	case err != nil:
+		if !errors.Is(err, service.ErrInvalidPreviewSize) {
+			log.Println("error opening preview", err)
+		}
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", preview.MimeType)
+	w.Header().Set("Content-Length", strconv.FormatInt(preview.FileSize, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// short lived, the preview goes away with its upload
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, content); err != nil {
+		log.Printf("error streaming preview of %s: %v", id, err)
+	}
+}
@@ -0,0 +1,143 @@
+package http
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"quickshare/core/service"
+	web "quickshare/pkg"
+	"quickshare/pkg/qrcode"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type QRCodeOptions struct {
+	// Size is the width of the PNG codes in pixels
+	Size  int
+	Level qrcode.Level
+	// PublicURL is the base of the encoded links, the origin of the request when empty
+	PublicURL string
+}
+
+// QRCodeHandler renders the public share URL of an upload as a QR code, for
+// handing a file over to a phone. The #k=... fragment of encrypted uploads
+// never reaches the server, their codes carry the link without the key.
+type QRCodeHandler struct {
+	uploadObjectService *service.UploadObjectService
+	shortLinkService    *service.ShortLinkService
+	options             QRCodeOptions
+}
+
+func NewQRCodeHandler(uploadObjectService *service.UploadObjectService, shortLinkService *service.ShortLinkService, options QRCodeOptions) *QRCodeHandler {
+	return &QRCodeHandler{
+		uploadObjectService: uploadObjectService,
+		shortLinkService:    shortLinkService,
+		options:             options,
+	}
+}
+
+// Upload renders the download link of the upload as a PNG
+func (h *QRCodeHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	_, err := h.uploadObjectService.GetSharedUpload(id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		web.WriteJSON(w, http.StatusNotFound, errorResponse{Error: "upload not found"})
+		return
+	case errors.Is(err, service.ErrUploadDeleted), errors.Is(err, service.ErrUploadExpired):
+		web.WriteJSON(w, http.StatusGone, errorResponse{Error: err.Error()})
+		return
+	case errors.Is(err, service.ErrUploadQuarantined):
+		web.WriteJSON(w, http.StatusForbidden, errorResponse{Error: err.Error()})
+		return
+	case errors.Is(err, service.ErrUploadNotCompleted):
+		web.WriteJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+		return
+	case err != nil:
+		log.Println("error getting upload for QR code", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to get upload"})
+		return
+	}
+
+	code, ok := h.encode(w, h.publicURL(r)+"/download/"+url.PathEscape(id))
+	if !ok {
+		return
+	}
+	content, err := code.PNG(h.options.Size, qrcode.QuietZone)
+	if err != nil {
+		log.Println("error rendering QR code", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to render QR code"})
+		return
+	}
+	writeQRCode(w, "image/png", content)
+}
+
+// ShortLink renders the short link as an SVG
+func (h *QRCodeHandler) ShortLink(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+
+	shortLink, err := h.shortLinkService.ResolveShortLink(slug)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		web.WriteJSON(w, http.StatusNotFound, errorResponse{Error: "short link not found"})
+		return
+	case errors.Is(err, service.ErrShortLinkExpired):
+		web.WriteJSON(w, http.StatusGone, errorResponse{Error: err.Error()})
+		return
+	case err != nil:
+		log.Println("error resolving short link", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to resolve short link"})
+		return
+	}
+
+	code, ok := h.encode(w, h.publicURL(r)+"/s/"+shortLink.Slug)
+	if !ok {
+		return
+	}
+	writeQRCode(w, "image/svg+xml", code.SVG(h.options.Size, qrcode.QuietZone))
+}
+
+func (h *QRCodeHandler) encode(w http.ResponseWriter, link string) (*qrcode.Code, bool) {
+	code, err := qrcode.Encode(link, h.options.Level)
+	if err != nil {
+		log.Println("error encoding QR code", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to encode QR code"})
+		return nil, false
+	}
+	return code, true
+}
+
+// publicURL is the configured base URL, or else the scheme and host the client
+// reached the server on, as told by a reverse proxy when there is one
+func (h *QRCodeHandler) publicURL(r *http.Request) string {
+	if h.options.PublicURL != "" {
+		return strings.TrimSuffix(h.options.PublicURL, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+
+	host := r.Host
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" {
+		host = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	return scheme + "://" + host
+}
+
+func writeQRCode(w http.ResponseWriter, contentType string, content []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// the code outlives neither the upload nor its link
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
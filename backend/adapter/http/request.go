@@ -0,0 +1,66 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"quickshare/core/service"
+	web "quickshare/pkg"
+	"reflect"
+	"strings"
+)
+
+// readStrictJSON decodes a body of at most maxSize bytes holding one JSON
+// value, fields v doesn't have are refused. It writes the error response and
+// returns false when the body can't be decoded.
+func readStrictJSON(w http.ResponseWriter, r *http.Request, maxSize int64, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSize))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err == nil && decoder.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("unexpected data after the JSON value")
+	}
+	if err == nil {
+		return true
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		web.WriteJSON(w, http.StatusRequestEntityTooLarge, errorResponse{Error: "request body is too large"})
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: "Invalid request body", Fields: []service.FieldError{
+			{Field: typeErr.Field, Message: "must be " + jsonType(typeErr.Type.Kind())},
+		}})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: "Invalid request body", Fields: []service.FieldError{
+			{Field: field, Message: "is not a known field"},
+		}})
+	default:
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: "Invalid request body: " + err.Error()})
+	}
+	return false
+}
+
+// jsonType names the JSON type a Go kind is decoded from
+func jsonType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
@@ -0,0 +1,45 @@
+package http
+
+import (
+	"quickshare/core/model"
+	"quickshare/core/service"
+)
+
+// The bodies of the API responses that aren't a core type on their own, they
+// are described by openapi.json and the contract tests keep both in sync.
+
+// errorResponse is the body of every JSON error
+type errorResponse struct {
+	Error string `json:"error"`
+	// Fields tells which fields of an invalid request body are wrong
+	Fields []service.FieldError `json:"fields,omitempty"`
+}
+
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+type downloadResponse struct {
+	ID          string `json:"id"`
+	DownloadURL string `json:"download_url"`
+	// DownloadHeaders must be sent with the GET to the download URL (sse-c)
+	DownloadHeaders map[string]string `json:"download_headers,omitempty"`
+}
+
+type shortLinkResponse struct {
+	*model.ShortLink
+	// URL is the path to share, clients append the #k=... fragment of encrypted uploads to it
+	URL string `json:"url"`
+}
+
+type bundleMembersResponse struct {
+	Items []*model.UploadObject `json:"items"`
+}
+
+type webhookListResponse struct {
+	Items []*model.Webhook `json:"items"`
+}
+
+type deliveryListResponse struct {
+	Items []*model.WebhookDelivery `json:"items"`
+}
@@ -0,0 +1,56 @@
+package http
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"quickshare/core/service"
+	web "quickshare/pkg"
+
+	"github.com/gorilla/mux"
+)
+
+type ShortLinkHandler struct {
+	shortLinkService *service.ShortLinkService
+}
+
+func NewShortLinkHandler(shortLinkService *service.ShortLinkService) *ShortLinkHandler {
+	return &ShortLinkHandler{shortLinkService: shortLinkService}
+}
+
+func (h *ShortLinkHandler) CreateShortLink(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	shortLink, err := h.shortLinkService.CreateShortLink(id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		web.WriteJSON(w, http.StatusNotFound, errorResponse{Error: "upload not found"})
+	case errors.Is(err, service.ErrUploadDeleted):
+		web.WriteJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+	case err != nil:
+		log.Println("error creating short link", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to create short link"})
+	default:
+		web.WriteJSON(w, http.StatusCreated, shortLinkResponse{ShortLink: shortLink, URL: "/s/" + shortLink.Slug})
+	}
+}
+
+// Resolve redirects to the upload. The redirect has no fragment of its own so
+// browsers carry the one of the short link over, decryption keys included.
+func (h *ShortLinkHandler) Resolve(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+
+	shortLink, err := h.shortLinkService.ResolveShortLink(slug)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		web.WriteJSON(w, http.StatusNotFound, errorResponse{Error: "short link not found"})
+	case errors.Is(err, service.ErrShortLinkExpired):
+		web.WriteJSON(w, http.StatusGone, errorResponse{Error: err.Error()})
+	case err != nil:
+		log.Println("error resolving short link", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to resolve short link"})
+	default:
+		http.Redirect(w, r, shortLink.OriginalLink, http.StatusFound)
+	}
+}
@@ -0,0 +1,128 @@
+// Upload page: POST /upload, PUT the file to the presigned URL, confirm it,
+// then hand out a short link and its QR code.
+"use strict";
+
+const drop = document.getElementById("drop");
+const input = document.getElementById("file");
+const expiry = document.getElementById("expiry");
+const list = document.getElementById("uploads");
+const row = document.getElementById("upload");
+
+drop.addEventListener("dragover", (event) => {
+  event.preventDefault();
+  drop.classList.add("over");
+});
+drop.addEventListener("dragleave", () => drop.classList.remove("over"));
+drop.addEventListener("drop", (event) => {
+  event.preventDefault();
+  drop.classList.remove("over");
+  send(event.dataTransfer.files);
+});
+input.addEventListener("change", () => {
+  send(input.files);
+  input.value = "";
+});
+
+// files go one after the other so each gets the full bandwidth
+async function send(files) {
+  for (const file of Array.from(files)) {
+    await upload(file, render(file));
+  }
+}
+
+function render(file) {
+  const item = row.content.firstElementChild.cloneNode(true);
+  item.querySelector(".name").textContent = file.name;
+  item.querySelector(".copy").addEventListener("click", () => {
+    const link = item.querySelector(".link input");
+    link.select();
+    navigator.clipboard.writeText(link.value).then(() => status(item, "Link copied"), () => {});
+  });
+  list.prepend(item);
+  return item;
+}
+
+function status(item, text, failed) {
+  item.querySelector(".status").textContent = text;
+  item.classList.toggle("failed", Boolean(failed));
+}
+
+async function upload(file, item) {
+  try {
+    status(item, "Starting…");
+    const request = {
+      file_name: file.name,
+      file_size: file.size,
+      mime_type: file.type || "application/octet-stream",
+    };
+    if (expiry.value) {
+      request.expires_at = new Date(Date.now() + Number(expiry.value) * 1000).toISOString();
+    }
+    const created = await api("POST", "/upload", request);
+
+    await put(created.upload_url, created.upload_headers || {}, file, (loaded) => {
+      const percent = file.size ? Math.floor((loaded / file.size) * 100) : 100;
+      item.querySelector("progress").value = percent;
+      status(item, "Uploading… " + percent + "%");
+    });
+
+    status(item, "Confirming…");
+    const confirmed = await api("POST", "/upload/" + encodeURIComponent(created.id) + "/confirm");
+    item.classList.add("done");
+
+    await share(item, created.id);
+    status(item, confirmed.status === "scanning" ? "Uploaded, the link works once the file is scanned" : "Uploaded");
+  } catch (err) {
+    status(item, err.message, true);
+  }
+}
+
+async function share(item, id) {
+  const link = item.querySelector(".link input");
+  const qr = item.querySelector(".qr");
+  try {
+    const shortLink = await api("POST", "/upload/" + encodeURIComponent(id) + "/links");
+    link.value = location.origin + shortLink.url;
+    qr.src = "/s/" + encodeURIComponent(shortLink.slug) + "/qr.svg";
+  } catch (err) {
+    // no short links without a database, the download link does the job
+    link.value = location.origin + "/download/" + encodeURIComponent(id);
+    qr.hidden = true;
+  }
+  item.querySelector(".share").hidden = false;
+}
+
+async function api(method, path, body) {
+  const response = await fetch(path, {
+    method: method,
+    headers: body ? { "Content-Type": "application/json" } : {},
+    body: body ? JSON.stringify(body) : undefined,
+  });
+  const data = await response.json().catch(() => ({}));
+  if (!response.ok) {
+    throw new Error(data.error || "Request failed with status " + response.status);
+  }
+  return data;
+}
+
+// put goes through XMLHttpRequest, fetch reports no upload progress
+function put(url, headers, file, progress) {
+  return new Promise((resolve, reject) => {
+    const xhr = new XMLHttpRequest();
+    xhr.open("PUT", url);
+    for (const [name, value] of Object.entries(headers)) {
+      xhr.setRequestHeader(name, value);
+    }
+    xhr.upload.addEventListener("progress", (event) => progress(event.loaded));
+    xhr.addEventListener("load", () => {
+      if (xhr.status >= 200 && xhr.status < 300) {
+        progress(file.size);
+        resolve();
+      } else {
+        reject(new Error("Storage refused the upload with status " + xhr.status));
+      }
+    });
+    xhr.addEventListener("error", () => reject(new Error("Upload failed, check the storage CORS rules")));
+    xhr.send(file);
+  });
+}
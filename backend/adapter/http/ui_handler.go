@@ -0,0 +1,42 @@
+package http
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed ui
+var uiFS embed.FS
+
+// uiPolicy lets the page talk to the API and PUT straight to the storage, whose origin isn't known here
+const uiPolicy = "default-src 'self'; connect-src *; img-src 'self' blob:; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+
+// UIHandler serves the upload page at / and its assets under /ui/. The page
+// only drives the public API, the bucket has to allow PUT from the origin of
+// the server in its CORS rules.
+type UIHandler struct {
+	assets http.Handler
+}
+
+func NewUIHandler() *UIHandler {
+	assets, _ := fs.Sub(uiFS, "ui")
+	return &UIHandler{assets: http.StripPrefix("/ui/", http.FileServerFS(assets))}
+}
+
+func (h *UIHandler) Index(w http.ResponseWriter, r *http.Request) {
+	setUIHeaders(w)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFileFS(w, r, uiFS, "ui/index.html")
+}
+
+func (h *UIHandler) Assets(w http.ResponseWriter, r *http.Request) {
+	setUIHeaders(w)
+	h.assets.ServeHTTP(w, r)
+}
+
+func setUIHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Security-Policy", uiPolicy)
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+}
@@ -1,46 +1,73 @@
 package http
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"quickshare/core/model"
+	"quickshare/core/repository"
 	"quickshare/core/service"
 	web "quickshare/pkg"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// maxUploadRequestSize is far above any valid request, encryption metadata included
+const maxUploadRequestSize = 64 << 10
+
+// uploadObjectRequest is what a client declares about a new upload, the server sets everything else
 type uploadObjectRequest struct {
 	FileName string `json:"file_name"`
 	FileSize int64 `json:"file_size"`
-	MimeType string `json:"mime_type"`
+	MimeType string `json:"mime_type,omitempty"`
 	ExpiresAt time.Time `json:"expires_at"`
+	OwnerID string `json:"owner_id,omitempty"`
+	Encryption *model.Encryption `json:"encryption,omitempty"`
 }
 
 type UploadObjectHandler struct {
 	uploadObjectService *service.UploadObjectService
+	// bundleHandler serves /download/{id} when id is a bundle
+	bundleHandler *BundleHandler
 }
 
-func NewUploadObjectHandler(uploadObjectService *service.UploadObjectService) *UploadObjectHandler {
-	return &UploadObjectHandler{uploadObjectService: uploadObjectService}
+func NewUploadObjectHandler(uploadObjectService *service.UploadObjectService, bundleHandler *BundleHandler) *UploadObjectHandler {
+	return &UploadObjectHandler{uploadObjectService: uploadObjectService, bundleHandler: bundleHandler}
 }
 
 func (h *UploadObjectHandler) UploadObject(w http.ResponseWriter, r *http.Request) {
-	var uploadObject model.UploadObject
-	
-	log.Println("starting upload object", uploadObject.FileName)
-
-	if err := web.ReadJSON(r, &uploadObject); err != nil {
-		log.Println("error reading request body", err)
-		web.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	var request uploadObjectRequest
+	if !readStrictJSON(w, r, maxUploadRequestSize, &request) {
 		return
 	}
 
-	uploadResponse, err := h.uploadObjectService.InitiateUpload(&uploadObject)
+	log.Println("starting upload object", request.FileName)
+
+	uploadResponse, err := h.uploadObjectService.InitiateUpload(&model.UploadObject{
+		FileName: request.FileName,
+		FileSize: request.FileSize,
+		MimeType: request.MimeType,
+		ExpiresAt: request.ExpiresAt,
+		OwnerID: request.OwnerID,
+		Encryption: request.Encryption,
+	})
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: "Invalid upload request", Fields: validationErr.Fields})
+		return
+	}
+	if errors.Is(err, service.ErrInvalidEncryption) {
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		log.Println("error initiating upload", err)
-		web.WriteJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to initiate upload"})
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to initiate upload"})
 		return
 	}
 
@@ -52,22 +79,46 @@ func (h *UploadObjectHandler) ConfirmUpload(w http.ResponseWriter, r *http.Reque
 	id := vars["id"]
 
 	if id == "" {
-		web.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "missing upload id"})
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: "missing upload id"})
 		return
 	}
 
 	log.Println("confirming upload for id", id)
 
-	if err := h.uploadObjectService.ConfirmUpload(id); err != nil {
+	uploadObject, err := h.uploadObjectService.ConfirmUpload(id)
+	if errors.Is(err, service.ErrMimeTypeNotAllowed) {
+		web.WriteJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, service.ErrUploadIsBundle) || errors.Is(err, service.ErrUploadNotPending) {
+		web.WriteJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
 		log.Println("error confirming upload", err)
-		web.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
 		return
 	}
 
-	web.WriteJSON(w, http.StatusOK, map[string]string{
-		"id":     id,
-		"status": "completed",
-	})
+	web.WriteJSON(w, http.StatusOK, uploadObject)
+}
+
+// GetUpload returns the upload record with its lifecycle timestamps
+func (h *UploadObjectHandler) GetUpload(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	uploadObject, err := h.uploadObjectService.GetUploadObject(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		web.WriteJSON(w, http.StatusNotFound, errorResponse{Error: "upload not found"})
+		return
+	}
+	if err != nil {
+		log.Println("error getting upload", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to get upload"})
+		return
+	}
+
+	web.WriteJSON(w, http.StatusOK, uploadObject)
 }
 
 // Download retorna uma URL de download para um upload já concluído
@@ -76,21 +127,158 @@ func (h *UploadObjectHandler) Download(w http.ResponseWriter, r *http.Request) {
 	id := vars["id"]
 
 	if id == "" {
-		web.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "missing upload id"})
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: "missing upload id"})
+		return
+	}
+
+	// browsers get the landing page of the share link, API clients the JSON
+	w.Header().Add("Vary", "Accept")
+	if r.URL.Query().Has("download") {
+		h.downloadFile(w, r, id)
+		return
+	}
+	if acceptsHTML(r) {
+		h.downloadPage(w, r, id)
 		return
 	}
 
 	log.Println("generating download URL for id", id)
 
-	downloadURL, err := h.uploadObjectService.GetDownloadURL(id)
+	download, err := h.uploadObjectService.GetDownloadURL(id)
+	if errors.Is(err, service.ErrUploadIsBundle) {
+		h.bundleHandler.Download(w, r)
+		return
+	}
+	if errors.Is(err, service.ErrUploadQuarantined) {
+		web.WriteJSON(w, http.StatusForbidden, errorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		log.Println("error generating download URL", err)
-		web.WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
 		return
 	}
 
-	web.WriteJSON(w, http.StatusOK, map[string]string{
-		"id":           id,
-		"download_url": downloadURL,
-	})
-}
\ No newline at end of file
+	web.WriteJSON(w, http.StatusOK, downloadResponse{ID: id, DownloadURL: download.URL, DownloadHeaders: download.Headers})
+}
+
+// DeleteUpload moves the upload to the trash, it can be restored during the grace period
+func (h *UploadObjectHandler) DeleteUpload(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	uploadObject, err := h.uploadObjectService.DeleteUploadObject(id)
+	if err != nil {
+		h.writeLifecycleError(w, "deleting", err)
+		return
+	}
+
+	web.WriteJSON(w, http.StatusOK, uploadObject)
+}
+
+func (h *UploadObjectHandler) RestoreUpload(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	uploadObject, err := h.uploadObjectService.RestoreUploadObject(id)
+	if err != nil {
+		h.writeLifecycleError(w, "restoring", err)
+		return
+	}
+
+	web.WriteJSON(w, http.StatusOK, uploadObject)
+}
+
+func (h *UploadObjectHandler) writeLifecycleError(w http.ResponseWriter, action string, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		web.WriteJSON(w, http.StatusNotFound, errorResponse{Error: "upload not found"})
+	case errors.Is(err, service.ErrUploadDeleted), errors.Is(err, service.ErrUploadNotDeleted):
+		web.WriteJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+	case errors.Is(err, service.ErrRestoreWindowExpired):
+		web.WriteJSON(w, http.StatusGone, errorResponse{Error: err.Error()})
+	default:
+		log.Println("error "+action+" upload", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed " + action + " upload"})
+	}
+}
+
+// ListTrash pages through deleted uploads, same filters as ListUploads
+func (h *UploadObjectHandler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	h.listUploads(w, r, h.uploadObjectService.ListTrash)
+}
+
+// ListUploads pages through uploads, filters come from the query string and next_cursor feeds the next call
+func (h *UploadObjectHandler) ListUploads(w http.ResponseWriter, r *http.Request) {
+	h.listUploads(w, r, h.uploadObjectService.ListUploadObjects)
+}
+
+type listFunc func(filter repository.UploadObjectFilter, cursor string, limit int) (*service.UploadListResponse, error)
+
+func (h *UploadObjectHandler) listUploads(w http.ResponseWriter, r *http.Request, list listFunc) {
+	query := r.URL.Query()
+
+	filter, err := parseUploadObjectFilter(query)
+	if err != nil {
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: "limit must be a positive integer"})
+			return
+		}
+	}
+
+	uploadList, err := list(filter, query.Get("cursor"), limit)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		log.Println("error listing uploads", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to list uploads"})
+		return
+	}
+
+	web.WriteJSON(w, http.StatusOK, uploadList)
+}
+
+func parseUploadObjectFilter(query url.Values) (repository.UploadObjectFilter, error) {
+	filter := repository.UploadObjectFilter{
+		OwnerID:        query.Get("owner_id"),
+		Status:         query.Get("status"),
+		MimeType:       query.Get("mime_type"),
+		FileNamePrefix: query.Get("file_name_prefix"),
+	}
+
+	sizes := map[string]**int64{"min_size": &filter.MinSize, "max_size": &filter.MaxSize}
+	for name, target := range sizes {
+		if value := query.Get(name); value != "" {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return filter, fmt.Errorf("%s must be a non-negative integer", name)
+			}
+			*target = &size
+		}
+	}
+
+	times := map[string]*time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+		"expires_after":  &filter.ExpiresAfter,
+		"expires_before": &filter.ExpiresBefore,
+	}
+	for name, target := range times {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*target = parsed
+		}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"quickshare/core/service"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUploadObjectHandler_UploadObjectRejectsInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantFields []service.FieldError
+	}{
+		{
+			name:       "server side fields",
+			body:       `{"file_name":"report.pdf","file_size":1,"status":"completed"}`,
+			wantStatus: http.StatusBadRequest,
+			wantFields: []service.FieldError{{Field: "status", Message: "is not a known field"}},
+		},
+		{
+			name:       "wrong type",
+			body:       `{"file_name":"report.pdf","file_size":"big"}`,
+			wantStatus: http.StatusBadRequest,
+			wantFields: []service.FieldError{{Field: "file_size", Message: "must be an integer"}},
+		},
+		{
+			name:       "trailing data",
+			body:       `{"file_name":"report.pdf","file_size":1} {}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "too large",
+			body:       `{"file_name":"report.pdf","file_size":1,"owner_id":"` + strings.Repeat("x", maxUploadRequestSize) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "invalid fields",
+			body:       `{"file_name":"","file_size":-1,"mime_type":"pdf"}`,
+			wantStatus: http.StatusBadRequest,
+			wantFields: []service.FieldError{
+				{Field: "file_name", Message: "is required"},
+				{Field: "file_size", Message: "must be positive"},
+				{Field: "mime_type", Message: "must be a MIME type such as application/pdf"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			newContractRouter().ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body)
+			}
+			var body errorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error == "" || !reflect.DeepEqual(body.Fields, tt.wantFields) {
+				t.Errorf("expected fields %v, got %+v", tt.wantFields, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package http
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"quickshare/core/service"
+	web "quickshare/pkg"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type WebhookHandler struct {
+	webhookService *service.WebhookService
+}
+
+func NewWebhookHandler(webhookService *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService}
+}
+
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var request webhookRequest
+	if err := web.ReadJSON(r, &request); err != nil {
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	webhook, err := h.webhookService.CreateWebhook(request.URL, request.Events)
+	if errors.Is(err, service.ErrInvalidWebhook) {
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		log.Println("error creating webhook", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to create webhook"})
+		return
+	}
+
+	web.WriteJSON(w, http.StatusCreated, webhook)
+}
+
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.webhookService.ListWebhooks()
+	if err != nil {
+		log.Println("error listing webhooks", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to list webhooks"})
+		return
+	}
+
+	web.WriteJSON(w, http.StatusOK, webhookListResponse{Items: webhooks})
+}
+
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	err := h.webhookService.DeleteWebhook(mux.Vars(r)["id"])
+	if errors.Is(err, sql.ErrNoRows) {
+		web.WriteJSON(w, http.StatusNotFound, errorResponse{Error: "webhook not found"})
+		return
+	}
+	if err != nil {
+		log.Println("error deleting webhook", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to delete webhook"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries shows the latest deliveries of a webhook, ?status=dead lists the dead letters
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: "limit must be a positive integer"})
+			return
+		}
+	}
+
+	deliveries, err := h.webhookService.ListDeliveries(mux.Vars(r)["id"], query.Get("status"), limit)
+	if errors.Is(err, sql.ErrNoRows) {
+		web.WriteJSON(w, http.StatusNotFound, errorResponse{Error: "webhook not found"})
+		return
+	}
+	if err != nil {
+		log.Println("error listing webhook deliveries", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to list deliveries"})
+		return
+	}
+
+	web.WriteJSON(w, http.StatusOK, deliveryListResponse{Items: deliveries})
+}
+
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		web.WriteJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid delivery id"})
+		return
+	}
+
+	delivery, err := h.webhookService.Redeliver(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		web.WriteJSON(w, http.StatusNotFound, errorResponse{Error: "delivery not found"})
+		return
+	}
+	if err != nil {
+		log.Println("error redelivering webhook", err)
+		web.WriteJSON(w, http.StatusInternalServerError, errorResponse{Error: "Failed to redeliver"})
+		return
+	}
+
+	web.WriteJSON(w, http.StatusAccepted, delivery)
+}
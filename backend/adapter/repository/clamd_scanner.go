@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"quickshare/core/repository"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize stays well below the default StreamMaxLength of clamd
+const clamdChunkSize = 32 * 1024
+
+// ClamdScanner streams content to clamd with the INSTREAM command
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner takes tcp://host:port, unix:///path/to/clamd.sock or a bare
+// host:port. The timeout applies to every chunk sent and to the verdict.
+func NewClamdScanner(address string, timeout time.Duration) (*ClamdScanner, error) {
+	network, target := "tcp", address
+	if strings.Contains(address, "://") {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid clamd address %q: %w", address, err)
+		}
+		switch u.Scheme {
+		case "tcp":
+			target = u.Host
+		case "unix":
+			network, target = "unix", u.Path
+		default:
+			return nil, fmt.Errorf("unsupported clamd address scheme %q", u.Scheme)
+		}
+	}
+	if target == "" {
+		return nil, fmt.Errorf("invalid clamd address %q", address)
+	}
+
+	return &ClamdScanner{network: network, address: target, timeout: timeout}, nil
+}
+
+func (c *ClamdScanner) Ping() error {
+	reply, err := c.command("zPING\x00", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+	return nil
+}
+
+func (c *ClamdScanner) Scan(content io.Reader) (repository.ScanResult, error) {
+	reply, err := c.command("zINSTREAM\x00", content)
+	if err != nil {
+		return repository.ScanResult{}, err
+	}
+
+	// replies look like "stream: OK", "stream: Eicar-Signature FOUND" or "<reason> ERROR"
+	verdict := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case verdict == "OK":
+		return repository.ScanResult{Clean: true}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return repository.ScanResult{Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	default:
+		return repository.ScanResult{}, fmt.Errorf("clamd scan failed: %s", reply)
+	}
+}
+
+// command sends a null terminated command, followed by content in INSTREAM
+// chunks when it isn't nil, and returns the reply
+func (c *ClamdScanner) command(command string, content io.Reader) (string, error) {
+	conn, err := net.DialTimeout(c.network, c.address, c.timeout)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := io.WriteString(conn, command); err != nil {
+		return "", fmt.Errorf("failed to send clamd command: %w", err)
+	}
+
+	if content != nil {
+		if err := c.stream(conn, content); err != nil {
+			// clamd hangs up when the stream is over its size limit, its reply says so
+			if reply, replyErr := readClamdReply(conn); replyErr == nil {
+				return "", fmt.Errorf("clamd scan failed: %s", reply)
+			}
+			return "", err
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(c.timeout))
+	return readClamdReply(conn)
+}
+
+func (c *ClamdScanner) stream(conn net.Conn, content io.Reader) error {
+	chunk := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := io.ReadFull(content, chunk[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(chunk[:4], uint32(n))
+			conn.SetDeadline(time.Now().Add(c.timeout))
+			if _, err := conn.Write(chunk[:4+n]); err != nil {
+				return fmt.Errorf("failed to stream to clamd: %w", err)
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read content: %w", err)
+		}
+	}
+
+	// a zero length chunk ends the stream
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("failed to stream to clamd: %w", err)
+	}
+	return nil
+}
+
+func readClamdReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return strings.TrimSpace(strings.TrimRight(reply, "\x00")), nil
+}
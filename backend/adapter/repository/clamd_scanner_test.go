@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd answers PING and INSTREAM like clamd, it flags the EICAR test
+// string and hangs up on streams longer than maxStream
+func fakeClamd(t *testing.T, network string, address string, maxStream int) string {
+	t.Helper()
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn, maxStream)
+		}
+	}()
+
+	if network == "unix" {
+		return "unix://" + listener.Addr().String()
+	}
+	return "tcp://" + listener.Addr().String()
+}
+
+func serveClamd(conn net.Conn, maxStream int) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	command, err := reader.ReadString('\x00')
+	if err != nil {
+		return
+	}
+
+	switch command {
+	case "zPING\x00":
+		conn.Write([]byte("PONG\x00"))
+	case "zINSTREAM\x00":
+		var content bytes.Buffer
+		for {
+			var size uint32
+			if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			if content.Len()+int(size) > maxStream {
+				conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+				// drain before hanging up, closing with unread data resets the connection
+				conn.SetReadDeadline(time.Now().Add(time.Second))
+				io.Copy(io.Discard, reader)
+				return
+			}
+			if _, err := io.CopyN(&content, reader, int64(size)); err != nil {
+				return
+			}
+		}
+
+		if strings.Contains(content.String(), eicar) {
+			conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+			return
+		}
+		conn.Write([]byte("stream: OK\x00"))
+	default:
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+	}
+}
+
+func TestClamdScanner_Scan(t *testing.T) {
+	tcpAddress := fakeClamd(t, "tcp", "127.0.0.1:0", 1<<20)
+	unixAddress := fakeClamd(t, "unix", filepath.Join(t.TempDir(), "clamd.sock"), 1<<20)
+
+	tests := []struct {
+		name          string
+		address       string
+		content       string
+		wantClean     bool
+		wantSignature string
+		wantErr       bool
+	}{
+		{name: "success - clean content over tcp", address: tcpAddress, content: "hello world", wantClean: true},
+		{name: "success - clean content over a unix socket", address: unixAddress, content: "hello world", wantClean: true},
+		{name: "success - content bigger than a chunk", address: tcpAddress, content: strings.Repeat("a", 3*clamdChunkSize+10), wantClean: true},
+		{name: "success - empty content", address: tcpAddress, content: "", wantClean: true},
+		{name: "success - infected content", address: tcpAddress, content: "prefix " + eicar, wantSignature: "Eicar-Signature"},
+		{name: "error - stream over the clamd limit", address: tcpAddress, content: strings.Repeat("a", 2<<20), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner, err := NewClamdScanner(tt.address, 5*time.Second)
+			if err != nil {
+				t.Fatalf("failed to create scanner: %v", err)
+			}
+
+			result, err := scanner.Scan(strings.NewReader(tt.content))
+			if tt.wantErr {
+				if err == nil || !contains(err.Error(), "size limit exceeded") {
+					t.Errorf("expected the size limit error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Clean != tt.wantClean || result.Signature != tt.wantSignature {
+				t.Errorf("expected clean %v signature %q, got %+v", tt.wantClean, tt.wantSignature, result)
+			}
+		})
+	}
+}
+
+func TestClamdScanner_Ping(t *testing.T) {
+	scanner, err := NewClamdScanner(fakeClamd(t, "tcp", "127.0.0.1:0", 1<<20), time.Second)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+	if err := scanner.Ping(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	unreachable, _ := NewClamdScanner("tcp://127.0.0.1:1", time.Second)
+	if err := unreachable.Ping(); err == nil {
+		t.Error("expected an error for an unreachable clamd")
+	}
+
+	if _, err := NewClamdScanner("http://clamav:3310", time.Second); err == nil {
+		t.Error("expected an error for an unsupported scheme")
+	}
+}
@@ -1,10 +1,21 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"quickshare/core/model"
+	"quickshare/core/repository"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+const pingTimeout = 2 * time.Second
+
 type PostgreSQLRepository struct {
 	db *sql.DB
 }
@@ -12,9 +23,33 @@ func NewPostgreSQLRepository(db *sql.DB) *PostgreSQLRepository {
 	return &PostgreSQLRepository{db: db}
 }
 
+const uploadObjectColumns = `id, file_name, file_size, mime_type, object_key, status, expires_at, COALESCE(owner_id, ''), created_at, updated_at, confirmed_at, deleted_at, COALESCE(detected_mime_type, ''), COALESCE(quarantine_reason, ''), encryption, storage_encryption, kind, COALESCE(bundle_id, ''), COALESCE(preview_status, '')`
+
 func (r *PostgreSQLRepository) CreateUploadObject(uploadObject *model.UploadObject) (*model.UploadObject, error) {
-	query := `INSERT INTO upload_objects (id, file_name, file_size, mime_type, object_key, status, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
-	err := r.db.QueryRow(query, uploadObject.ID, uploadObject.FileName, uploadObject.FileSize, uploadObject.MimeType, uploadObject.ObjectKey, uploadObject.Status, uploadObject.ExpiresAt).Scan(&uploadObject.ID)
+	return createUploadObject(r.db, uploadObject)
+}
+
+// queryRower is a *sql.DB or the *sql.Tx of a change that publishes an event
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func createUploadObject(db queryRower, uploadObject *model.UploadObject) (*model.UploadObject, error) {
+	encryption, err := jsonbValue(uploadObject.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	storageEncryption, err := jsonbValue(uploadObject.StorageEncryption)
+	if err != nil {
+		return nil, err
+	}
+
+	if uploadObject.Kind == "" {
+		uploadObject.Kind = model.UploadKindFile
+	}
+
+	query := `INSERT INTO upload_objects (id, file_name, file_size, mime_type, object_key, status, expires_at, owner_id, encryption, storage_encryption, kind, bundle_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id, created_at, updated_at`
+	err = db.QueryRow(query, uploadObject.ID, uploadObject.FileName, uploadObject.FileSize, uploadObject.MimeType, uploadObject.ObjectKey, uploadObject.Status, uploadObject.ExpiresAt, nullString(uploadObject.OwnerID), encryption, storageEncryption, uploadObject.Kind, nullString(uploadObject.BundleID)).Scan(&uploadObject.ID, &uploadObject.CreatedAt, &uploadObject.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -22,20 +57,56 @@ func (r *PostgreSQLRepository) CreateUploadObject(uploadObject *model.UploadObje
 }
 
 func (r *PostgreSQLRepository) GetUploadObject(id string) (*model.UploadObject, error) {
-	query := `SELECT id, file_name, file_size, mime_type, object_key, status, expires_at FROM upload_objects WHERE id = $1`
-	var uploadObject model.UploadObject
-	
-	row := r.db.QueryRow(query, id)
-	err := row.Scan(&uploadObject.ID, &uploadObject.FileName, &uploadObject.FileSize, &uploadObject.MimeType, &uploadObject.ObjectKey, &uploadObject.Status, &uploadObject.ExpiresAt)
+	query := `SELECT ` + uploadObjectColumns + ` FROM upload_objects WHERE id = $1`
+
+	uploadObject, err := scanUploadObject(r.db.QueryRow(query, id))
 	if err != nil {
 		return nil, err
 	}
-	return &uploadObject, nil
+	return uploadObject, nil
 }
 
 func (r *PostgreSQLRepository) UpdateUploadObject(id string, uploadObject *model.UploadObject) (*model.UploadObject, error) {
-	query := `UPDATE upload_objects SET file_name = $1, file_size = $2, mime_type = $3, object_key = $4, status = $5, expires_at = $6 WHERE id = $7 RETURNING id`
-	err := r.db.QueryRow(query, uploadObject.FileName, uploadObject.FileSize, uploadObject.MimeType, uploadObject.ObjectKey, uploadObject.Status, uploadObject.ExpiresAt, id).Scan(&uploadObject.ID)
+	return updateUploadObject(r.db, id, uploadObject, "")
+}
+
+// TransitionUploadObject saves the upload only while the row is live and still
+// in the from status, two requests racing to move it on can't both win
+func (r *PostgreSQLRepository) TransitionUploadObject(id string, from string, uploadObject *model.UploadObject, event *model.WebhookEvent) (*model.UploadObject, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	updated, err := updateUploadObject(tx, id, uploadObject, from)
+	if err != nil {
+		return nil, err
+	}
+	if event != nil {
+		if err := insertEvent(tx, event); err != nil {
+			return nil, err
+		}
+	}
+	return updated, tx.Commit()
+}
+
+// updateUploadObject saves every mutable column, a from status other than ""
+// restricts the update to a live row in that status, sql.ErrNoRows otherwise
+func updateUploadObject(db queryRower, id string, uploadObject *model.UploadObject, from string) (*model.UploadObject, error) {
+	// the encryption is dropped at confirm time when the content doesn't carry its header
+	encryption, err := jsonbValue(uploadObject.Encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE upload_objects SET file_name = $1, file_size = $2, mime_type = $3, object_key = $4, status = $5, expires_at = $6, confirmed_at = $7, deleted_at = $8, detected_mime_type = $9, quarantine_reason = $10, preview_status = $11, encryption = $12, updated_at = now() WHERE id = $13`
+	args := []interface{}{uploadObject.FileName, uploadObject.FileSize, uploadObject.MimeType, uploadObject.ObjectKey, uploadObject.Status, uploadObject.ExpiresAt, uploadObject.ConfirmedAt, uploadObject.DeletedAt, nullString(uploadObject.DetectedMimeType), nullString(uploadObject.QuarantineReason), nullString(uploadObject.PreviewStatus), encryption, id}
+	if from != "" {
+		query += ` AND status = $14 AND deleted_at IS NULL`
+		args = append(args, from)
+	}
+	err = db.QueryRow(query+` RETURNING id, updated_at`, args...).Scan(&uploadObject.ID, &uploadObject.UpdatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -49,4 +120,237 @@ func (r *PostgreSQLRepository) DeleteUploadObject(id string) error {
 		return err
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// FailStalePendingUploads marks as failed every pending upload created before the given time
+func (r *PostgreSQLRepository) FailStalePendingUploads(createdBefore time.Time) (int64, error) {
+	query := `UPDATE upload_objects SET status = $1, updated_at = now() WHERE status = $2 AND created_at < $3`
+	result, err := r.db.Exec(query, model.UploadStatusFailed, model.UploadStatusPending, createdBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// RecordScanFailure counts a failed scan of the upload and returns the failures so far
+func (r *PostgreSQLRepository) RecordScanFailure(id string, lastError string) (int, error) {
+	var attempts int
+	err := r.db.QueryRow(`UPDATE upload_objects SET scan_attempts = scan_attempts + 1, last_error = $1 WHERE id = $2 RETURNING scan_attempts`, lastError, id).Scan(&attempts)
+	return attempts, err
+}
+
+// RecordPreviewFailure counts a failed preview run of the upload and returns the failures so far
+func (r *PostgreSQLRepository) RecordPreviewFailure(id string, lastError string) (int, error) {
+	var attempts int
+	err := r.db.QueryRow(`UPDATE upload_objects SET preview_attempts = preview_attempts + 1, last_error = $1 WHERE id = $2 RETURNING preview_attempts`, lastError, id).Scan(&attempts)
+	return attempts, err
+}
+
+// Ping checks the database is reachable, it is used by the readiness probe
+func (r *PostgreSQLRepository) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+
+	return r.db.PingContext(ctx)
+}
+
+func (r *PostgreSQLRepository) ListUploadObjects(filter repository.UploadObjectFilter, cursor string, limit int) ([]*model.UploadObject, string, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	switch {
+	case filter.Trashed:
+		conditions = append(conditions, "deleted_at IS NOT NULL")
+	case filter.IncludeTrashed:
+	default:
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if !filter.DeletedBefore.IsZero() {
+		where("deleted_at < $%d", filter.DeletedBefore)
+	}
+	if filter.OwnerID != "" {
+		where("owner_id = $%d", filter.OwnerID)
+	}
+	if filter.Status != "" {
+		where("status = $%d", filter.Status)
+	}
+	if filter.PreviewStatus != "" {
+		where("preview_status = $%d", filter.PreviewStatus)
+	}
+	if filter.MimeType != "" {
+		where("mime_type = $%d", filter.MimeType)
+	}
+	if filter.MinSize != nil {
+		where("file_size >= $%d", *filter.MinSize)
+	}
+	if filter.MaxSize != nil {
+		where("file_size <= $%d", *filter.MaxSize)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		where("created_at >= $%d", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		where("created_at < $%d", filter.CreatedBefore)
+	}
+	if !filter.ExpiresAfter.IsZero() {
+		where("expires_at >= $%d", filter.ExpiresAfter)
+	}
+	if !filter.ExpiresBefore.IsZero() {
+		where("expires_at < $%d", filter.ExpiresBefore)
+	}
+	if filter.FileNamePrefix != "" {
+		where(`file_name LIKE $%d ESCAPE '\'`, escapeLike(filter.FileNamePrefix)+"%")
+	}
+
+	if cursor != "" {
+		position, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, position.CreatedAt, position.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	query := `SELECT ` + uploadObjectColumns + ` FROM upload_objects`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	// one extra row tells whether there is a next page
+	args = append(args, limit+1)
+	query += fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var uploadObjects []*model.UploadObject
+	for rows.Next() {
+		uploadObject, err := scanUploadObject(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		uploadObjects = append(uploadObjects, uploadObject)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	nextCursor := ""
+	if len(uploadObjects) > limit {
+		uploadObjects = uploadObjects[:limit]
+		last := uploadObjects[len(uploadObjects)-1]
+		nextCursor = encodeCursor(cursorPosition{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	return uploadObjects, nextCursor, nil
+}
+
+func (r *PostgreSQLRepository) FindUploadObjectsByObjectKeys(objectKeys []string) ([]*model.UploadObject, error) {
+	query := `SELECT ` + uploadObjectColumns + ` FROM upload_objects WHERE object_key = ANY($1)`
+
+	rows, err := r.db.Query(query, pq.Array(objectKeys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uploadObjects []*model.UploadObject
+	for rows.Next() {
+		uploadObject, err := scanUploadObject(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploadObjects = append(uploadObjects, uploadObject)
+	}
+	return uploadObjects, rows.Err()
+}
+
+func (r *PostgreSQLRepository) ListBundleMembers(bundleID string) ([]*model.UploadObject, error) {
+	query := `SELECT ` + uploadObjectColumns + ` FROM upload_objects WHERE bundle_id = $1 ORDER BY file_name, id`
+
+	rows, err := r.db.Query(query, bundleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uploadObjects []*model.UploadObject
+	for rows.Next() {
+		uploadObject, err := scanUploadObject(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploadObjects = append(uploadObjects, uploadObject)
+	}
+	return uploadObjects, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUploadObject(row rowScanner) (*model.UploadObject, error) {
+	var uploadObject model.UploadObject
+	var encryption, storageEncryption []byte
+	err := row.Scan(&uploadObject.ID, &uploadObject.FileName, &uploadObject.FileSize, &uploadObject.MimeType, &uploadObject.ObjectKey, &uploadObject.Status, &uploadObject.ExpiresAt, &uploadObject.OwnerID, &uploadObject.CreatedAt, &uploadObject.UpdatedAt, &uploadObject.ConfirmedAt, &uploadObject.DeletedAt, &uploadObject.DetectedMimeType, &uploadObject.QuarantineReason, &encryption, &storageEncryption, &uploadObject.Kind, &uploadObject.BundleID, &uploadObject.PreviewStatus)
+	if err != nil {
+		return nil, err
+	}
+	if len(encryption) > 0 {
+		if err := json.Unmarshal(encryption, &uploadObject.Encryption); err != nil {
+			return nil, fmt.Errorf("invalid encryption metadata of upload %s: %w", uploadObject.ID, err)
+		}
+	}
+	if len(storageEncryption) > 0 {
+		if err := json.Unmarshal(storageEncryption, &uploadObject.StorageEncryption); err != nil {
+			return nil, fmt.Errorf("invalid storage encryption of upload %s: %w", uploadObject.ID, err)
+		}
+	}
+	return &uploadObject, nil
+}
+
+// cursorPosition is the keyset of the last row of a page, clients only see it base64 encoded
+type cursorPosition struct {
+	CreatedAt time.Time `json:"c"`
+	ID        string    `json:"i"`
+}
+
+func encodeCursor(position cursorPosition) string {
+	content, _ := json.Marshal(position)
+	return base64.RawURLEncoding.EncodeToString(content)
+}
+
+func decodeCursor(cursor string) (cursorPosition, error) {
+	var position cursorPosition
+
+	content, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return position, repository.ErrInvalidCursor
+	}
+	if err := json.Unmarshal(content, &position); err != nil || position.ID == "" {
+		return position, repository.ErrInvalidCursor
+	}
+	return position, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// jsonbValue is the JSONB of an optional field, NULL when it is unset
+func jsonbValue[T any](value *T) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"quickshare/core/model"
+	"time"
+)
+
+func (r *PostgreSQLRepository) PurgeUploadObject(id string, objectKey string, event *model.WebhookEvent) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// restored in the meantime uploads are left alone
+	result, err := tx.Exec(`DELETE FROM upload_objects WHERE id = $1 AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(`INSERT INTO blob_deletions (upload_id, object_key) VALUES ($1, $2)`, id, objectKey); err != nil {
+		return err
+	}
+
+	// the previews go with the upload, their objects too
+	previews := `WITH previews AS (DELETE FROM upload_previews WHERE upload_id = $1 RETURNING upload_id, object_key)
+		INSERT INTO blob_deletions (upload_id, object_key) SELECT upload_id, object_key FROM previews`
+	if _, err := tx.Exec(previews, id); err != nil {
+		return err
+	}
+
+	if err := insertEvent(tx, event); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *PostgreSQLRepository) RejectUploadObject(id string, from string, uploadObject *model.UploadObject) (*model.UploadObject, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	updated, err := updateUploadObject(tx, id, uploadObject, from)
+	if err != nil {
+		return nil, err
+	}
+
+	// the row stays to tell the client why, only the object goes
+	if _, err := tx.Exec(`INSERT INTO blob_deletions (upload_id, object_key) VALUES ($1, $2)`, id, uploadObject.ObjectKey); err != nil {
+		return nil, err
+	}
+
+	return updated, tx.Commit()
+}
+
+func (r *PostgreSQLRepository) ClaimBlobDeletions(limit int, lease time.Duration) ([]*model.BlobDeletion, error) {
+	query := `UPDATE blob_deletions SET attempts = attempts + 1, next_attempt_at = now() + $1::interval
+		WHERE id IN (
+			SELECT id FROM blob_deletions WHERE next_attempt_at <= now() ORDER BY next_attempt_at LIMIT $2 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, upload_id, object_key, attempts, COALESCE(last_error, ''), next_attempt_at, created_at`
+
+	rows, err := r.db.Query(query, fmt.Sprintf("%d milliseconds", lease.Milliseconds()), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deletions []*model.BlobDeletion
+	for rows.Next() {
+		var deletion model.BlobDeletion
+		if err := rows.Scan(&deletion.ID, &deletion.UploadID, &deletion.ObjectKey, &deletion.Attempts, &deletion.LastError, &deletion.NextAttemptAt, &deletion.CreatedAt); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, &deletion)
+	}
+	return deletions, rows.Err()
+}
+
+func (r *PostgreSQLRepository) CompleteBlobDeletion(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM blob_deletions WHERE id = $1`, id)
+	return err
+}
+
+func (r *PostgreSQLRepository) RetryBlobDeletion(id int64, nextAttemptAt time.Time, lastError string) error {
+	_, err := r.db.Exec(`UPDATE blob_deletions SET next_attempt_at = $1, last_error = $2 WHERE id = $3`, nextAttemptAt, lastError, id)
+	return err
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"quickshare/core/model"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPostgreSQLRepository_PurgeUploadObject(t *testing.T) {
+	tests := []struct {
+		name      string
+		mockSetup func(mock sqlmock.Sqlmock)
+		wantErr   error
+	}{
+		{
+			name: "success - row deleted, deletions of the object and its previews and the event queued in one transaction",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM upload_objects WHERE id = \$1 AND deleted_at IS NOT NULL`).
+					WithArgs("test-id-123").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO blob_deletions`).
+					WithArgs("test-id-123", "uploads/test-id-123/document.pdf").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(`WITH previews AS \(DELETE FROM upload_previews WHERE upload_id = \$1 (.+) INSERT INTO blob_deletions`).
+					WithArgs("test-id-123").
+					WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectQuery(`INSERT INTO webhook_events`).
+					WithArgs("evt_1", "upload.purged", "test-id-123", []byte(`{}`)).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(time.Now()))
+				mock.ExpectExec(`INSERT INTO webhook_deliveries`).
+					WithArgs("evt_1", "upload.purged").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "error - upload restored before purge",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM upload_objects`).
+					WithArgs("test-id-123").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			wantErr: sql.ErrNoRows,
+		},
+		{
+			name: "error - outbox insert fails and the delete is rolled back",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(`DELETE FROM upload_objects`).
+					WithArgs("test-id-123").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`INSERT INTO blob_deletions`).
+					WithArgs("test-id-123", "uploads/test-id-123/document.pdf").
+					WillReturnError(errors.New("insert failed"))
+				mock.ExpectRollback()
+			},
+			wantErr: errors.New("insert failed"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			repo := NewPostgreSQLRepository(db)
+			event := &model.WebhookEvent{ID: "evt_1", Type: "upload.purged", UploadID: "test-id-123", Payload: []byte(`{}`)}
+			err = repo.PurgeUploadObject("test-id-123", "uploads/test-id-123/document.pdf", event)
+
+			if tt.wantErr != nil {
+				if err == nil || !contains(err.Error(), tt.wantErr.Error()) {
+					t.Errorf("expected error %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestPostgreSQLRepository_RejectUploadObject(t *testing.T) {
+	fixedTime := time.Date(2024, 11, 18, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		mockSetup func(mock sqlmock.Sqlmock)
+		wantErr   error
+	}{
+		{
+			name: "success - upload rejected and its object queued in one transaction",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE upload_objects SET (.+) WHERE id = \$13 AND status = \$14 AND deleted_at IS NULL RETURNING id, updated_at`).
+					WithArgs("tool.exe", int64(1024), "application/pdf", "uploads/test-id-123/tool.exe", "rejected", fixedTime, nil, nil, nil, nil, nil, nil, "test-id-123", "pending").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}).AddRow("test-id-123", fixedTime))
+				mock.ExpectExec(`INSERT INTO blob_deletions`).
+					WithArgs("test-id-123", "uploads/test-id-123/tool.exe").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "error - confirmed by a concurrent request, nothing is queued",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE upload_objects SET (.+) AND status = \$14`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}))
+				mock.ExpectRollback()
+			},
+			wantErr: sql.ErrNoRows,
+		},
+		{
+			name: "error - outbox insert fails and the rejection is rolled back",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE upload_objects SET (.+) AND status = \$14`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}).AddRow("test-id-123", fixedTime))
+				mock.ExpectExec(`INSERT INTO blob_deletions`).
+					WillReturnError(errors.New("insert failed"))
+				mock.ExpectRollback()
+			},
+			wantErr: errors.New("insert failed"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			repo := NewPostgreSQLRepository(db)
+			uploadObject := &model.UploadObject{FileName: "tool.exe", FileSize: 1024, MimeType: "application/pdf", ObjectKey: "uploads/test-id-123/tool.exe", Status: "rejected", ExpiresAt: fixedTime}
+			_, err = repo.RejectUploadObject("test-id-123", model.UploadStatusPending, uploadObject)
+
+			if tt.wantErr != nil {
+				if err == nil || !contains(err.Error(), tt.wantErr.Error()) {
+					t.Errorf("expected error %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package repository
+
+import "quickshare/core/model"
+
+func (r *PostgreSQLRepository) SavePreview(preview *model.Preview) (*model.Preview, error) {
+	query := `INSERT INTO upload_previews (upload_id, size, object_key, mime_type, width, height, file_size) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (upload_id, size) DO UPDATE SET object_key = EXCLUDED.object_key, mime_type = EXCLUDED.mime_type, width = EXCLUDED.width, height = EXCLUDED.height, file_size = EXCLUDED.file_size, created_at = now()
+		RETURNING created_at`
+	err := r.db.QueryRow(query, preview.UploadID, preview.Size, preview.ObjectKey, preview.MimeType, preview.Width, preview.Height, preview.FileSize).Scan(&preview.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+func (r *PostgreSQLRepository) GetPreview(uploadID string, size string) (*model.Preview, error) {
+	query := `SELECT upload_id, size, object_key, mime_type, width, height, file_size, created_at FROM upload_previews WHERE upload_id = $1 AND size = $2`
+
+	var preview model.Preview
+	err := r.db.QueryRow(query, uploadID, size).Scan(&preview.UploadID, &preview.Size, &preview.ObjectKey, &preview.MimeType, &preview.Width, &preview.Height, &preview.FileSize, &preview.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &preview, nil
+}
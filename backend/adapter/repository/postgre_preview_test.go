@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"quickshare/core/model"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPostgreSQLRepository_SaveAndGetPreview(t *testing.T) {
+	fixedTime := time.Date(2024, 11, 18, 10, 0, 0, 0, time.UTC)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`INSERT INTO upload_previews (.+) ON CONFLICT \(upload_id, size\) DO UPDATE`).
+		WithArgs("test-id-123", "small", "previews/test-id-123/small.jpg", "image/jpeg", 160, 90, int64(4096)).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(fixedTime))
+	mock.ExpectQuery(`SELECT (.+) FROM upload_previews WHERE upload_id = \$1 AND size = \$2`).
+		WithArgs("test-id-123", "small").
+		WillReturnRows(sqlmock.NewRows([]string{"upload_id", "size", "object_key", "mime_type", "width", "height", "file_size", "created_at"}).
+			AddRow("test-id-123", "small", "previews/test-id-123/small.jpg", "image/jpeg", 160, 90, 4096, fixedTime))
+	mock.ExpectQuery(`SELECT (.+) FROM upload_previews`).
+		WithArgs("test-id-123", "large").
+		WillReturnError(sql.ErrNoRows)
+
+	repo := NewPostgreSQLRepository(db)
+	saved, err := repo.SavePreview(&model.Preview{
+		UploadID:  "test-id-123",
+		Size:      "small",
+		ObjectKey: "previews/test-id-123/small.jpg",
+		MimeType:  "image/jpeg",
+		Width:     160,
+		Height:    90,
+		FileSize:  4096,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !saved.CreatedAt.Equal(fixedTime) {
+		t.Errorf("expected created_at %v, got %v", fixedTime, saved.CreatedAt)
+	}
+
+	preview, err := repo.GetPreview("test-id-123", "small")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *preview != *saved {
+		t.Errorf("expected %+v, got %+v", saved, preview)
+	}
+
+	if _, err := repo.GetPreview("test-id-123", "large"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
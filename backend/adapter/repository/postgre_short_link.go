@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"errors"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the SQLSTATE of a duplicate key
+const uniqueViolation = "23505"
+
+func (r *PostgreSQLRepository) CreateShortLink(shortLink *model.ShortLink) (*model.ShortLink, error) {
+	query := `INSERT INTO short_links (id, slug, original_link, upload_id, expires_at) VALUES ($1, $2, $3, $4, $5) RETURNING created_at`
+	err := r.db.QueryRow(query, shortLink.ID, shortLink.Slug, shortLink.OriginalLink, shortLink.UploadID, shortLink.ExpiresAt).Scan(&shortLink.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return nil, repository.ErrSlugTaken
+		}
+		return nil, err
+	}
+	return shortLink, nil
+}
+
+func (r *PostgreSQLRepository) GetShortLinkBySlug(slug string) (*model.ShortLink, error) {
+	query := `SELECT id, slug, original_link, upload_id, created_at, expires_at FROM short_links WHERE slug = $1`
+
+	var shortLink model.ShortLink
+	err := r.db.QueryRow(query, slug).Scan(&shortLink.ID, &shortLink.Slug, &shortLink.OriginalLink, &shortLink.UploadID, &shortLink.CreatedAt, &shortLink.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &shortLink, nil
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"errors"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+func TestPostgreSQLRepository_CreateShortLink(t *testing.T) {
+	fixedTime := time.Date(2024, 11, 18, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		mockSetup func(mock sqlmock.Sqlmock)
+		wantErr   error
+	}{
+		{
+			name: "success - short link created",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`INSERT INTO short_links`).
+					WithArgs("sl_1", "Ab3dEf7h", "/download/test-id-123", "test-id-123", fixedTime).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(fixedTime))
+			},
+		},
+		{
+			name: "error - slug collision",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`INSERT INTO short_links`).
+					WithArgs("sl_1", "Ab3dEf7h", "/download/test-id-123", "test-id-123", fixedTime).
+					WillReturnError(&pq.Error{Code: uniqueViolation})
+			},
+			wantErr: repository.ErrSlugTaken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			repo := NewPostgreSQLRepository(db)
+			_, err = repo.CreateShortLink(&model.ShortLink{
+				ID:           "sl_1",
+				Slug:         "Ab3dEf7h",
+				OriginalLink: "/download/test-id-123",
+				UploadID:     "test-id-123",
+				ExpiresAt:    fixedTime,
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"errors"
 	"quickshare/core/model"
+	"quickshare/core/repository"
+	"reflect"
 	"testing"
 	"time"
 
@@ -32,9 +34,9 @@ func TestPostgreSQLRepository_CreateUploadObject(t *testing.T) {
 				ExpiresAt: fixedTime,
 			},
 			mockSetup: func(mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"id"}).AddRow("test-id-123")
+				rows := sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("test-id-123", fixedTime, fixedTime)
 				mock.ExpectQuery(`INSERT INTO upload_objects`).
-					WithArgs("test-id-123", "document.pdf", int64(1024), "application/pdf", "uploads/document.pdf", "pending", fixedTime).
+					WithArgs("test-id-123", "document.pdf", int64(1024), "application/pdf", "uploads/document.pdf", "pending", fixedTime, nil, nil, nil, "file", nil).
 					WillReturnRows(rows)
 			},
 			wantErr: false,
@@ -52,7 +54,7 @@ func TestPostgreSQLRepository_CreateUploadObject(t *testing.T) {
 			},
 			mockSetup: func(mock sqlmock.Sqlmock) {
 				mock.ExpectQuery(`INSERT INTO upload_objects`).
-					WithArgs("duplicate-id", "test.txt", int64(512), "text/plain", "uploads/test.txt", "pending", fixedTime).
+					WithArgs("duplicate-id", "test.txt", int64(512), "text/plain", "uploads/test.txt", "pending", fixedTime, nil, nil, nil, "file", nil).
 					WillReturnError(errors.New("duplicate key value violates unique constraint"))
 			},
 			wantErr:     true,
@@ -71,7 +73,7 @@ func TestPostgreSQLRepository_CreateUploadObject(t *testing.T) {
 			},
 			mockSetup: func(mock sqlmock.Sqlmock) {
 				mock.ExpectQuery(`INSERT INTO upload_objects`).
-					WithArgs("test-id-456", "image.jpg", int64(2048), "image/jpeg", "uploads/image.jpg", "pending", fixedTime).
+					WithArgs("test-id-456", "image.jpg", int64(2048), "image/jpeg", "uploads/image.jpg", "pending", fixedTime, nil, nil, nil, "file", nil).
 					WillReturnError(errors.New("connection refused"))
 			},
 			wantErr:     true,
@@ -135,9 +137,9 @@ func TestPostgreSQLRepository_GetUploadObject(t *testing.T) {
 			name:    "success - get upload object",
 			inputID: "test-id-123",
 			mockSetup: func(mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"id", "file_name", "file_size", "mime_type", "object_key", "status", "expires_at"}).
-					AddRow("test-id-123", "document.pdf", 1024, "application/pdf", "uploads/document.pdf", "active", fixedTime)
-				mock.ExpectQuery(`SELECT id, file_name, file_size, mime_type, object_key, status, expires_at FROM upload_objects WHERE id`).
+				rows := sqlmock.NewRows(uploadObjectRowColumns).
+					AddRow("test-id-123", "document.pdf", 1024, "application/pdf", "uploads/document.pdf", "active", fixedTime, "owner-1", fixedTime, fixedTime, fixedTime, nil, "application/pdf", "", []byte(`{"algorithm":"XChaCha20-Poly1305","chunk_size":65536}`), []byte(`{"mode":"sse-kms","key_id":"alias/quickshare"}`), "file", "", "ready")
+				mock.ExpectQuery(`SELECT (.+) FROM upload_objects WHERE id`).
 					WithArgs("test-id-123").
 					WillReturnRows(rows)
 			},
@@ -149,6 +151,13 @@ func TestPostgreSQLRepository_GetUploadObject(t *testing.T) {
 				ObjectKey: "uploads/document.pdf",
 				Status:    "active",
 				ExpiresAt: fixedTime,
+				OwnerID:   "owner-1",
+				CreatedAt: fixedTime,
+
+				DetectedMimeType:  "application/pdf",
+				Encryption:        &model.Encryption{Algorithm: "XChaCha20-Poly1305", ChunkSize: 65536},
+				StorageEncryption: &model.StorageEncryption{Mode: "sse-kms", KeyID: "alias/quickshare"},
+				PreviewStatus:     "ready",
 			},
 			wantErr: false,
 		},
@@ -156,7 +165,7 @@ func TestPostgreSQLRepository_GetUploadObject(t *testing.T) {
 			name:    "error - not found",
 			inputID: "non-existent-id",
 			mockSetup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery(`SELECT id, file_name, file_size, mime_type, object_key, status, expires_at FROM upload_objects WHERE id`).
+				mock.ExpectQuery(`SELECT (.+) FROM upload_objects WHERE id`).
 					WithArgs("non-existent-id").
 					WillReturnError(sql.ErrNoRows)
 			},
@@ -167,7 +176,7 @@ func TestPostgreSQLRepository_GetUploadObject(t *testing.T) {
 			name:    "error - database error",
 			inputID: "error-id",
 			mockSetup: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery(`SELECT id, file_name, file_size, mime_type, object_key, status, expires_at FROM upload_objects WHERE id`).
+				mock.ExpectQuery(`SELECT (.+) FROM upload_objects WHERE id`).
 					WithArgs("error-id").
 					WillReturnError(errors.New("database connection lost"))
 			},
@@ -215,6 +224,18 @@ func TestPostgreSQLRepository_GetUploadObject(t *testing.T) {
 			if result.FileSize != tt.want.FileSize {
 				t.Errorf("expected FileSize %d, got %d", tt.want.FileSize, result.FileSize)
 			}
+			if result.OwnerID != tt.want.OwnerID {
+				t.Errorf("expected OwnerID %q, got %q", tt.want.OwnerID, result.OwnerID)
+			}
+			if result.DetectedMimeType != tt.want.DetectedMimeType {
+				t.Errorf("expected DetectedMimeType %q, got %q", tt.want.DetectedMimeType, result.DetectedMimeType)
+			}
+			if !reflect.DeepEqual(result.Encryption, tt.want.Encryption) {
+				t.Errorf("expected Encryption %+v, got %+v", tt.want.Encryption, result.Encryption)
+			}
+			if !reflect.DeepEqual(result.StorageEncryption, tt.want.StorageEncryption) {
+				t.Errorf("expected StorageEncryption %+v, got %+v", tt.want.StorageEncryption, result.StorageEncryption)
+			}
 
 			if err := mock.ExpectationsWereMet(); err != nil {
 				t.Errorf("unfulfilled expectations: %v", err)
@@ -243,13 +264,35 @@ func TestPostgreSQLRepository_UpdateUploadObject(t *testing.T) {
 				FileSize:  2048,
 				MimeType:  "application/pdf",
 				ObjectKey: "uploads/updated-document.pdf",
-				Status:    "completed",
-				ExpiresAt: fixedTime,
+				Status:      "completed",
+				ExpiresAt:   fixedTime,
+				ConfirmedAt: &fixedTime,
 			},
 			mockSetup: func(mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"id"}).AddRow("test-id-123")
-				mock.ExpectQuery(`UPDATE upload_objects SET`).
-					WithArgs("updated-document.pdf", int64(2048), "application/pdf", "uploads/updated-document.pdf", "completed", fixedTime, "test-id-123").
+				rows := sqlmock.NewRows([]string{"id", "updated_at"}).AddRow("test-id-123", fixedTime)
+				mock.ExpectQuery(`UPDATE upload_objects SET (.+) updated_at = now\(\) WHERE id`).
+					WithArgs("updated-document.pdf", int64(2048), "application/pdf", "uploads/updated-document.pdf", "completed", fixedTime, fixedTime, nil, nil, nil, nil, nil, "test-id-123").
+					WillReturnRows(rows)
+			},
+			wantErr: false,
+		},
+		{
+			name:    "success - client-side encryption written",
+			inputID: "test-id-123",
+			input: &model.UploadObject{
+				ID:         "test-id-123",
+				FileName:   "secret.bin",
+				FileSize:   4096,
+				MimeType:   "application/octet-stream",
+				ObjectKey:  "uploads/secret.bin",
+				Status:     "completed",
+				ExpiresAt:  fixedTime,
+				Encryption: &model.Encryption{Algorithm: "XChaCha20-Poly1305", ChunkSize: 65536},
+			},
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "updated_at"}).AddRow("test-id-123", fixedTime)
+				mock.ExpectQuery(`UPDATE upload_objects SET (.+) encryption = \$12, updated_at = now\(\) WHERE id = \$13`).
+					WithArgs("secret.bin", int64(4096), "application/octet-stream", "uploads/secret.bin", "completed", fixedTime, nil, nil, nil, nil, nil, []byte(`{"algorithm":"XChaCha20-Poly1305","chunk_size":65536}`), "test-id-123").
 					WillReturnRows(rows)
 			},
 			wantErr: false,
@@ -267,7 +310,7 @@ func TestPostgreSQLRepository_UpdateUploadObject(t *testing.T) {
 			},
 			mockSetup: func(mock sqlmock.Sqlmock) {
 				mock.ExpectQuery(`UPDATE upload_objects SET`).
-					WithArgs("test.txt", int64(512), "text/plain", "uploads/test.txt", "pending", fixedTime, "non-existent-id").
+					WithArgs("test.txt", int64(512), "text/plain", "uploads/test.txt", "pending", fixedTime, nil, nil, nil, nil, nil, nil, "non-existent-id").
 					WillReturnError(sql.ErrNoRows)
 			},
 			wantErr:     true,
@@ -286,7 +329,7 @@ func TestPostgreSQLRepository_UpdateUploadObject(t *testing.T) {
 			},
 			mockSetup: func(mock sqlmock.Sqlmock) {
 				mock.ExpectQuery(`UPDATE upload_objects SET`).
-					WithArgs("test.txt", int64(512), "text/plain", "uploads/test.txt", "pending", fixedTime, "error-id").
+					WithArgs("test.txt", int64(512), "text/plain", "uploads/test.txt", "pending", fixedTime, nil, nil, nil, nil, nil, nil, "error-id").
 					WillReturnError(errors.New("update failed"))
 			},
 			wantErr:     true,
@@ -335,6 +378,102 @@ func TestPostgreSQLRepository_UpdateUploadObject(t *testing.T) {
 	}
 }
 
+func TestPostgreSQLRepository_TransitionUploadObject(t *testing.T) {
+	fixedTime := time.Date(2024, 11, 18, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		event      *model.WebhookEvent
+		encryption *model.Encryption
+		mockSetup  func(mock sqlmock.Sqlmock)
+		wantErr    error
+	}{
+		{
+			name:  "success - pending upload completed with its event",
+			event: &model.WebhookEvent{ID: "evt_1", Type: "upload.completed", UploadID: "test-id-123", Payload: []byte(`{}`)},
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE upload_objects SET (.+) WHERE id = \$13 AND status = \$14 AND deleted_at IS NULL RETURNING id, updated_at`).
+					WithArgs("document.pdf", int64(1024), "application/pdf", "uploads/test-id-123/document.pdf", "completed", fixedTime, nil, nil, nil, nil, nil, nil, "test-id-123", "pending").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}).AddRow("test-id-123", fixedTime))
+				mock.ExpectQuery(`INSERT INTO webhook_events`).
+					WithArgs("evt_1", "upload.completed", "test-id-123", []byte(`{}`)).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(fixedTime))
+				mock.ExpectExec(`INSERT INTO webhook_deliveries`).
+					WithArgs("evt_1", "upload.completed").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:       "success - client-side encryption kept",
+			encryption: &model.Encryption{Algorithm: "XChaCha20-Poly1305", ChunkSize: 65536},
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE upload_objects SET (.+) AND status = \$14`).
+					WithArgs("document.pdf", int64(1024), "application/pdf", "uploads/test-id-123/document.pdf", "completed", fixedTime, nil, nil, nil, nil, nil, []byte(`{"algorithm":"XChaCha20-Poly1305","chunk_size":65536}`), "test-id-123", "pending").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}).AddRow("test-id-123", fixedTime))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			// checkCiphertext drops the metadata of content without the header, the column must be cleared
+			name: "success - fake encryption metadata cleared",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE upload_objects SET (.+) encryption = \$12, (.+) AND status = \$14`).
+					WithArgs("document.pdf", int64(1024), "application/pdf", "uploads/test-id-123/document.pdf", "completed", fixedTime, nil, nil, nil, nil, nil, nil, "test-id-123", "pending").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}).AddRow("test-id-123", fixedTime))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "success - no event",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE upload_objects SET (.+) AND status = \$14`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}).AddRow("test-id-123", fixedTime))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:  "error - confirmed by a concurrent request, nothing is saved",
+			event: &model.WebhookEvent{ID: "evt_1", Type: "upload.completed", UploadID: "test-id-123", Payload: []byte(`{}`)},
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE upload_objects SET (.+) AND status = \$14`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}))
+				mock.ExpectRollback()
+			},
+			wantErr: sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			repo := NewPostgreSQLRepository(db)
+			uploadObject := &model.UploadObject{FileName: "document.pdf", FileSize: 1024, MimeType: "application/pdf", ObjectKey: "uploads/test-id-123/document.pdf", Status: "completed", ExpiresAt: fixedTime, Encryption: tt.encryption}
+			_, err = repo.TransitionUploadObject("test-id-123", model.UploadStatusPending, uploadObject, tt.event)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
 func TestPostgreSQLRepository_DeleteUploadObject(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -424,6 +563,257 @@ func TestPostgreSQLRepository_DeleteUploadObject(t *testing.T) {
 	}
 }
 
+func TestPostgreSQLRepository_ListUploadObjects(t *testing.T) {
+	newer := time.Date(2024, 11, 18, 12, 0, 0, 0, time.UTC)
+	older := time.Date(2024, 11, 18, 10, 0, 0, 0, time.UTC)
+	minSize := int64(100)
+
+	tests := []struct {
+		name           string
+		filter         repository.UploadObjectFilter
+		cursor         string
+		limit          int
+		mockSetup      func(mock sqlmock.Sqlmock)
+		wantIDs        []string
+		wantNextCursor bool
+		wantErr        error
+	}{
+		{
+			name:   "success - filters and next page",
+			filter: repository.UploadObjectFilter{OwnerID: "owner-1", Status: "completed", MinSize: &minSize, FileNamePrefix: "re_port"},
+			limit:  1,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(uploadObjectRowColumns).
+					AddRow("id-2", "re_port-2.pdf", 200, "application/pdf", "uploads/id-2/re_port-2.pdf", "completed", newer, "owner-1", newer, newer, newer, nil, "", "", nil, nil, "file", "", "").
+					AddRow("id-1", "re_port-1.pdf", 150, "application/pdf", "uploads/id-1/re_port-1.pdf", "completed", older, "owner-1", older, older, older, nil, "", "", nil, nil, "file", "", "")
+				mock.ExpectQuery(`SELECT (.+) FROM upload_objects WHERE deleted_at IS NULL AND owner_id = \$1 AND status = \$2 AND file_size >= \$3 AND file_name LIKE \$4 (.+) ORDER BY created_at DESC, id DESC LIMIT \$5`).
+					WithArgs("owner-1", "completed", int64(100), `re\_port%`, 2).
+					WillReturnRows(rows)
+			},
+			wantIDs:        []string{"id-2"},
+			wantNextCursor: true,
+		},
+		{
+			name:   "success - last page from cursor",
+			cursor: encodeCursor(cursorPosition{CreatedAt: newer, ID: "id-2"}),
+			limit:  10,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(uploadObjectRowColumns).
+					AddRow("id-1", "report-1.pdf", 150, "application/pdf", "uploads/id-1/report-1.pdf", "completed", older, "", older, older, nil, nil, "", "", nil, nil, "file", "", "")
+				mock.ExpectQuery(`SELECT (.+) FROM upload_objects WHERE deleted_at IS NULL AND \(created_at, id\) < \(\$1, \$2\) ORDER BY created_at DESC, id DESC LIMIT \$3`).
+					WithArgs(newer, "id-2", 11).
+					WillReturnRows(rows)
+			},
+			wantIDs: []string{"id-1"},
+		},
+		{
+			name:   "success - trash older than grace period",
+			filter: repository.UploadObjectFilter{Trashed: true, DeletedBefore: older},
+			limit:  10,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(uploadObjectRowColumns).
+					AddRow("id-0", "old.pdf", 150, "application/pdf", "uploads/id-0/old.pdf", "completed", older, "", older, older, nil, older.Add(-time.Hour), "", "", nil, nil, "file", "", "")
+				mock.ExpectQuery(`SELECT (.+) FROM upload_objects WHERE deleted_at IS NOT NULL AND deleted_at < \$1 ORDER BY created_at DESC, id DESC LIMIT \$2`).
+					WithArgs(older, 11).
+					WillReturnRows(rows)
+			},
+			wantIDs: []string{"id-0"},
+		},
+		{
+			name:      "error - invalid cursor",
+			cursor:    "not-a-cursor",
+			limit:     10,
+			mockSetup: func(mock sqlmock.Sqlmock) {},
+			wantErr:   repository.ErrInvalidCursor,
+		},
+		{
+			name:  "error - database error",
+			limit: 10,
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT (.+) FROM upload_objects WHERE deleted_at IS NULL ORDER BY`).
+					WithArgs(11).
+					WillReturnError(errors.New("query failed"))
+			},
+			wantErr: errors.New("query failed"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			repo := NewPostgreSQLRepository(db)
+			result, nextCursor, err := repo.ListUploadObjects(tt.filter, tt.cursor, tt.limit)
+
+			if tt.wantErr != nil {
+				if err == nil || !contains(err.Error(), tt.wantErr.Error()) {
+					t.Errorf("expected error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+
+			if len(result) != len(tt.wantIDs) {
+				t.Fatalf("expected %d uploads, got %d", len(tt.wantIDs), len(result))
+			}
+			for i, id := range tt.wantIDs {
+				if result[i].ID != id {
+					t.Errorf("expected ID %q at %d, got %q", id, i, result[i].ID)
+				}
+			}
+			if (nextCursor != "") != tt.wantNextCursor {
+				t.Errorf("expected next cursor %v, got %q", tt.wantNextCursor, nextCursor)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestPostgreSQLRepository_FailStalePendingUploads(t *testing.T) {
+	cutoff := time.Date(2024, 11, 18, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		mockSetup   func(mock sqlmock.Sqlmock)
+		want        int64
+		wantErr     bool
+		errContains string
+	}{
+		{
+			name: "success - stale uploads failed",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE upload_objects SET status = \$1, updated_at = now\(\) WHERE status = \$2 AND created_at < \$3`).
+					WithArgs("failed", "pending", cutoff).
+					WillReturnResult(sqlmock.NewResult(0, 3))
+			},
+			want: 3,
+		},
+		{
+			name: "error - database error",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(`UPDATE upload_objects SET status`).
+					WithArgs("failed", "pending", cutoff).
+					WillReturnError(errors.New("update failed"))
+			},
+			wantErr:     true,
+			errContains: "update failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			repo := NewPostgreSQLRepository(db)
+			got, err := repo.FailStalePendingUploads(cutoff)
+
+			if tt.wantErr {
+				if err == nil || !contains(err.Error(), tt.errContains) {
+					t.Errorf("expected error containing %q, got %v", tt.errContains, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("expected %d rows, got %d", tt.want, got)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestPostgreSQLRepository_FindUploadObjectsByObjectKeys(t *testing.T) {
+	fixedTime := time.Date(2024, 11, 18, 10, 0, 0, 0, time.UTC)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows(uploadObjectRowColumns).
+		AddRow("id-1", "a.pdf", 10, "application/pdf", "uploads/id-1/a.pdf", "completed", fixedTime, "", fixedTime, fixedTime, nil, fixedTime, "", "", nil, nil, "file", "", "")
+	mock.ExpectQuery(`SELECT (.+) FROM upload_objects WHERE object_key = ANY\(\$1\)`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(rows)
+
+	repo := NewPostgreSQLRepository(db)
+	result, err := repo.FindUploadObjectsByObjectKeys([]string{"uploads/id-1/a.pdf", "uploads/orphan/b.pdf"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result) != 1 || result[0].ID != "id-1" {
+		t.Fatalf("expected only id-1, got %v", result)
+	}
+	if result[0].DeletedAt == nil {
+		t.Errorf("expected trashed upload to be returned with its deleted_at")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestPostgreSQLRepository_ListBundleMembers(t *testing.T) {
+	fixedTime := time.Date(2024, 11, 18, 10, 0, 0, 0, time.UTC)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows(uploadObjectRowColumns).
+		AddRow("m-1", "docs/a.pdf", 10, "application/pdf", "uploads/m-1/docs/a.pdf", "completed", fixedTime, "", fixedTime, fixedTime, fixedTime, nil, "application/pdf", "", nil, nil, "file", "b-1", "").
+		AddRow("m-2", "docs/b.txt", 20, "text/plain", "uploads/m-2/docs/b.txt", "pending", fixedTime, "", fixedTime, fixedTime, nil, nil, "", "", nil, nil, "file", "b-1", "")
+	mock.ExpectQuery(`SELECT (.+) FROM upload_objects WHERE bundle_id = \$1 ORDER BY file_name`).
+		WithArgs("b-1").
+		WillReturnRows(rows)
+
+	repo := NewPostgreSQLRepository(db)
+	result, err := repo.ListBundleMembers("b-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(result) != 2 || result[0].FileName != "docs/a.pdf" || result[1].BundleID != "b-1" {
+		t.Fatalf("expected both members of b-1, got %v", result)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+var uploadObjectRowColumns = []string{"id", "file_name", "file_size", "mime_type", "object_key", "status", "expires_at", "owner_id", "created_at", "updated_at", "confirmed_at", "deleted_at", "detected_mime_type", "quarantine_reason", "encryption", "storage_encryption", "kind", "bundle_id", "preview_status"}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(substr) == 0 || 
 		(len(s) > 0 && len(substr) > 0 && stringContains(s, substr)))
@@ -436,4 +826,25 @@ func stringContains(s, substr string) bool {
 		}
 	}
 	return false
-}
\ No newline at end of file
+}
+func TestPostgreSQLRepository_RecordScanFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`UPDATE upload_objects SET scan_attempts = scan_attempts \+ 1, last_error = \$1 WHERE id = \$2 RETURNING scan_attempts`).
+		WithArgs("connection refused", "test-id-123").
+		WillReturnRows(sqlmock.NewRows([]string{"scan_attempts"}).AddRow(2))
+
+	repo := NewPostgreSQLRepository(db)
+	attempts, err := repo.RecordScanFailure("test-id-123", "connection refused")
+	if err != nil || attempts != 2 {
+		t.Errorf("expected 2 attempts, got %d and %v", attempts, err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"quickshare/core/model"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const webhookDeliveryColumns = `d.id, d.webhook_id, d.event_id, e.type, d.status, d.attempts, COALESCE(d.last_status_code, 0), COALESCE(d.last_error, ''), d.next_attempt_at, d.delivered_at, d.created_at`
+
+func (r *PostgreSQLRepository) PublishEvent(event *model.WebhookEvent) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertEvent(tx, event); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateUploadObjectAndPublish creates the upload and stores the event in one
+// transaction, the event is only delivered if the upload exists
+func (r *PostgreSQLRepository) CreateUploadObjectAndPublish(uploadObject *model.UploadObject, event *model.WebhookEvent) (*model.UploadObject, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created, err := createUploadObject(tx, uploadObject)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertEvent(tx, event); err != nil {
+		return nil, err
+	}
+	return created, tx.Commit()
+}
+
+func (r *PostgreSQLRepository) CreateUploadObjectsAndPublish(uploadObjects []*model.UploadObject, events []*model.WebhookEvent) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, uploadObject := range uploadObjects {
+		if _, err := createUploadObject(tx, uploadObject); err != nil {
+			return err
+		}
+	}
+	for _, event := range events {
+		if err := insertEvent(tx, event); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UpdateUploadObjectAndPublish saves the upload and stores the event in one
+// transaction, so no change goes unannounced and no event announces a lost one
+func (r *PostgreSQLRepository) UpdateUploadObjectAndPublish(id string, uploadObject *model.UploadObject, event *model.WebhookEvent) (*model.UploadObject, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	updated, err := updateUploadObject(tx, id, uploadObject, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := insertEvent(tx, event); err != nil {
+		return nil, err
+	}
+	return updated, tx.Commit()
+}
+
+// insertEvent stores the event and one pending delivery per subscribed webhook
+func insertEvent(tx *sql.Tx, event *model.WebhookEvent) error {
+	err := tx.QueryRow(`INSERT INTO webhook_events (id, type, upload_id, payload) VALUES ($1, $2, $3, $4) RETURNING created_at`,
+		event.ID, event.Type, event.UploadID, []byte(event.Payload)).Scan(&event.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO webhook_deliveries (webhook_id, event_id)
+		SELECT id, $1 FROM webhooks WHERE active AND (cardinality(events) = 0 OR $2 = ANY(events))`, event.ID, event.Type)
+	return err
+}
+
+func (r *PostgreSQLRepository) CreateWebhook(webhook *model.Webhook) (*model.Webhook, error) {
+	query := `INSERT INTO webhooks (id, url, secret, events, active) VALUES ($1, $2, $3, $4, $5) RETURNING created_at`
+	err := r.db.QueryRow(query, webhook.ID, webhook.URL, webhook.Secret, pq.Array(webhook.Events), webhook.Active).Scan(&webhook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (r *PostgreSQLRepository) GetWebhook(id string) (*model.Webhook, error) {
+	query := `SELECT id, url, events, active, created_at FROM webhooks WHERE id = $1`
+
+	var webhook model.Webhook
+	err := r.db.QueryRow(query, id).Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events), &webhook.Active, &webhook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (r *PostgreSQLRepository) ListWebhooks() ([]*model.Webhook, error) {
+	rows, err := r.db.Query(`SELECT id, url, events, active, created_at FROM webhooks ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*model.Webhook{}
+	for rows.Next() {
+		var webhook model.Webhook
+		if err := rows.Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events), &webhook.Active, &webhook.CreatedAt); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func (r *PostgreSQLRepository) DeleteWebhook(id string) error {
+	result, err := r.db.Exec(`DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *PostgreSQLRepository) ListWebhookDeliveries(webhookID string, status string, limit int) ([]*model.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries d JOIN webhook_events e ON e.id = d.event_id
+		WHERE d.webhook_id = $1 AND ($2 = '' OR d.status = $2) ORDER BY d.id DESC LIMIT $3`
+
+	rows, err := r.db.Query(query, webhookID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*model.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *PostgreSQLRepository) RedeliverWebhookDelivery(id int64) (*model.WebhookDelivery, error) {
+	query := `WITH d AS (
+			UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt_at = now(), last_error = NULL
+			WHERE id = $2 RETURNING *
+		)
+		SELECT ` + webhookDeliveryColumns + ` FROM d JOIN webhook_events e ON e.id = d.event_id`
+
+	return scanWebhookDelivery(r.db.QueryRow(query, model.DeliveryStatusPending, id))
+}
+
+func (r *PostgreSQLRepository) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	query := `WITH d AS (
+			UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = now() + $1::interval
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries WHERE status = $2 AND next_attempt_at <= now()
+				ORDER BY next_attempt_at LIMIT $3 FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT ` + webhookDeliveryColumns + `, w.url, w.secret, e.payload
+		FROM d JOIN webhook_events e ON e.id = d.event_id JOIN webhooks w ON w.id = d.webhook_id`
+
+	rows, err := r.db.Query(query, fmt.Sprintf("%d milliseconds", lease.Milliseconds()), model.DeliveryStatusPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*model.WebhookDelivery
+	for rows.Next() {
+		var delivery model.WebhookDelivery
+		err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Status, &delivery.Attempts,
+			&delivery.LastStatusCode, &delivery.LastError, &delivery.NextAttemptAt, &delivery.DeliveredAt, &delivery.CreatedAt,
+			&delivery.WebhookURL, &delivery.WebhookSecret, &delivery.Payload)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func (r *PostgreSQLRepository) MarkWebhookDeliveryDelivered(id int64, statusCode int) error {
+	query := `UPDATE webhook_deliveries SET status = $1, last_status_code = $2, last_error = NULL, delivered_at = now() WHERE id = $3`
+	_, err := r.db.Exec(query, model.DeliveryStatusDelivered, statusCode, id)
+	return err
+}
+
+func (r *PostgreSQLRepository) MarkWebhookDeliveryFailed(id int64, status string, nextAttemptAt time.Time, statusCode int, lastError string) error {
+	query := `UPDATE webhook_deliveries SET status = $1, next_attempt_at = $2, last_status_code = NULLIF($3, 0), last_error = $4 WHERE id = $5`
+	_, err := r.db.Exec(query, status, nextAttemptAt, statusCode, lastError, id)
+	return err
+}
+
+func scanWebhookDelivery(row rowScanner) (*model.WebhookDelivery, error) {
+	var delivery model.WebhookDelivery
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Status, &delivery.Attempts,
+		&delivery.LastStatusCode, &delivery.LastError, &delivery.NextAttemptAt, &delivery.DeliveredAt, &delivery.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
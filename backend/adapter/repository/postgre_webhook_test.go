@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"errors"
+	"quickshare/core/model"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPostgreSQLRepository_PublishEvent(t *testing.T) {
+	fixedTime := time.Date(2024, 11, 18, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		mockSetup func(mock sqlmock.Sqlmock)
+		wantErr   bool
+	}{
+		{
+			name: "success - event stored and fanned out to subscribed webhooks",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO webhook_events`).
+					WithArgs("evt_1", "upload.completed", "test-id-123", []byte(`{}`)).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(fixedTime))
+				mock.ExpectExec(`INSERT INTO webhook_deliveries \(webhook_id, event_id\)\s+SELECT id, \$1 FROM webhooks WHERE active`).
+					WithArgs("evt_1", "upload.completed").
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "error - fan out fails and the event is rolled back",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO webhook_events`).
+					WithArgs("evt_1", "upload.completed", "test-id-123", []byte(`{}`)).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(fixedTime))
+				mock.ExpectExec(`INSERT INTO webhook_deliveries`).
+					WithArgs("evt_1", "upload.completed").
+					WillReturnError(errors.New("insert failed"))
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			repo := NewPostgreSQLRepository(db)
+			err = repo.PublishEvent(&model.WebhookEvent{ID: "evt_1", Type: "upload.completed", UploadID: "test-id-123", Payload: []byte(`{}`)})
+
+			if tt.wantErr != (err != nil) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestPostgreSQLRepository_UpdateUploadObjectAndPublish(t *testing.T) {
+	fixedTime := time.Date(2024, 11, 18, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		mockSetup func(mock sqlmock.Sqlmock)
+		wantErr   bool
+	}{
+		{
+			name: "success - upload saved and event stored in one transaction",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE upload_objects SET`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}).AddRow("test-id-123", fixedTime))
+				mock.ExpectQuery(`INSERT INTO webhook_events`).
+					WithArgs("evt_1", "upload.completed", "test-id-123", []byte(`{}`)).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(fixedTime))
+				mock.ExpectExec(`INSERT INTO webhook_deliveries`).
+					WithArgs("evt_1", "upload.completed").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "error - event insert fails and the update is rolled back",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`UPDATE upload_objects SET`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "updated_at"}).AddRow("test-id-123", fixedTime))
+				mock.ExpectQuery(`INSERT INTO webhook_events`).
+					WithArgs("evt_1", "upload.completed", "test-id-123", []byte(`{}`)).
+					WillReturnError(errors.New("insert failed"))
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			repo := NewPostgreSQLRepository(db)
+			uploadObject := &model.UploadObject{ID: "test-id-123", Status: model.UploadStatusCompleted}
+			event := &model.WebhookEvent{ID: "evt_1", Type: "upload.completed", UploadID: "test-id-123", Payload: []byte(`{}`)}
+			_, err = repo.UpdateUploadObjectAndPublish("test-id-123", uploadObject, event)
+
+			if tt.wantErr != (err != nil) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestPostgreSQLRepository_CreateUploadObjectsAndPublish(t *testing.T) {
+	fixedTime := time.Date(2024, 11, 18, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		mockSetup func(mock sqlmock.Sqlmock)
+		wantErr   bool
+	}{
+		{
+			name: "success - bundle, member and their events stored in one transaction",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO upload_objects`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("bundle-123", fixedTime, fixedTime))
+				mock.ExpectQuery(`INSERT INTO upload_objects`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("member-123", fixedTime, fixedTime))
+				for _, id := range []string{"evt_1", "evt_2"} {
+					mock.ExpectQuery(`INSERT INTO webhook_events`).
+						WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(fixedTime))
+					mock.ExpectExec(`INSERT INTO webhook_deliveries`).
+						WithArgs(id, "upload.initiated").
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "error - member insert fails and the bundle is rolled back",
+			mockSetup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(`INSERT INTO upload_objects`).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).AddRow("bundle-123", fixedTime, fixedTime))
+				mock.ExpectQuery(`INSERT INTO upload_objects`).
+					WillReturnError(errors.New("insert failed"))
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			tt.mockSetup(mock)
+
+			repo := NewPostgreSQLRepository(db)
+			uploadObjects := []*model.UploadObject{
+				{ID: "bundle-123", Kind: model.UploadKindBundle, ObjectKey: "bundles/bundle-123", Status: model.UploadStatusPending},
+				{ID: "member-123", BundleID: "bundle-123", ObjectKey: "uploads/member-123/a.txt", Status: model.UploadStatusPending},
+			}
+			events := []*model.WebhookEvent{
+				{ID: "evt_1", Type: "upload.initiated", UploadID: "bundle-123", Payload: []byte(`{}`)},
+				{ID: "evt_2", Type: "upload.initiated", UploadID: "member-123", Payload: []byte(`{}`)},
+			}
+			err = repo.CreateUploadObjectsAndPublish(uploadObjects, events)
+
+			if tt.wantErr != (err != nil) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
@@ -1,83 +1,309 @@
 package repository
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/url"
+	"strings"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+	web "quickshare/pkg"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
 )
 
+const (
+	CredentialSourceDefault     = "default"
+	CredentialSourceStatic      = "static"
+	CredentialSourceProfile     = "profile"
+	CredentialSourceWebIdentity = "web_identity"
+	CredentialSourceAssumeRole  = "assume_role"
+
+	s3RequestTimeout = 10 * time.Second
+)
+
+type S3BlobStorageConfig struct {
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// CredentialSource is one of the CredentialSource* constants, empty picks static when keys are set and default otherwise
+	CredentialSource     string
+	Profile              string
+	RoleARN              string
+	ExternalID           string
+	RoleSessionName      string
+	WebIdentityTokenFile string
+
+	// Endpoint points the client to an S3-compatible server (MinIO, Ceph, LocalStack...)
+	Endpoint string
+	// PresignEndpoint is used instead of Endpoint for presigned URLs, when clients reach the storage on another host
+	PresignEndpoint string
+	ForcePathStyle  bool
+	DisableSSL      bool
+	// PublicBaseURL replaces the bucket URL in the links returned by GetPublicURL (CDN, reverse proxy...)
+	PublicBaseURL string
+
+	// SSEMode is one of the model.StorageEncryption* modes, empty leaves encryption to the bucket default
+	SSEMode     string
+	SSEKMSKeyID string
+	// SSECustomerKey is the master secret the SSE-C key of each object is derived from
+	SSECustomerKey string
+}
 
 type S3BlobStorage struct {
-	s3Client *s3.S3
-	bucket   string
-	region   string
+	s3Client      *s3.Client
+	presignClient *s3.PresignClient
+	bucket        string
+	region        string
+	endpoint      string
+	pathStyle     bool
+	disableSSL    bool
+	publicBaseURL string
+	sse           serverSideEncryption
 }
 
-func NewS3BlobStorage(region, bucket, accessKeyID, secretAccessKey string) (*S3BlobStorage, error) {
-	awsConfig := &aws.Config{
-		Region: aws.String(region),
+func NewS3BlobStorage(cfg S3BlobStorageConfig) (*S3BlobStorage, error) {
+	sse, err := newServerSideEncryption(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	if accessKeyID != "" && secretAccessKey != "" {
-		awsConfig.Credentials = credentials.NewStaticCredentials(accessKeyID, secretAccessKey, "")
+	awsCfg, source, err := loadAWSConfig(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	sess, err := session.NewSession(awsConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create AWS session: %w", err)
+	s3Client := s3.NewFromConfig(awsCfg, s3ClientOptions(cfg.Endpoint, cfg))
+	presignS3Client := s3Client
+	if cfg.PresignEndpoint != "" {
+		presignS3Client = s3.NewFromConfig(awsCfg, s3ClientOptions(cfg.PresignEndpoint, cfg))
 	}
 
-	log.Printf("S3 connection established: region=%s, bucket=%s", region, bucket)
+	log.Printf("S3 connection established: region=%s, bucket=%s, endpoint=%s, credentials=%s, sse=%s", cfg.Region, cfg.Bucket, cfg.Endpoint, source, cfg.SSEMode)
 
 	return &S3BlobStorage{
-		s3Client: s3.New(sess),
-		bucket:   bucket,
-		region:   region,
+		s3Client:      s3Client,
+		presignClient: s3.NewPresignClient(presignS3Client),
+		bucket:        cfg.Bucket,
+		region:        cfg.Region,
+		endpoint:      cfg.Endpoint,
+		pathStyle:     cfg.ForcePathStyle,
+		disableSSL:    cfg.DisableSSL,
+		publicBaseURL: strings.TrimRight(cfg.PublicBaseURL, "/"),
+		sse:           sse,
 	}, nil
 }
 
-func (s *S3BlobStorage) GeneratePresignedUploadURL(objectKey string, expiresIn time.Duration) (string, error){
-	req, _ := s.s3Client.PutObjectRequest(&s3.PutObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key: aws.String(objectKey),
-	})
+// loadAWSConfig resolves the credentials of cfg, it is shared by every AWS client of the app
+func loadAWSConfig(cfg S3BlobStorageConfig) (aws.Config, string, error) {
+	ctx := context.Background()
+
+	source := cfg.CredentialSource
+	if source == "" {
+		source = CredentialSourceDefault
+		if cfg.AccessKeyID != "" && cfg.SecretAccessKey != "" {
+			source = CredentialSourceStatic
+		}
+	}
+
+	loadOptions := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(cfg.Region),
+	}
+	switch source {
+	case CredentialSourceStatic:
+		loadOptions = append(loadOptions, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		))
+	case CredentialSourceProfile:
+		loadOptions = append(loadOptions, awsconfig.WithSharedConfigProfile(cfg.Profile))
+	}
 
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return aws.Config{}, "", fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	// role based sources use whatever the base config resolved to call STS
+	switch source {
+	case CredentialSourceWebIdentity:
+		awsCfg.Credentials = aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(
+			sts.NewFromConfig(awsCfg),
+			cfg.RoleARN,
+			stscreds.IdentityTokenFile(cfg.WebIdentityTokenFile),
+			func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = cfg.RoleSessionName
+			},
+		))
+	case CredentialSourceAssumeRole:
+		awsCfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(
+			sts.NewFromConfig(awsCfg),
+			cfg.RoleARN,
+			func(o *stscreds.AssumeRoleOptions) {
+				o.RoleSessionName = cfg.RoleSessionName
+				if cfg.ExternalID != "" {
+					o.ExternalID = aws.String(cfg.ExternalID)
+				}
+			},
+		))
+	case CredentialSourceDefault, CredentialSourceStatic, CredentialSourceProfile:
+	default:
+		return aws.Config{}, "", fmt.Errorf("unknown credential source %q", source)
+	}
+
+	return awsCfg, source, nil
+}
+
+func s3ClientOptions(endpoint string, cfg S3BlobStorageConfig) func(*s3.Options) {
+	return func(o *s3.Options) {
+		o.UsePathStyle = cfg.ForcePathStyle
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpointURL(endpoint, cfg.DisableSSL).String())
+		}
+	}
+}
+
+// endpointURL accepts both full URLs and bare hosts, the scheme of a bare host follows disableSSL
+func endpointURL(endpoint string, disableSSL bool) *url.URL {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		u = &url.URL{Host: endpoint}
+	}
+	if u.Scheme == "" {
+		u.Scheme = "https"
+		if disableSSL {
+			u.Scheme = "http"
+		}
+	}
+	return u
+}
+
+func (s *S3BlobStorage) GeneratePresignedUploadURL(objectKey string, expiresIn time.Duration, fileName string) (*repository.PresignedRequest, error) {
 	log.Printf("generating presigned URL for object: %s", objectKey)
 
-	urlStr, err := req.Presign(15 * time.Minute)
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectKey),
+	}
+	if fileName != "" {
+		// stored with the object, the public URL serves it under the client's name too
+		input.ContentDisposition = aws.String(web.ContentDisposition("attachment", fileName))
+	}
+	s.sse.applyPut(input)
+
+	req, err := s.presignClient.PresignPutObject(context.Background(), input, s3.WithPresignExpires(expiresIn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate presigned URL: %w", err)
+	}
+
+	log.Printf("presigned URL generated successfully: %s", req.URL)
+
+	return presignedRequest(req), nil
+}
+
+func (s *S3BlobStorage) GeneratePresignedDownloadURL(objectKey string, encryption *model.StorageEncryption, expiresIn time.Duration, fileName string) (*repository.PresignedRequest, error) {
+	sse, err := s.sse.forObject(encryption)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
+		return nil, err
 	}
 
-	log.Printf("presigned URL generated successfully: %s", urlStr)
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectKey),
+	}
+	if fileName != "" {
+		// the key only holds a sanitized copy of the name
+		input.ResponseContentDisposition = aws.String(web.ContentDisposition("attachment", fileName))
+	}
+	sse.applyGet(input)
 
-	return urlStr, nil
+	req, err := s.presignClient.PresignGetObject(context.Background(), input, s3.WithPresignExpires(expiresIn))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate presigned URL: %w", err)
+	}
+	return presignedRequest(req), nil
+}
+
+// presignedRequest keeps the signed headers the client has to send, the SSE ones are never moved to the query string
+func presignedRequest(req *v4.PresignedHTTPRequest) *repository.PresignedRequest {
+	presigned := &repository.PresignedRequest{URL: req.URL}
+	for name, values := range req.SignedHeader {
+		if strings.EqualFold(name, "Host") {
+			continue
+		}
+		if presigned.Headers == nil {
+			presigned.Headers = make(map[string]string)
+		}
+		presigned.Headers[name] = strings.Join(values, ",")
+	}
+	return presigned
+}
+
+func (s *S3BlobStorage) StorageEncryption() *model.StorageEncryption {
+	return s.sse.descriptor()
 }
 
 func (s *S3BlobStorage) GetPublicURL(objectKey string) string {
-	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.region, objectKey)
+	key := escapeObjectKey(objectKey)
+
+	if s.publicBaseURL != "" {
+		return fmt.Sprintf("%s/%s", s.publicBaseURL, key)
+	}
+
+	if s.endpoint == "" {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.bucket, s.region, key)
+	}
+
+	endpoint := endpointURL(s.endpoint, s.disableSSL)
+	if s.pathStyle {
+		return fmt.Sprintf("%s://%s/%s/%s", endpoint.Scheme, endpoint.Host, s.bucket, key)
+	}
+	return fmt.Sprintf("%s://%s.%s/%s", endpoint.Scheme, s.bucket, endpoint.Host, key)
+}
+
+func escapeObjectKey(objectKey string) string {
+	segments := strings.Split(objectKey, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
 }
 
-func (s *S3BlobStorage) ObjectExists(objectKey string) (bool, error) {
-	_, err := s.s3Client.HeadObject(&s3.HeadObjectInput{
+func (s *S3BlobStorage) ObjectExists(objectKey string, encryption *model.StorageEncryption) (bool, error) {
+	sse, err := s.sse.forObject(encryption)
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+
+	input := &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(objectKey),
-	})
+	}
+	sse.applyHead(input)
 
+	_, err = s.s3Client.HeadObject(ctx, input)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case s3.ErrCodeNoSuchKey:
-				return false, nil
-			default:
-				return false, fmt.Errorf("failed to check if object exists: %w", err)
-			}
+		var notFound *types.NotFound
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &notFound) || errors.As(err, &noSuchKey) {
+			return false, nil
 		}
 		return false, fmt.Errorf("failed to check if object exists: %w", err)
 	}
@@ -85,29 +311,121 @@ func (s *S3BlobStorage) ObjectExists(objectKey string) (bool, error) {
 	return true, nil
 }
 
-func (s *S3BlobStorage) GetObjectMetadata(objectKey string) (map[string]string, error) {
-	resp, err := s.s3Client.HeadObject(&s3.HeadObjectInput{
+func (s *S3BlobStorage) GetObjectMetadata(objectKey string, encryption *model.StorageEncryption) (map[string]string, error) {
+	sse, err := s.sse.forObject(encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+
+	input := &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key: aws.String(objectKey),
-	})
+		Key:    aws.String(objectKey),
+	}
+	sse.applyHead(input)
+
+	resp, err := s.s3Client.HeadObject(ctx, input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get object metadata: %w", err)
 	}
 
-	metadata := make(map[string]string)
+	metadata := make(map[string]string, len(resp.Metadata))
 	for k, v := range resp.Metadata {
-		if v != nil {
-			metadata[k] = *v
-		}
+		metadata[k] = v
 	}
 
 	return metadata, nil
 }
 
+func (s *S3BlobStorage) ReadRange(objectKey string, encryption *model.StorageEncryption, offset int64, length int64) ([]byte, error) {
+	sse, err := s.sse.forObject(encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectKey),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	}
+	sse.applyGet(input)
+
+	resp, err := s.s3Client.GetObject(ctx, input)
+	if err != nil {
+		// the range of an empty object (or past its end) is not satisfiable
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRange" {
+			return []byte{}, nil
+		}
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, length))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	return content, nil
+}
+
+// Open has no timeout, the body is read at the pace of the caller
+func (s *S3BlobStorage) Open(objectKey string, encryption *model.StorageEncryption) (io.ReadCloser, error) {
+	sse, err := s.sse.forObject(encryption)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectKey),
+	}
+	sse.applyGet(input)
+
+	resp, err := s.s3Client.GetObject(context.Background(), input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object: %w", err)
+	}
+	return resp.Body, nil
+}
+
+// Put writes the preview objects, with the encryption recorded on their upload
+func (s *S3BlobStorage) Put(objectKey string, encryption *model.StorageEncryption, content []byte, contentType string) error {
+	sse, err := s.sse.forObject(encryption)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(objectKey),
+		Body:          bytes.NewReader(content),
+		ContentLength: aws.Int64(int64(len(content))),
+		ContentType:   aws.String(contentType),
+	}
+	sse.applyPut(input)
+
+	if _, err := s.s3Client.PutObject(ctx, input); err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	return nil
+}
+
+// Delete needs no encryption headers, S3 deletes encrypted objects like any other
 func (s *S3BlobStorage) Delete(objectKey string) error {
-	_, err := s.s3Client.DeleteObject(&s3.DeleteObjectInput{
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+
+	_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key: aws.String(objectKey),
+		Key:    aws.String(objectKey),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to delete object: %w", err)
@@ -115,3 +433,49 @@ func (s *S3BlobStorage) Delete(objectKey string) error {
 	return nil
 }
 
+// CheckBucket does a HEAD on the bucket, the cheapest call that proves credentials and bucket are fine
+func (s *S3BlobStorage) CheckBucket() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+
+	_, err := s.s3Client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reach bucket %s: %w", s.bucket, err)
+	}
+	return nil
+}
+
+func (s *S3BlobStorage) List(prefix string, continuationToken string) ([]repository.BlobObject, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}
+	if continuationToken != "" {
+		input.ContinuationToken = aws.String(continuationToken)
+	}
+
+	resp, err := s.s3Client.ListObjectsV2(ctx, input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	objects := make([]repository.BlobObject, 0, len(resp.Contents))
+	for _, object := range resp.Contents {
+		objects = append(objects, repository.BlobObject{
+			Key:          aws.ToString(object.Key),
+			Size:         aws.ToInt64(object.Size),
+			LastModified: aws.ToTime(object.LastModified),
+		})
+	}
+
+	nextToken := ""
+	if aws.ToBool(resp.IsTruncated) {
+		nextToken = aws.ToString(resp.NextContinuationToken)
+	}
+	return objects, nextToken, nil
+}
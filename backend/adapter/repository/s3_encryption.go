@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"quickshare/core/model"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// MinSSECustomerKeyLength is the shortest master secret accepted for SSE-C
+const MinSSECustomerKeyLength = 32
+
+// serverSideEncryption holds the SSE settings of the bucket, the zero value leaves encryption to the bucket default
+type serverSideEncryption struct {
+	mode     string
+	kmsKeyID string
+	// masterKey derives the SSE-C key of each object, it never reaches S3 itself
+	masterKey []byte
+}
+
+func newServerSideEncryption(cfg S3BlobStorageConfig) (serverSideEncryption, error) {
+	sse := serverSideEncryption{mode: cfg.SSEMode}
+
+	// the master key is kept after a switch to another mode, the SSE-C objects stored until then stay readable
+	if cfg.SSECustomerKey != "" || cfg.SSEMode == model.StorageEncryptionSSEC {
+		if len(cfg.SSECustomerKey) < MinSSECustomerKeyLength {
+			return sse, fmt.Errorf("the SSE-C master key must be at least %d bytes", MinSSECustomerKeyLength)
+		}
+		sse.masterKey = []byte(cfg.SSECustomerKey)
+	}
+
+	switch cfg.SSEMode {
+	case "", model.StorageEncryptionSSES3, model.StorageEncryptionSSEC:
+	case model.StorageEncryptionSSEKMS:
+		sse.kmsKeyID = cfg.SSEKMSKeyID
+	default:
+		return sse, fmt.Errorf("unknown server-side encryption mode %q", cfg.SSEMode)
+	}
+	return sse, nil
+}
+
+// descriptor is what gets recorded on the uploads, the SSE-C master key is only identified by its fingerprint
+func (e serverSideEncryption) descriptor() *model.StorageEncryption {
+	switch e.mode {
+	case "":
+		return nil
+	case model.StorageEncryptionSSES3:
+		return &model.StorageEncryption{Mode: e.mode}
+	case model.StorageEncryptionSSEKMS:
+		return &model.StorageEncryption{Mode: e.mode, KeyID: e.kmsKeyID}
+	default:
+		return &model.StorageEncryption{Mode: e.mode, KeyID: e.masterKeyID()}
+	}
+}
+
+func (e serverSideEncryption) masterKeyID() string {
+	sum := sha256.Sum256(e.masterKey)
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// forObject returns the settings of an object stored with the recorded encryption.
+// The configured mode only applies to new uploads, the objects stored before a
+// change of configuration keep being read (and their previews written) the way
+// they were stored.
+func (e serverSideEncryption) forObject(recorded *model.StorageEncryption) (serverSideEncryption, error) {
+	if recorded == nil {
+		return serverSideEncryption{}, nil
+	}
+
+	switch recorded.Mode {
+	case model.StorageEncryptionSSES3:
+		return serverSideEncryption{mode: recorded.Mode}, nil
+	case model.StorageEncryptionSSEKMS:
+		return serverSideEncryption{mode: recorded.Mode, kmsKeyID: recorded.KeyID}, nil
+	case model.StorageEncryptionSSEC:
+		// only the fingerprint of the master key is recorded, the configured key must be that one
+		if e.masterKey == nil || e.masterKeyID() != recorded.KeyID {
+			return serverSideEncryption{}, fmt.Errorf("the object was stored with the SSE-C master key %s, which is not configured", recorded.KeyID)
+		}
+		return serverSideEncryption{mode: recorded.Mode, masterKey: e.masterKey}, nil
+	}
+	return serverSideEncryption{}, fmt.Errorf("unknown server-side encryption mode %q", recorded.Mode)
+}
+
+// customerKey derives the SSE-C key of an object from the master key and the object key.
+// Object keys embed the upload ID, so every upload gets its own key and no key has to be stored.
+// The object key rather than the upload ID is used because it is what every S3 request
+// carries, previews included, and it never changes: the key of an upload is recorded
+// when it is initiated, a later change of key layout only applies to new uploads.
+func (e serverSideEncryption) customerKey(objectKey string) (key string, keyMD5 string) {
+	mac := hmac.New(sha256.New, e.masterKey)
+	mac.Write([]byte(objectKey))
+	derived := mac.Sum(nil)
+
+	sum := md5.Sum(derived)
+	return base64.StdEncoding.EncodeToString(derived), base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (e serverSideEncryption) applyPut(input *s3.PutObjectInput) {
+	switch e.mode {
+	case model.StorageEncryptionSSES3:
+		input.ServerSideEncryption = types.ServerSideEncryptionAes256
+	case model.StorageEncryptionSSEKMS:
+		input.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		if e.kmsKeyID != "" {
+			input.SSEKMSKeyId = aws.String(e.kmsKeyID)
+		}
+	case model.StorageEncryptionSSEC:
+		key, keyMD5 := e.customerKey(aws.ToString(input.Key))
+		input.SSECustomerAlgorithm = aws.String(string(types.ServerSideEncryptionAes256))
+		input.SSECustomerKey = aws.String(key)
+		input.SSECustomerKeyMD5 = aws.String(keyMD5)
+	}
+}
+
+// applyHead and applyGet only matter for SSE-C, S3 decrypts SSE-S3 and SSE-KMS objects on its own
+func (e serverSideEncryption) applyHead(input *s3.HeadObjectInput) {
+	if e.mode == model.StorageEncryptionSSEC {
+		key, keyMD5 := e.customerKey(aws.ToString(input.Key))
+		input.SSECustomerAlgorithm = aws.String(string(types.ServerSideEncryptionAes256))
+		input.SSECustomerKey = aws.String(key)
+		input.SSECustomerKeyMD5 = aws.String(keyMD5)
+	}
+}
+
+func (e serverSideEncryption) applyGet(input *s3.GetObjectInput) {
+	if e.mode == model.StorageEncryptionSSEC {
+		key, keyMD5 := e.customerKey(aws.ToString(input.Key))
+		input.SSECustomerAlgorithm = aws.String(string(types.ServerSideEncryptionAes256))
+		input.SSECustomerKey = aws.String(key)
+		input.SSECustomerKeyMD5 = aws.String(keyMD5)
+	}
+}
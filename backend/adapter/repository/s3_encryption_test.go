@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"net/url"
+	"quickshare/core/model"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestS3BlobStorage(t *testing.T, sseMode, kmsKeyID, customerKey string) *S3BlobStorage {
+	t.Helper()
+
+	blobStorage, err := NewS3BlobStorage(S3BlobStorageConfig{
+		Region:          "us-east-2",
+		Bucket:          "quickshare-assets",
+		AccessKeyID:     "AKIDTEST",
+		SecretAccessKey: "secret",
+		Endpoint:        "https://storage.test",
+		ForcePathStyle:  true,
+		SSEMode:         sseMode,
+		SSEKMSKeyID:     kmsKeyID,
+		SSECustomerKey:  customerKey,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return blobStorage
+}
+
+func TestS3BlobStorage_PresignedUploadHeaders(t *testing.T) {
+	masterKey := strings.Repeat("k", MinSSECustomerKeyLength)
+
+	tests := []struct {
+		name        string
+		sseMode     string
+		kmsKeyID    string
+		wantHeaders map[string]string
+		wantRecord  *model.StorageEncryption
+	}{
+		{
+			// served from the public URL, the object itself must name the file
+			name:        "bucket default",
+			wantHeaders: map[string]string{"Content-Disposition": `attachment; filename="report.pdf"`},
+		},
+		{
+			name:        "sse-s3",
+			sseMode:     model.StorageEncryptionSSES3,
+			wantHeaders: map[string]string{"Content-Disposition": `attachment; filename="report.pdf"`, "X-Amz-Server-Side-Encryption": "AES256"},
+			wantRecord:  &model.StorageEncryption{Mode: model.StorageEncryptionSSES3},
+		},
+		{
+			name:     "sse-kms with a key",
+			sseMode:  model.StorageEncryptionSSEKMS,
+			kmsKeyID: "alias/quickshare",
+			wantHeaders: map[string]string{
+				"Content-Disposition":                         `attachment; filename="report.pdf"`,
+				"X-Amz-Server-Side-Encryption":                "aws:kms",
+				"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": "alias/quickshare",
+			},
+			wantRecord: &model.StorageEncryption{Mode: model.StorageEncryptionSSEKMS, KeyID: "alias/quickshare"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blobStorage := newTestS3BlobStorage(t, tt.sseMode, tt.kmsKeyID, masterKey)
+
+			presigned, err := blobStorage.GeneratePresignedUploadURL("uploads/do10172/report.pdf", time.Minute, "report.pdf")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(presigned.Headers, tt.wantHeaders) {
+				t.Errorf("expected headers %v, got %v", tt.wantHeaders, presigned.Headers)
+			}
+			if !reflect.DeepEqual(blobStorage.StorageEncryption(), tt.wantRecord) {
+				t.Errorf("expected storage encryption %+v, got %+v", tt.wantRecord, blobStorage.StorageEncryption())
+			}
+		})
+	}
+}
+
+func TestS3BlobStorage_SSECustomerKeys(t *testing.T) {
+	blobStorage := newTestS3BlobStorage(t, model.StorageEncryptionSSEC, "", strings.Repeat("k", MinSSECustomerKeyLength))
+
+	upload, err := blobStorage.GeneratePresignedUploadURL("uploads/do10172/report.pdf", time.Minute, "report.pdf")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	download, err := blobStorage.GeneratePresignedDownloadURL("uploads/do10172/report.pdf", blobStorage.StorageEncryption(), time.Minute, "report.pdf")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other, err := blobStorage.GeneratePresignedDownloadURL("uploads/fe20391/report.pdf", blobStorage.StorageEncryption(), time.Minute, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	key := upload.Headers["X-Amz-Server-Side-Encryption-Customer-Key"]
+	rawKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(rawKey) != 32 {
+		t.Fatalf("expected a base64 AES-256 key, got %q", key)
+	}
+	sum := md5.Sum(rawKey)
+	if upload.Headers["X-Amz-Server-Side-Encryption-Customer-Key-Md5"] != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("the key MD5 doesn't match the key")
+	}
+	if upload.Headers["X-Amz-Server-Side-Encryption-Customer-Algorithm"] != "AES256" {
+		t.Errorf("expected the AES256 algorithm, got %q", upload.Headers["X-Amz-Server-Side-Encryption-Customer-Algorithm"])
+	}
+	if download.Headers["X-Amz-Server-Side-Encryption-Customer-Key"] != key {
+		t.Error("expected the download to use the key of the upload")
+	}
+	if other.Headers["X-Amz-Server-Side-Encryption-Customer-Key"] == key {
+		t.Error("expected every upload to get its own key")
+	}
+	if strings.Contains(upload.URL, key) || strings.Contains(upload.URL, url.QueryEscape(key)) {
+		t.Error("the customer key must not leak into the URL")
+	}
+
+	record := blobStorage.StorageEncryption()
+	if record == nil || record.Mode != model.StorageEncryptionSSEC || !strings.HasPrefix(record.KeyID, "sha256:") {
+		t.Errorf("expected an sse-c record with the master key fingerprint, got %+v", record)
+	}
+}
+
+func TestS3BlobStorage_RecordedEncryption(t *testing.T) {
+	masterKey := strings.Repeat("k", MinSSECustomerKeyLength)
+	ssec := newTestS3BlobStorage(t, model.StorageEncryptionSSEC, "", masterKey).StorageEncryption()
+
+	tests := []struct {
+		name        string
+		sseMode     string
+		customerKey string
+		recorded    *model.StorageEncryption
+		wantSSEC    bool
+		wantErr     bool
+	}{
+		{name: "sse-c object after a switch to sse-s3", sseMode: model.StorageEncryptionSSES3, customerKey: masterKey, recorded: ssec, wantSSEC: true},
+		{name: "plain object while sse-c is configured", sseMode: model.StorageEncryptionSSEC, customerKey: masterKey, recorded: nil},
+		{name: "sse-kms object while sse-c is configured", sseMode: model.StorageEncryptionSSEC, customerKey: masterKey, recorded: &model.StorageEncryption{Mode: model.StorageEncryptionSSEKMS}},
+		{name: "sse-c object without its master key", sseMode: model.StorageEncryptionSSES3, recorded: ssec, wantErr: true},
+		{name: "sse-c object of another master key", sseMode: model.StorageEncryptionSSEC, customerKey: strings.Repeat("o", MinSSECustomerKeyLength), recorded: ssec, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blobStorage := newTestS3BlobStorage(t, tt.sseMode, "", tt.customerKey)
+
+			download, err := blobStorage.GeneratePresignedDownloadURL("uploads/do10172/report.pdf", tt.recorded, time.Minute, "")
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, ok := download.Headers["X-Amz-Server-Side-Encryption-Customer-Key"]; ok != tt.wantSSEC {
+				t.Errorf("expected the customer key headers %v, got %v", tt.wantSSEC, download.Headers)
+			}
+		})
+	}
+}
+
+func TestNewS3BlobStorage_InvalidSSE(t *testing.T) {
+	for _, cfg := range []S3BlobStorageConfig{
+		{Region: "us-east-2", Bucket: "b", SSEMode: "sse-x"},
+		{Region: "us-east-2", Bucket: "b", SSEMode: model.StorageEncryptionSSEC, SSECustomerKey: "short"},
+	} {
+		if _, err := NewS3BlobStorage(cfg); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"quickshare/core/repository"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// SQSStorageEventQueue receives the bucket notifications from an SQS queue
+type SQSStorageEventQueue struct {
+	client   *sqs.Client
+	queueURL string
+}
+
+// NewSQSStorageEventQueue reuses the credentials of the S3 config, endpoint
+// overrides the SQS endpoint (LocalStack, ElasticMQ...)
+func NewSQSStorageEventQueue(cfg S3BlobStorageConfig, queueURL string, endpoint string) (*SQSStorageEventQueue, error) {
+	awsCfg, _, err := loadAWSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client := sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpointURL(endpoint, cfg.DisableSSL).String())
+		}
+	})
+
+	log.Printf("SQS storage event queue configured: queue=%s", queueURL)
+
+	return &SQSStorageEventQueue{client: client, queueURL: queueURL}, nil
+}
+
+func (q *SQSStorageEventQueue) Receive(max int, wait time.Duration) ([]repository.QueueMessage, error) {
+	// the request itself blocks for wait, leave room for the round trip
+	ctx, cancel := context.WithTimeout(context.Background(), wait+s3RequestTimeout)
+	defer cancel()
+
+	output, err := q.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(q.queueURL),
+		MaxNumberOfMessages: int32(max),
+		WaitTimeSeconds:     int32(wait / time.Second),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive messages: %w", err)
+	}
+
+	messages := make([]repository.QueueMessage, 0, len(output.Messages))
+	for _, message := range output.Messages {
+		messages = append(messages, repository.QueueMessage{
+			ID:            aws.ToString(message.MessageId),
+			ReceiptHandle: aws.ToString(message.ReceiptHandle),
+			Body:          []byte(aws.ToString(message.Body)),
+		})
+	}
+	return messages, nil
+}
+
+func (q *SQSStorageEventQueue) Ack(message repository.QueueMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s3RequestTimeout)
+	defer cancel()
+
+	_, err := q.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.queueURL),
+		ReceiptHandle: aws.String(message.ReceiptHandle),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete message %s: %w", message.ID, err)
+	}
+	return nil
+}
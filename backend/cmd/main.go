@@ -2,50 +2,182 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	httphandler "quickshare/adapter/http"
 	"quickshare/adapter/repository"
 	"quickshare/core/service"
+	"quickshare/internal/bootstrap"
 	"quickshare/internal/config"
-	"time"
+	"quickshare/pkg/objectkey"
+	"quickshare/pkg/qrcode"
+	"strings"
 
 	"github.com/gorilla/mux"
-	_ "github.com/lib/pq"
 )
 
 func main() {
-	cfg := config.NewConfig()
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		serve(loadConfig(args))
+	case "reconcile":
+		fix, rest := extractBoolFlag(args, "fix")
+		reconcile(loadConfig(rest), fix)
+	case "config":
+		if len(args) == 0 || args[0] != "print" {
+			log.Fatal("usage: main config print [flags]")
+		}
+		printConfig(args[1:])
+	default:
+		log.Fatalf("unknown command %q, expected serve, reconcile or config print", command)
+	}
+}
+
+func loadConfig(args []string) *config.Config {
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	return cfg
+}
+
+// printConfig shows the effective config even when it is invalid, so it can be used to debug it
+func printConfig(args []string) {
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Print(os.Stdout); err != nil {
+		log.Fatal("Failed to print config:", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
 
+func serve(cfg *config.Config) {
 	log.Println("Starting QuickShare Backend...")
 	log.Printf("Environment detected: DB_HOST=%s", cfg.DBConfig.DBHost)
 
 	var db *sql.DB
-	if cfg.ServerConfig.Port == "3000" {
-		db = connectWithRetry(cfg, 5, 3*time.Second)
+	if cfg.DBConfig.Enabled {
+		var err error
+		db, err = bootstrap.OpenDatabase(cfg.DBConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
 		defer db.Close()
+	} else {
+		log.Println("Database disabled by config, skipping connection")
 	}
 
 	// Initialize repositories
 	postgresRepo := repository.NewPostgreSQLRepository(db)
 	
-	s3BlobStorage, err := repository.NewS3BlobStorage(
-		cfg.S3Config.Region,
-		cfg.S3Config.Bucket,
-		cfg.S3Config.AccessKeyID,
-		cfg.S3Config.SecretAccessKey,
-	)
+	s3BlobStorage, err := bootstrap.OpenBlobStorage(cfg.S3Config)
 	if err != nil {
-		log.Fatal("Failed to initialize S3:", err)
+		log.Fatal(err)
 	}
 
 	// Initialize service
-	uploadObjectService := service.NewUploadObjectService(postgresRepo, s3BlobStorage)
+	uploadObjectService := newUploadObjectService(cfg, postgresRepo, s3BlobStorage)
+	reconcileService := service.NewReconcileService(postgresRepo, s3BlobStorage, uploadObjectService)
+	webhookService := service.NewWebhookService(postgresRepo)
+	shortLinkService := service.NewShortLinkService(postgresRepo, postgresRepo)
+	storageEventService := service.NewStorageEventService(postgresRepo, uploadObjectService, cfg.S3Config.Bucket)
+	bundleService := service.NewBundleService(postgresRepo, s3BlobStorage, uploadObjectService)
+	previewService := service.NewPreviewService(postgresRepo, postgresRepo, s3BlobStorage)
+
+	if cfg.DBConfig.Enabled && cfg.JanitorConfig.Enabled {
+		janitor := service.NewJanitor(postgresRepo, uploadObjectService, service.JanitorConfig{
+			Interval:          cfg.JanitorConfig.Interval.Duration(),
+			PendingTimeout:    cfg.JanitorConfig.PendingTimeout.Duration(),
+			DeleteGracePeriod: cfg.UploadConfig.DeleteGracePeriod.Duration(),
+		})
+		go janitor.Run(make(chan struct{}))
+	}
+	if cfg.DBConfig.Enabled {
+		blobDeletionWorker := service.NewBlobDeletionWorker(postgresRepo, s3BlobStorage, cfg.JanitorConfig.Interval.Duration())
+		go blobDeletionWorker.Run(make(chan struct{}))
+	}
+	if cfg.DBConfig.Enabled && cfg.WebhookConfig.Enabled {
+		webhookDispatcher := service.NewWebhookDispatcher(postgresRepo, service.WebhookDispatcherConfig{
+			Interval:          cfg.WebhookConfig.Interval.Duration(),
+			Timeout:           cfg.WebhookConfig.Timeout.Duration(),
+			MaxAttempts:       cfg.WebhookConfig.MaxAttempts,
+			RetryInitialDelay: cfg.WebhookConfig.RetryInitialDelay.Duration(),
+			RetryMaxDelay:     cfg.WebhookConfig.RetryMaxDelay.Duration(),
+		})
+		go webhookDispatcher.Run(make(chan struct{}))
+	}
+
+	if cfg.DBConfig.Enabled && cfg.StorageEventsConfig.QueueURL != "" {
+		queue, err := bootstrap.OpenStorageEventQueue(cfg.S3Config, cfg.StorageEventsConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		storageEventPoller := service.NewStorageEventPoller(queue, storageEventService, cfg.StorageEventsConfig.WaitTime.Duration())
+		go storageEventPoller.Run(make(chan struct{}))
+	}
+
+	if cfg.DBConfig.Enabled && cfg.PreviewConfig.Enabled {
+		previewWorker := service.NewPreviewWorker(postgresRepo, postgresRepo, s3BlobStorage, service.PreviewWorkerConfig{
+			Interval:      cfg.PreviewConfig.Interval.Duration(),
+			MaxSourceSize: cfg.PreviewConfig.MaxSourceSize.Bytes(),
+			MaxPixels:     int64(cfg.PreviewConfig.MaxPixels),
+			MaxAttempts:   cfg.PreviewConfig.MaxAttempts,
+		})
+		go previewWorker.Run(make(chan struct{}))
+	}
+
+	healthService := service.NewHealthService()
+	if cfg.DBConfig.Enabled {
+		healthService.Register("database", postgresRepo.Ping)
+	}
+	healthService.Register("blob_storage", s3BlobStorage.CheckBucket)
+
+	if cfg.DBConfig.Enabled && cfg.ScannerConfig.Address != "" {
+		scanner, err := repository.NewClamdScanner(cfg.ScannerConfig.Address, cfg.ScannerConfig.Timeout.Duration())
+		if err != nil {
+			log.Fatal(err)
+		}
+		scanWorker := service.NewScanWorker(postgresRepo, s3BlobStorage, scanner, uploadObjectService, service.ScanWorkerConfig{
+			Interval:    cfg.ScannerConfig.Interval.Duration(),
+			MaxAttempts: cfg.ScannerConfig.MaxAttempts,
+		})
+		go scanWorker.Run(make(chan struct{}))
+		healthService.Register("scanner", scanner.Ping)
+	}
 
 	// Initialize handlers
-	uploadObjectHandler := httphandler.NewUploadObjectHandler(uploadObjectService)
-	handler := httphandler.NewHandler(uploadObjectHandler)
+	bundleHandler := httphandler.NewBundleHandler(bundleService)
+	uploadObjectHandler := httphandler.NewUploadObjectHandler(uploadObjectService, bundleHandler)
+	healthHandler := httphandler.NewHealthHandler(healthService)
+	adminHandler := httphandler.NewAdminHandler(reconcileService, storageEventService)
+	webhookHandler := httphandler.NewWebhookHandler(webhookService)
+	shortLinkHandler := httphandler.NewShortLinkHandler(shortLinkService)
+	previewHandler := httphandler.NewPreviewHandler(previewService)
+	// the level was checked by the config validation
+	qrLevel, _ := qrcode.ParseLevel(cfg.QRCodeConfig.Level)
+	qrCodeHandler := httphandler.NewQRCodeHandler(uploadObjectService, shortLinkService, httphandler.QRCodeOptions{
+		Size:      cfg.QRCodeConfig.Size,
+		Level:     qrLevel,
+		PublicURL: cfg.ServerConfig.PublicURL,
+	})
+	uiHandler := httphandler.NewUIHandler()
+	handler := httphandler.NewHandler(uploadObjectHandler, healthHandler, adminHandler, webhookHandler, shortLinkHandler, bundleHandler, previewHandler, qrCodeHandler, uiHandler, cfg.AdminConfig.Token)
 
 	// Setup routes
 	router := mux.NewRouter()
@@ -58,40 +190,71 @@ func main() {
 	}
 }
 
-func connectWithRetry(cfg *config.Config, maxRetries int, delay time.Duration) *sql.DB {
-	connectionString := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		cfg.DBConfig.DBHost,
-		cfg.DBConfig.DBPort,
-		cfg.DBConfig.DBUser,
-		cfg.DBConfig.DBPassword,
-		cfg.DBConfig.DBName,
-	)
+func newUploadObjectService(cfg *config.Config, repo *repository.PostgreSQLRepository, blobStorage *repository.S3BlobStorage) *service.UploadObjectService {
+	// the sharding was checked by the config validation
+	keySharding, _ := objectkey.ParseSharding(cfg.UploadConfig.KeySharding)
+	return service.NewUploadObjectService(repo, blobStorage, repo, service.UploadObjectServiceConfig{
+		PresignExpiry: cfg.UploadConfig.PresignExpiry.Duration(),
+		DefaultTTL:    cfg.UploadConfig.DefaultTTL.Duration(),
+		MaxFileSize:   cfg.UploadConfig.MaxFileSize.Bytes(),
+		MaxTTL:        cfg.UploadConfig.MaxTTL.Duration(),
+		KeySharding:   keySharding,
 
-	log.Printf("Attempting to connect to database at %s:%s...", cfg.DBConfig.DBHost, cfg.DBConfig.DBPort)
+		DeleteGracePeriod: cfg.UploadConfig.DeleteGracePeriod.Duration(),
+		MimePolicy: service.MimePolicy{
+			Allow:  cfg.UploadConfig.MimeAllowlist,
+			Deny:   cfg.UploadConfig.MimeDenylist,
+			Action: cfg.UploadConfig.MimePolicyAction,
+		},
+		ScanUploads: cfg.DBConfig.Enabled && cfg.ScannerConfig.Address != "",
+		GeneratePreviews: cfg.DBConfig.Enabled && cfg.PreviewConfig.Enabled,
+	})
+}
 
-	var db *sql.DB
-	var err error
+// reconcile compares the bucket with upload_objects once and prints the report as JSON
+func reconcile(cfg *config.Config, fix bool) {
+	if !cfg.DBConfig.Enabled {
+		log.Fatal("reconcile needs the database, it is disabled by config")
+	}
 
-	for i := 0; i < maxRetries; i++ {
-		db, err = sql.Open("postgres", connectionString)
-		if err != nil {
-			log.Printf("Retry %d/%d: Failed to open database connection: %v", i+1, maxRetries, err)
-			time.Sleep(delay)
-			continue
-		}
+	db, err := bootstrap.OpenDatabase(cfg.DBConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
 
-		err = db.Ping()
-		if err == nil {
-			log.Println("Successfully connected to database!")
-			return db
-		}
+	s3BlobStorage, err := bootstrap.OpenBlobStorage(cfg.S3Config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	postgresRepo := repository.NewPostgreSQLRepository(db)
+	uploadObjectService := newUploadObjectService(cfg, postgresRepo, s3BlobStorage)
+	reconcileService := service.NewReconcileService(postgresRepo, s3BlobStorage, uploadObjectService)
 
-		log.Printf("Retry %d/%d: Failed to ping database: %v", i+1, maxRetries, err)
-		db.Close()
-		time.Sleep(delay)
+	report, err := reconcileService.Reconcile(fix)
+	if err != nil {
+		log.Fatal("Reconcile failed:", err)
 	}
 
-	log.Fatal("Failed to connect to database after retries:", err)
-	return nil
-}
\ No newline at end of file
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+}
+
+// extractBoolFlag pulls a command specific flag out of args before they reach config.Load
+func extractBoolFlag(args []string, name string) (bool, []string) {
+	value := false
+	var rest []string
+	for _, arg := range args {
+		switch arg {
+		case "-" + name, "--" + name, "-" + name + "=true", "--" + name + "=true":
+			value = true
+		case "-" + name + "=false", "--" + name + "=false":
+			value = false
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return value, rest
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"quickshare/core/model"
+	"quickshare/core/service"
+	"strings"
+	"time"
+)
+
+// apiError is an {"error": ...} answer of the API
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (HTTP %d)", e.Message, e.Status)
+}
+
+// uploadRequest is the body of POST /upload, the server refuses unknown fields
+type uploadRequest struct {
+	FileName   string            `json:"file_name"`
+	FileSize   int64             `json:"file_size"`
+	MimeType   string            `json:"mime_type,omitempty"`
+	ExpiresAt  *time.Time        `json:"expires_at,omitempty"`
+	Encryption *model.Encryption `json:"encryption,omitempty"`
+}
+
+type downloadResponse struct {
+	ID              string            `json:"id"`
+	DownloadURL     string            `json:"download_url"`
+	DownloadHeaders map[string]string `json:"download_headers,omitempty"`
+}
+
+type shortLinkResponse struct {
+	Slug string `json:"slug"`
+	URL  string `json:"url"`
+}
+
+// client talks to the quickshare API, the presigned storage requests go through the same http.Client
+type client struct {
+	server     string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func newClient(cfg *clientConfig) *client {
+	return &client{
+		server: cfg.Server,
+		apiKey: cfg.APIKey,
+		// no overall timeout, transfers take as long as they take
+		httpClient: &http.Client{Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			ResponseHeaderTimeout: time.Minute,
+		}},
+	}
+}
+
+func (c *client) do(method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	req, err := c.newRequest(method, c.server+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return readAPIError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid answer from %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// newRequest adds the API key to the requests to the server, never to the presigned ones
+func (c *client) newRequest(method string, target string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.apiKey != "" && strings.HasPrefix(target, c.server+"/") {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	return req, nil
+}
+
+func readAPIError(resp *http.Response) error {
+	var body struct {
+		Error  string `json:"error"`
+		Fields []struct {
+			Field   string `json:"field"`
+			Message string `json:"message"`
+		} `json:"fields"`
+	}
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if json.Unmarshal(content, &body) != nil || body.Error == "" {
+		body.Error = strings.TrimSpace(string(content))
+	}
+	for _, field := range body.Fields {
+		body.Error += fmt.Sprintf("; %s %s", field.Field, field.Message)
+	}
+	if body.Error == "" {
+		body.Error = http.StatusText(resp.StatusCode)
+	}
+	return &apiError{Status: resp.StatusCode, Message: body.Error}
+}
+
+func (c *client) initiate(uploadObject *model.UploadObject) (*service.UploadResponse, error) {
+	request := uploadRequest{
+		FileName:   uploadObject.FileName,
+		FileSize:   uploadObject.FileSize,
+		MimeType:   uploadObject.MimeType,
+		Encryption: uploadObject.Encryption,
+	}
+	if !uploadObject.ExpiresAt.IsZero() {
+		request.ExpiresAt = &uploadObject.ExpiresAt
+	}
+
+	var response service.UploadResponse
+	if err := c.do(http.MethodPost, "/upload", request, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// put streams the content to the presigned URL, size must be exact since S3 refuses chunked uploads
+func (c *client) put(uploadURL string, headers map[string]string, body io.Reader, size int64) error {
+	req, err := http.NewRequest(http.MethodPut, uploadURL, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		content, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("upload failed with HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+	return nil
+}
+
+func (c *client) confirm(id string) (*model.UploadObject, error) {
+	var uploadObject model.UploadObject
+	if err := c.do(http.MethodPost, "/upload/"+url.PathEscape(id)+"/confirm", nil, &uploadObject); err != nil {
+		return nil, err
+	}
+	return &uploadObject, nil
+}
+
+func (c *client) createShortLink(id string) (*shortLinkResponse, error) {
+	var link shortLinkResponse
+	if err := c.do(http.MethodPost, "/upload/"+url.PathEscape(id)+"/links", nil, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (c *client) get(id string) (*model.UploadObject, error) {
+	var uploadObject model.UploadObject
+	if err := c.do(http.MethodGet, "/upload/"+url.PathEscape(id), nil, &uploadObject); err != nil {
+		return nil, err
+	}
+	return &uploadObject, nil
+}
+
+func (c *client) remove(id string) (*model.UploadObject, error) {
+	var uploadObject model.UploadObject
+	if err := c.do(http.MethodDelete, "/upload/"+url.PathEscape(id), nil, &uploadObject); err != nil {
+		return nil, err
+	}
+	return &uploadObject, nil
+}
+
+func (c *client) list(query url.Values) (*service.UploadListResponse, error) {
+	var uploadList service.UploadListResponse
+	if err := c.do(http.MethodGet, "/uploads?"+query.Encode(), nil, &uploadList); err != nil {
+		return nil, err
+	}
+	return &uploadList, nil
+}
+
+func (c *client) createBundle(request *service.BundleRequest) (*service.BundleResponse, error) {
+	var bundle service.BundleResponse
+	if err := c.do(http.MethodPost, "/bundles", request, &bundle); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+func (c *client) confirmBundle(id string) (*model.UploadObject, error) {
+	var bundle model.UploadObject
+	if err := c.do(http.MethodPost, "/bundles/"+url.PathEscape(id)+"/confirm", nil, &bundle); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+func (c *client) bundleMembers(id string) ([]*model.UploadObject, error) {
+	var members struct {
+		Items []*model.UploadObject `json:"items"`
+	}
+	if err := c.do(http.MethodGet, "/bundles/"+url.PathEscape(id)+"/members", nil, &members); err != nil {
+		return nil, err
+	}
+	return members.Items, nil
+}
+
+// download asks for the download URL of path, /download/{id} or a short link that redirects to it.
+// Bundles answer with their zip right away, the URL to fetch is then the API one.
+func (c *client) download(path string) (*downloadResponse, error) {
+	req, err := c.newRequest(http.MethodGet, c.server+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, readAPIError(resp)
+	}
+	if resp.Header.Get("Content-Type") == "application/zip" {
+		final := resp.Request.URL
+		segments := strings.Split(final.Path, "/")
+		return &downloadResponse{ID: segments[len(segments)-1], DownloadURL: final.String()}, nil
+	}
+
+	var download downloadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&download); err != nil {
+		return nil, fmt.Errorf("invalid answer from GET %s: %w", path, err)
+	}
+	if download.DownloadURL == "" {
+		return nil, errors.New("the server returned no download URL")
+	}
+	return &download, nil
+}
+
+// fetch GETs the object from offset, it returns the body and whether the server honoured the range
+func (c *client) fetch(download *downloadResponse, offset int64) (io.ReadCloser, int64, bool, error) {
+	// bundles are fetched from the API itself
+	req, err := c.newRequest(http.MethodGet, download.DownloadURL, nil)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	for name, value := range download.DownloadHeaders {
+		req.Header.Set(name, value)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("download failed: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.ContentLength, false, nil
+	case http.StatusPartialContent:
+		return resp.Body, resp.ContentLength, true, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the partial file is already complete
+		resp.Body.Close()
+		return io.NopCloser(strings.NewReader("")), 0, true, nil
+	default:
+		defer resp.Body.Close()
+		content, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, 0, false, fmt.Errorf("download failed with HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+}
@@ -0,0 +1,553 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"quickshare/core/model"
+	"quickshare/core/service"
+	"quickshare/pkg/crypto"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// keyFragment prefixes the key in the fragment of the share URL of encrypted uploads
+const keyFragment = "k="
+
+// stdout receives the results, progress and warnings go to stderr
+var stdout io.Writer = os.Stdout
+
+func runSend(args []string) error {
+	flags := flag.NewFlagSet("send", flag.ContinueOnError)
+	ttl := flags.Duration("ttl", 0, "how long the upload is kept, the server default when 0")
+	encrypt := flags.Bool("encrypt", false, "encrypt the file before it leaves the machine, the key is put in the share URL")
+	quiet := flags.Bool("quiet", false, "don't show the progress bar")
+	cfg, args, err := loadClientConfig(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usageError("send [flags] FILE|DIR")
+	}
+	c := newClient(cfg)
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if *encrypt {
+			return errors.New("directories can't be encrypted yet, send an archive of it instead")
+		}
+		return sendDirectory(c, args[0], *ttl, *quiet)
+	}
+
+	mimeType, err := detectMimeType(file)
+	if err != nil {
+		return err
+	}
+
+	uploadObject := &model.UploadObject{
+		FileName: filepath.Base(args[0]),
+		FileSize: info.Size(),
+		MimeType: mimeType,
+	}
+	if *ttl > 0 {
+		uploadObject.ExpiresAt = time.Now().Add(*ttl)
+	}
+
+	var key []byte
+	if *encrypt {
+		if key, err = crypto.GenerateKey(); err != nil {
+			return err
+		}
+		uploadObject.Encryption = &model.Encryption{
+			Algorithm: crypto.AlgorithmXChaCha20Poly1305,
+			KeyHint:   crypto.KeyHint(key),
+			ChunkSize: crypto.DefaultChunkSize,
+		}
+		uploadObject.FileSize = crypto.EncryptedSize(crypto.AlgorithmXChaCha20Poly1305, info.Size(), crypto.DefaultChunkSize)
+	}
+
+	upload, err := c.initiate(uploadObject)
+	if err != nil {
+		return fmt.Errorf("failed to start the upload: %w", err)
+	}
+
+	bar := newProgress(file, uploadObject.FileName, 0, info.Size(), *quiet)
+	var body io.Reader = bar
+	if key != nil {
+		body = encryptingReader(bar, key, uploadObject.Encryption)
+	}
+	if err := c.put(upload.UploadURL, upload.UploadHeaders, body, uploadObject.FileSize); err != nil {
+		return err
+	}
+	bar.finish()
+
+	confirmed, err := c.confirm(upload.ID)
+	if err != nil {
+		return fmt.Errorf("failed to confirm upload %s: %w", upload.ID, err)
+	}
+	if confirmed.Status == model.UploadStatusScanning {
+		fmt.Fprintln(os.Stderr, "the upload is being scanned, it can be downloaded once the scan is done")
+	}
+
+	fmt.Fprintln(stdout, shareURL(c, upload.ID, key))
+	return nil
+}
+
+// sendDirectory shares the regular files under dir as one bundle, downloaded as a zip
+func sendDirectory(c *client, dir string, ttl time.Duration, quiet bool) error {
+	request := &service.BundleRequest{Name: filepath.Base(filepath.Clean(dir))}
+	if ttl > 0 {
+		request.ExpiresAt = time.Now().Add(ttl)
+	}
+
+	paths := map[string]string{}
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		mimeType, err := detectMimeType(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relative)
+		paths[name] = path
+		total += info.Size()
+		request.Files = append(request.Files, service.BundleFile{FileName: name, FileSize: info.Size(), MimeType: mimeType})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(request.Files) == 0 {
+		return fmt.Errorf("%s holds no file", dir)
+	}
+
+	bundle, err := c.createBundle(request)
+	if err != nil {
+		return fmt.Errorf("failed to start the upload: %w", err)
+	}
+
+	var done int64
+	for _, member := range bundle.Members {
+		file, err := os.Open(paths[member.FileName])
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		bar := newProgress(file, request.Name, done, total, quiet)
+		err = c.put(member.UploadURL, member.UploadHeaders, bar, info.Size())
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to upload %s: %w", member.FileName, err)
+		}
+		done += info.Size()
+		if done == total {
+			bar.finish()
+		}
+	}
+
+	if _, err := c.confirmBundle(bundle.ID); err != nil {
+		return fmt.Errorf("failed to confirm bundle %s: %w", bundle.ID, err)
+	}
+
+	fmt.Fprintln(stdout, shareURL(c, bundle.ID, nil))
+	return nil
+}
+
+// detectMimeType goes by the extension first, the content otherwise
+func detectMimeType(file *os.File) (string, error) {
+	if mimeType := mime.TypeByExtension(filepath.Ext(file.Name())); mimeType != "" {
+		mediaType, _, err := mime.ParseMediaType(mimeType)
+		if err == nil {
+			return mediaType, nil
+		}
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	return mediaType, nil
+}
+
+// encryptingReader encrypts src on the fly, the ciphertext is exactly crypto.EncryptedSize bytes
+func encryptingReader(src io.Reader, key []byte, encryption *model.Encryption) io.Reader {
+	reader, writer := io.Pipe()
+	go func() {
+		encrypter, err := crypto.NewWriter(writer, key, encryption.Algorithm, encryption.ChunkSize)
+		if err == nil {
+			_, err = io.Copy(encrypter, src)
+		}
+		if err == nil {
+			err = encrypter.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader
+}
+
+// shareURL prefers a short link, servers without one still serve /download/{id}
+func shareURL(c *client, id string, key []byte) string {
+	link := c.server + "/download/" + url.PathEscape(id)
+	if shortLink, err := c.createShortLink(id); err == nil {
+		link = c.server + shortLink.URL
+	}
+	if key != nil {
+		link += "#" + keyFragment + crypto.EncodeKey(key)
+	}
+	return link
+}
+
+func runGet(args []string) error {
+	flags := flag.NewFlagSet("get", flag.ContinueOnError)
+	output := flags.String("o", "", "output file, the upload's file name by default")
+	keyFlag := flags.String("key", "", "key of an encrypted upload, when it isn't in the URL")
+	quiet := flags.Bool("quiet", false, "don't show the progress bar")
+	cfg, args, err := loadClientConfig(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usageError("get [flags] ID|URL")
+	}
+
+	path, encodedKey, err := resolveReference(cfg, args[0])
+	if err != nil {
+		return err
+	}
+	if *keyFlag != "" {
+		encodedKey = *keyFlag
+	}
+	c := newClient(cfg)
+
+	download, err := c.download(path)
+	if err != nil {
+		return fmt.Errorf("failed to get the download URL: %w", err)
+	}
+	uploadObject, err := c.get(download.ID)
+	if err != nil {
+		return err
+	}
+
+	var key []byte
+	if uploadObject.Encryption != nil {
+		if encodedKey == "" {
+			return errors.New("the upload is encrypted, pass its share URL with the key or -key")
+		}
+		if key, err = crypto.DecodeKey(encodedKey); err != nil {
+			return err
+		}
+	}
+
+	target := *output
+	if target == "" {
+		target = filepath.Base(uploadObject.FileName)
+		if target == "." || target == string(filepath.Separator) {
+			target = uploadObject.ID
+		}
+	}
+
+	partial := target + ".part"
+	if err := fetchResumable(c, download, partial, uploadObject, *quiet); err != nil {
+		return err
+	}
+
+	if key == nil {
+		return os.Rename(partial, target)
+	}
+	if err := decryptFile(partial, target, key); err != nil {
+		return err
+	}
+	return os.Remove(partial)
+}
+
+// resolveReference turns an upload ID or a share URL into the API path of its download and the key of its fragment
+func resolveReference(cfg *clientConfig, reference string) (string, string, error) {
+	if !strings.Contains(reference, "://") {
+		return "/download/" + url.PathEscape(reference), "", nil
+	}
+
+	link, err := url.Parse(reference)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid share URL: %w", err)
+	}
+	if !strings.HasPrefix(link.Path, "/download/") && !strings.HasPrefix(link.Path, "/s/") {
+		return "", "", fmt.Errorf("%s is not a quickshare share URL", reference)
+	}
+	// the link tells which server to ask, whatever the config says, but the API key
+	// only goes to the configured server: any pasted link would collect it otherwise
+	origin := link.Scheme + "://" + link.Host
+	if !sameOrigin(origin, cfg.Server) {
+		cfg.APIKey = ""
+	}
+	cfg.Server = origin
+	return link.EscapedPath(), strings.TrimPrefix(link.Fragment, keyFragment), nil
+}
+
+// sameOrigin compares the scheme and host of two URLs, ports included
+func sameOrigin(a string, b string) bool {
+	first, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	second, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(first.Scheme, second.Scheme) && strings.EqualFold(first.Host, second.Host)
+}
+
+// fetchResumable downloads into path, appending to what a previous attempt left there
+func fetchResumable(c *client, download *downloadResponse, path string, uploadObject *model.UploadObject, quiet bool) error {
+	var offset int64
+	if info, err := os.Stat(path); err == nil {
+		offset = info.Size()
+	}
+
+	body, length, resumed, err := c.fetch(download, offset)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !resumed {
+		// the storage ignored the range, start over
+		offset = 0
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		return err
+	}
+
+	total := uploadObject.FileSize
+	if length >= 0 {
+		total = offset + length
+	}
+	bar := newProgress(body, uploadObject.FileName, offset, total, quiet)
+	if _, err := io.Copy(file, bar); err != nil {
+		file.Close()
+		return fmt.Errorf("download interrupted, run the same command to resume: %w", err)
+	}
+	bar.finish()
+	return file.Close()
+}
+
+func decryptFile(source string, target string, key []byte) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	reader, err := crypto.NewReader(in, key)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, reader); err != nil {
+		out.Close()
+		os.Remove(target)
+		return fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return out.Close()
+}
+
+func runRemove(args []string) error {
+	flags := flag.NewFlagSet("rm", flag.ContinueOnError)
+	cfg, args, err := loadClientConfig(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usageError("rm [flags] ID...")
+	}
+	c := newClient(cfg)
+
+	var failed error
+	for _, id := range args {
+		if _, err := c.remove(id); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to remove %s: %v\n", id, err)
+			failed = errors.New("some uploads were not removed")
+			continue
+		}
+		fmt.Fprintln(stdout, "removed", id)
+	}
+	return failed
+}
+
+func runList(args []string) error {
+	flags := flag.NewFlagSet("ls", flag.ContinueOnError)
+	status := flags.String("status", "", "only the uploads with this status")
+	owner := flags.String("owner", "", "only the uploads of this owner")
+	prefix := flags.String("name", "", "only the uploads whose file name starts with this prefix")
+	limit := flags.Int("limit", 0, "page size, the server default when 0")
+	all := flags.Bool("all", false, "follow the pages until the last one")
+	bundle := flags.String("bundle", "", "list the members of this bundle instead")
+	cfg, args, err := loadClientConfig(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return usageError("ls [flags]")
+	}
+	c := newClient(cfg)
+
+	table := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tNAME\tSIZE\tSTATUS\tEXPIRES")
+
+	if *bundle != "" {
+		members, err := c.bundleMembers(*bundle)
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			printUploadRow(table, member)
+		}
+		return table.Flush()
+	}
+
+	query := url.Values{}
+	for name, value := range map[string]string{"status": *status, "owner_id": *owner, "file_name_prefix": *prefix} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if *limit > 0 {
+		query.Set("limit", fmt.Sprint(*limit))
+	}
+
+	more := false
+	for {
+		page, err := c.list(query)
+		if err != nil {
+			return err
+		}
+		for _, uploadObject := range page.Items {
+			printUploadRow(table, uploadObject)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		if !*all {
+			more = true
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	if more {
+		fmt.Fprintln(os.Stderr, "more uploads available, use -all to list them")
+	}
+	return nil
+}
+
+func printUploadRow(table io.Writer, uploadObject *model.UploadObject) {
+	name := uploadObject.FileName
+	if uploadObject.Kind == model.UploadKindBundle {
+		name += "/"
+	}
+	fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", uploadObject.ID, name,
+		humanSize(uploadObject.FileSize), uploadObject.Status, uploadObject.ExpiresAt.Local().Format(time.DateTime))
+}
+
+func runInfo(args []string) error {
+	flags := flag.NewFlagSet("info", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the upload as JSON")
+	cfg, args, err := loadClientConfig(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usageError("info [flags] ID")
+	}
+
+	uploadObject, err := newClient(cfg).get(args[0])
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(uploadObject)
+	}
+
+	table := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(table, "id:\t%s\n", uploadObject.ID)
+	fmt.Fprintf(table, "name:\t%s\n", uploadObject.FileName)
+	if uploadObject.Kind == model.UploadKindBundle {
+		fmt.Fprintf(table, "kind:\tbundle, list its members with ls -bundle %s\n", uploadObject.ID)
+	}
+	if uploadObject.BundleID != "" {
+		fmt.Fprintf(table, "bundle:\t%s\n", uploadObject.BundleID)
+	}
+	fmt.Fprintf(table, "size:\t%s (%d bytes)\n", humanSize(uploadObject.FileSize), uploadObject.FileSize)
+	fmt.Fprintf(table, "type:\t%s\n", uploadObject.MimeType)
+	if uploadObject.DetectedMimeType != "" {
+		fmt.Fprintf(table, "detected type:\t%s\n", uploadObject.DetectedMimeType)
+	}
+	fmt.Fprintf(table, "status:\t%s\n", uploadObject.Status)
+	if uploadObject.QuarantineReason != "" {
+		fmt.Fprintf(table, "quarantine reason:\t%s\n", uploadObject.QuarantineReason)
+	}
+	if uploadObject.Encryption != nil {
+		fmt.Fprintf(table, "encryption:\t%s\n", uploadObject.Encryption.Algorithm)
+	}
+	fmt.Fprintf(table, "created:\t%s\n", uploadObject.CreatedAt.Local().Format(time.DateTime))
+	fmt.Fprintf(table, "expires:\t%s\n", uploadObject.ExpiresAt.Local().Format(time.DateTime))
+	if uploadObject.DeletedAt != nil {
+		fmt.Fprintf(table, "deleted:\t%s\n", uploadObject.DeletedAt.Local().Format(time.DateTime))
+	}
+	return table.Flush()
+}
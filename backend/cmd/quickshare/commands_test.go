@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"quickshare/core/model"
+	"quickshare/core/service"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeServer plays both the API and the storage the presigned URLs point to
+type fakeServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	upload   *model.UploadObject
+	object   []byte
+	apiKeys  []string
+	putSizes []int64
+
+	bundle    *service.BundleRequest
+	members   map[string][]byte
+	confirmed bool
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	f := &fakeServer{}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /upload", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.apiKeys = append(f.apiKeys, r.Header.Get("Authorization"))
+
+		var uploadObject model.UploadObject
+		json.NewDecoder(r.Body).Decode(&uploadObject)
+		uploadObject.ID = "do10172"
+		uploadObject.Status = model.UploadStatusPending
+		f.upload = &uploadObject
+		json.NewEncoder(w).Encode(service.UploadResponse{
+			ID:            uploadObject.ID,
+			UploadURL:     f.URL + "/storage/do10172",
+			UploadHeaders: map[string]string{"X-Amz-Server-Side-Encryption": "AES256"},
+		})
+	})
+	mux.HandleFunc("PUT /storage/do10172", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Server-Side-Encryption") != "AES256" {
+			http.Error(w, "missing signed header", http.StatusForbidden)
+			return
+		}
+		content, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.object = content
+		f.putSizes = append(f.putSizes, r.ContentLength)
+	})
+	mux.HandleFunc("POST /upload/do10172/confirm", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.upload.Status = model.UploadStatusCompleted
+		json.NewEncoder(w).Encode(f.upload)
+	})
+	mux.HandleFunc("POST /upload/do10172/links", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(shortLinkResponse{Slug: "Ab3dE5gH", URL: "/s/Ab3dE5gH"})
+	})
+	mux.HandleFunc("GET /s/Ab3dE5gH", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/download/do10172", http.StatusFound)
+	})
+	mux.HandleFunc("GET /download/do10172", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(downloadResponse{ID: "do10172", DownloadURL: f.URL + "/storage/do10172"})
+	})
+	mux.HandleFunc("GET /upload/do10172", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		json.NewEncoder(w).Encode(f.upload)
+	})
+	mux.HandleFunc("GET /storage/do10172", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		content := f.object
+		f.mu.Unlock()
+
+		if value, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes="); ok {
+			offset, _ := strconv.Atoi(strings.TrimSuffix(value, "-"))
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)-offset))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[offset:])
+			return
+		}
+		w.Write(content)
+	})
+
+	mux.HandleFunc("POST /bundles", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.bundle = &service.BundleRequest{}
+		json.NewDecoder(r.Body).Decode(f.bundle)
+
+		response := service.BundleResponse{ID: "bundle-1"}
+		for i, file := range f.bundle.Files {
+			response.Members = append(response.Members, service.BundleMemberUpload{
+				FileName:       file.FileName,
+				UploadResponse: &service.UploadResponse{ID: strconv.Itoa(i), UploadURL: f.URL + "/storage/members/" + file.FileName},
+			})
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+	})
+	mux.HandleFunc("PUT /storage/members/", func(w http.ResponseWriter, r *http.Request) {
+		content, _ := io.ReadAll(r.Body)
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.members == nil {
+			f.members = map[string][]byte{}
+		}
+		f.members[strings.TrimPrefix(r.URL.Path, "/storage/members/")] = content
+	})
+	mux.HandleFunc("POST /bundles/bundle-1/confirm", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.confirmed = true
+		json.NewEncoder(w).Encode(model.UploadObject{ID: "bundle-1", Kind: model.UploadKindBundle, Status: model.UploadStatusCompleted})
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	t.Setenv("QUICKSHARE_CONFIG", filepath.Join(t.TempDir(), "missing.yaml"))
+	t.Setenv("QUICKSHARE_SERVER", f.URL)
+	t.Setenv("QUICKSHARE_API_KEY", "qs-test-key")
+	return f
+}
+
+func captureStdout(t *testing.T, run func() error) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	stdout = &out
+	defer func() { stdout = os.Stdout }()
+
+	if err := run(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return strings.TrimSpace(out.String())
+}
+
+func TestSendAndGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		encrypt bool
+	}{
+		{name: "plain upload"},
+		{name: "encrypted upload", encrypt: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeServer(t)
+			dir := t.TempDir()
+			source := filepath.Join(dir, "report.pdf")
+			content := bytes.Repeat([]byte("quickshare "), 20000)
+			if err := os.WriteFile(source, content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			args := []string{"-quiet", source}
+			if tt.encrypt {
+				args = append([]string{"-encrypt"}, args...)
+			}
+			link := captureStdout(t, func() error { return runSend(args) })
+
+			if !strings.HasPrefix(link, server.URL+"/s/Ab3dE5gH") {
+				t.Fatalf("expected the short link, got %q", link)
+			}
+			if strings.Contains(link, "#k=") != tt.encrypt {
+				t.Errorf("expected the key in the fragment only for encrypted uploads, got %q", link)
+			}
+			if bytes.Equal(server.object, content) == tt.encrypt {
+				t.Errorf("expected the stored object to be ciphertext only for encrypted uploads")
+			}
+			if server.putSizes[0] != server.upload.FileSize {
+				t.Errorf("expected a %d bytes PUT, got %d", server.upload.FileSize, server.putSizes[0])
+			}
+			if server.upload.MimeType != "application/pdf" {
+				t.Errorf("expected the type of the extension, got %q", server.upload.MimeType)
+			}
+			if server.apiKeys[0] != "Bearer qs-test-key" {
+				t.Errorf("expected the API key as bearer token, got %q", server.apiKeys[0])
+			}
+
+			// a previous attempt left half of the object behind
+			target := filepath.Join(dir, "copy.pdf")
+			if err := os.WriteFile(target+".part", server.object[:len(server.object)/2], 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			captureStdout(t, func() error { return runGet([]string{"-quiet", "-o", target, link}) })
+
+			downloaded, err := os.ReadFile(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(downloaded, content) {
+				t.Errorf("expected the downloaded file to match the original (%d bytes), got %d bytes", len(content), len(downloaded))
+			}
+			if _, err := os.Stat(target + ".part"); !os.IsNotExist(err) {
+				t.Errorf("expected the partial file to be removed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSendDirectory(t *testing.T) {
+	server := newFakeServer(t)
+	dir := filepath.Join(t.TempDir(), "project")
+	files := map[string]string{"README.md": "# project", "docs/report.pdf": "%PDF-1.7", "docs/empty.txt": ""}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	link := captureStdout(t, func() error { return runSend([]string{"-quiet", dir}) })
+
+	// the fake server has no short link for the bundle, the download URL is shared instead
+	if link != server.URL+"/download/bundle-1" {
+		t.Errorf("expected the download URL of the bundle, got %q", link)
+	}
+	if server.bundle.Name != "project" || len(server.bundle.Files) != len(files) {
+		t.Fatalf("expected the 3 files of project, got %+v", server.bundle)
+	}
+	for name, content := range files {
+		if string(server.members[name]) != content {
+			t.Errorf("expected %s to be uploaded as %q, got %q", name, content, server.members[name])
+		}
+	}
+	if !server.confirmed {
+		t.Error("expected the bundle to be confirmed")
+	}
+}
+
+func TestResolveReference(t *testing.T) {
+	tests := []struct {
+		reference  string
+		wantServer string
+		wantPath   string
+		wantKey    string
+		wantAPIKey string
+		wantErr    bool
+	}{
+		{reference: "do10172", wantServer: "http://configured", wantPath: "/download/do10172", wantAPIKey: "qs-test-key"},
+		{reference: "https://share.example.com/s/Ab3dE5gH#k=c2VjcmV0", wantServer: "https://share.example.com", wantPath: "/s/Ab3dE5gH", wantKey: "c2VjcmV0"},
+		{reference: "https://share.example.com/download/do10172", wantServer: "https://share.example.com", wantPath: "/download/do10172"},
+		{reference: "HTTP://Configured/download/do10172", wantServer: "http://Configured", wantPath: "/download/do10172", wantAPIKey: "qs-test-key"},
+		{reference: "https://configured/download/do10172", wantServer: "https://configured", wantPath: "/download/do10172"},
+		{reference: "https://example.com/elsewhere", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.reference, func(t *testing.T) {
+			cfg := &clientConfig{Server: "http://configured", APIKey: "qs-test-key"}
+
+			path, key, err := resolveReference(cfg, tt.reference)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if cfg.Server != tt.wantServer || path != tt.wantPath || key != tt.wantKey {
+				t.Errorf("expected %s %s %q, got %s %s %q", tt.wantServer, tt.wantPath, tt.wantKey, cfg.Server, path, key)
+			}
+			if cfg.APIKey != tt.wantAPIKey {
+				t.Errorf("expected API key %q, got %q", tt.wantAPIKey, cfg.APIKey)
+			}
+		})
+	}
+}
+
+func TestGet_KeepsTheAPIKeyFromOtherServers(t *testing.T) {
+	newFakeServer(t)
+
+	var authorizations []string
+	var mu sync.Mutex
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		mu.Unlock()
+		http.NotFound(w, r)
+	}))
+	defer other.Close()
+
+	if err := runGet([]string{"-quiet", "-o", filepath.Join(t.TempDir(), "out"), other.URL + "/s/Ab3dE5gH"}); err == nil {
+		t.Fatal("expected an error from the other server")
+	}
+	if len(authorizations) == 0 {
+		t.Fatal("expected the other server to be asked")
+	}
+	for _, authorization := range authorizations {
+		if authorization != "" {
+			t.Errorf("expected no Authorization header outside the configured server, got %q", authorization)
+		}
+	}
+}
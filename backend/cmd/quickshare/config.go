@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultServer = "http://localhost:3000"
+
+var errInvalidFlags = errors.New("invalid flags")
+
+// clientConfig is layered like the server one: defaults, then the config file, then env, then flags
+type clientConfig struct {
+	Server string `yaml:"server"`
+	APIKey string `yaml:"api_key"`
+}
+
+// configPath is $QUICKSHARE_CONFIG, or quickshare/config.yaml in the user config dir
+func configPath() string {
+	if path := os.Getenv("QUICKSHARE_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "quickshare", "config.yaml")
+}
+
+func loadClientConfig(flags *flag.FlagSet, args []string) (*clientConfig, []string, error) {
+	cfg := &clientConfig{Server: defaultServer}
+
+	if path := configPath(); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if err == nil {
+			if err := yaml.Unmarshal(content, cfg); err != nil {
+				return nil, nil, fmt.Errorf("invalid config file %s: %w", path, err)
+			}
+		}
+	}
+
+	if server := os.Getenv("QUICKSHARE_SERVER"); server != "" {
+		cfg.Server = server
+	}
+	if apiKey := os.Getenv("QUICKSHARE_API_KEY"); apiKey != "" {
+		cfg.APIKey = apiKey
+	}
+
+	flags.StringVar(&cfg.Server, "server", cfg.Server, "quickshare server URL (QUICKSHARE_SERVER)")
+	// no default shown for the key, -h would print it
+	apiKey := flags.String("api-key", "", "API key sent as a bearer token (QUICKSHARE_API_KEY)")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, nil, err
+		}
+		// the flag package already printed the problem and the defaults
+		return nil, nil, errInvalidFlags
+	}
+
+	if *apiKey != "" {
+		cfg.APIKey = *apiKey
+	}
+
+	cfg.Server = strings.TrimRight(cfg.Server, "/")
+	if !strings.HasPrefix(cfg.Server, "http://") && !strings.HasPrefix(cfg.Server, "https://") {
+		return nil, nil, fmt.Errorf("server must be an http(s) URL, got %q", cfg.Server)
+	}
+	return cfg, flags.Args(), nil
+}
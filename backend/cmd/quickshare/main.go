@@ -0,0 +1,75 @@
+// Command quickshare is the command-line client of the quickshare API.
+//
+//	quickshare send [flags] FILE|DIR  upload FILE, or DIR as a bundle, and print its share URL
+//	quickshare get [flags] ID|URL     download an upload, resuming a partial download
+//	quickshare rm [flags] ID...       move uploads to the trash
+//	quickshare ls [flags]             list uploads, the API key must be the admin token
+//	quickshare info [flags] ID        show an upload
+//
+// The server URL and API key come from the config file ($QUICKSHARE_CONFIG,
+// or quickshare/config.yaml in the user config dir), then from the
+// QUICKSHARE_SERVER and QUICKSHARE_API_KEY env vars, then from the -server
+// and -api-key flags. Flags go before the arguments.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `usage: quickshare <command> [flags] [args]
+
+commands:
+  send FILE|DIR upload FILE, or DIR as a bundle, and print its share URL
+  get ID|URL    download an upload, resuming a partial download
+  rm ID...      move uploads to the trash
+  ls            list uploads (API key: the admin token of the server)
+  info ID       show an upload
+
+run "quickshare <command> -h" for the flags of a command`
+
+var commands = map[string]func(args []string) error{
+	"send": runSend,
+	"get":  runGet,
+	"rm":   runRemove,
+	"ls":   runList,
+	"info": runInfo,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err := run(os.Args[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		if errors.Is(err, errInvalidFlags) {
+			os.Exit(2)
+		}
+		var usageErr usageError
+		if errors.As(err, &usageErr) {
+			fmt.Fprintf(os.Stderr, "usage: quickshare %s\n", usageErr)
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "quickshare:", err)
+		os.Exit(1)
+	}
+}
+
+// usageError is returned when the arguments of a command are wrong, it holds its synopsis
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
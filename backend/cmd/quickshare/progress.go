@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const progressBarWidth = 30
+
+// progress draws a bar on stderr while the reader it wraps is consumed, it stays silent when stderr isn't a terminal
+type progress struct {
+	reader  io.Reader
+	out     io.Writer
+	label   string
+	done    int64
+	total   int64
+	enabled bool
+	drawn   time.Time
+}
+
+func newProgress(reader io.Reader, label string, done int64, total int64, quiet bool) *progress {
+	return &progress{
+		reader:  reader,
+		out:     os.Stderr,
+		label:   label,
+		done:    done,
+		total:   total,
+		enabled: !quiet && isTerminal(os.Stderr),
+	}
+}
+
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *progress) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	p.done += int64(n)
+	// redrawing on every read would flood slow terminals
+	if p.enabled && (time.Since(p.drawn) > 100*time.Millisecond || err == io.EOF) {
+		p.draw()
+	}
+	return n, err
+}
+
+func (p *progress) draw() {
+	p.drawn = time.Now()
+
+	if p.total <= 0 {
+		fmt.Fprintf(p.out, "\r%s %s", p.label, humanSize(p.done))
+		return
+	}
+	ratio := min(float64(p.done)/float64(p.total), 1)
+	filled := int(ratio * progressBarWidth)
+	fmt.Fprintf(p.out, "\r%s [%s%s] %3.0f%% %s/%s", p.label,
+		strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled),
+		ratio*100, humanSize(p.done), humanSize(p.total))
+}
+
+// finish ends the line of the bar
+func (p *progress) finish() {
+	if p.enabled {
+		p.draw()
+		fmt.Fprintln(p.out)
+	}
+}
+
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	value, exponent := float64(size)/unit, 0
+	for value >= unit && exponent < 4 {
+		value /= unit
+		exponent++
+	}
+	return fmt.Sprintf("%.1f%ciB", value, "KMGTP"[exponent])
+}
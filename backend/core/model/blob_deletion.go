@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// BlobDeletion is a pending storage delete, retried until the object is gone
+type BlobDeletion struct {
+	ID            int64     `json:"id"`
+	UploadID      string    `json:"upload_id"`
+	ObjectKey     string    `json:"object_key"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error,omitempty"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
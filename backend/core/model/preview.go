@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+const (
+	// PreviewStatusPending uploads wait for the preview worker
+	PreviewStatusPending = "pending"
+	PreviewStatusReady   = "ready"
+	// PreviewStatusFailed uploads could not be decoded as images, they are not retried
+	PreviewStatusFailed = "failed"
+)
+
+// Preview is a thumbnail of an image upload, stored under a key derived from the upload ID
+type Preview struct {
+	UploadID string `json:"upload_id"`
+	// Size names the box the image was scaled down to, e.g. "small"
+	Size      string    `json:"size"`
+	ObjectKey string    `json:"object_key"`
+	MimeType  string    `json:"mime_type"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	FileSize  int64     `json:"file_size"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -6,6 +6,8 @@ type ShortLink struct {
 	ID string `json:"id"`
 	Slug string `json:"slug"`
 	OriginalLink string `json:"original_link"`
+	// UploadID is the upload the link points to, OriginalLink is its share path
+	UploadID string `json:"upload_id"`
 	CreatedAt time.Time `json:"created_at"`
 	ExpiresAt time.Time `json:"expires_at"`
 }
\ No newline at end of file
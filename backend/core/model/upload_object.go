@@ -2,12 +2,71 @@ package model
 
 import "time"
 
+const (
+	UploadStatusPending = "pending"
+	// UploadStatusScanning uploads are confirmed but wait for the malware scan before they can be downloaded
+	UploadStatusScanning  = "scanning"
+	UploadStatusCompleted = "completed"
+	UploadStatusFailed    = "failed"
+	// UploadStatusRejected uploads broke the content policy, their object is deleted
+	UploadStatusRejected = "rejected"
+	// UploadStatusQuarantined uploads are kept but can't be downloaded until an operator reviews them
+	UploadStatusQuarantined = "quarantined"
+)
+
+const (
+	UploadKindFile = "file"
+	// UploadKindBundle uploads have no object, they are the zip of their member uploads
+	UploadKindBundle = "bundle"
+)
+
 type UploadObject struct {
 	ID string `json:"id"`
+	// Kind is one of the UploadKind* constants
+	Kind string `json:"kind"`
+	// BundleID is set on the members of a bundle
+	BundleID string `json:"bundle_id,omitempty"`
 	FileName string `json:"file_name"`
 	FileSize int64 `json:"file_size"`
 	MimeType string `json:"mime_type"`
+	// DetectedMimeType is sniffed from the content at confirm time, MimeType is what the client declared
+	DetectedMimeType string `json:"detected_mime_type,omitempty"`
 	ObjectKey string `json:"object_key"`
 	Status string `json:"status"`
 	ExpiresAt time.Time `json:"expires_at"`
-}
\ No newline at end of file
+	OwnerID string `json:"owner_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// QuarantineReason says why a quarantined upload was held back
+	QuarantineReason string `json:"quarantine_reason,omitempty"`
+	// Encryption is set for client-side encrypted uploads, the object then only holds ciphertext
+	Encryption *Encryption `json:"encryption,omitempty"`
+	// StorageEncryption is the server-side encryption the object was written with, nil when the bucket default applies
+	StorageEncryption *StorageEncryption `json:"storage_encryption,omitempty"`
+	// PreviewStatus is one of the PreviewStatus* constants for the uploads that get previews
+	PreviewStatus string `json:"preview_status,omitempty"`
+}
+
+// Encryption is what a client needs, besides the key, to decrypt an upload
+type Encryption struct {
+	Algorithm string `json:"algorithm"`
+	// KeyHint identifies the key or how it is wrapped, never the key itself
+	KeyHint   string `json:"key_hint,omitempty"`
+	ChunkSize int    `json:"chunk_size"`
+}
+
+const (
+	StorageEncryptionSSES3  = "sse-s3"
+	StorageEncryptionSSEKMS = "sse-kms"
+	StorageEncryptionSSEC   = "sse-c"
+)
+
+// StorageEncryption records how the storage encrypts an object at rest, so key rotations can be audited
+type StorageEncryption struct {
+	// Mode is one of the StorageEncryption* constants
+	Mode string `json:"mode"`
+	// KeyID is the KMS key for sse-kms and the fingerprint of the master key for sse-c
+	KeyID string `json:"key_id,omitempty"`
+}
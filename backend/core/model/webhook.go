@@ -0,0 +1,71 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventUploadInitiated   = "upload.initiated"
+	EventUploadCompleted   = "upload.completed"
+	EventUploadDownloaded  = "upload.downloaded"
+	EventUploadDeleted     = "upload.deleted"
+	EventUploadRestored    = "upload.restored"
+	EventUploadPurged      = "upload.purged"
+	EventUploadQuarantined = "upload.quarantined"
+	EventUploadExpired     = "upload.expired"
+)
+
+var EventTypes = []string{
+	EventUploadInitiated,
+	EventUploadCompleted,
+	EventUploadDownloaded,
+	EventUploadDeleted,
+	EventUploadRestored,
+	EventUploadPurged,
+	EventUploadQuarantined,
+	EventUploadExpired,
+}
+
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusDead      = "dead"
+)
+
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Secret signs the deliveries, it is only returned when the webhook is created
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookEvent struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	UploadID  string          `json:"upload_id"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	WebhookID      string     `json:"webhook_id"`
+	EventID        string     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+
+	// filled when the delivery is claimed for sending
+	WebhookURL    string          `json:"-"`
+	WebhookSecret string          `json:"-"`
+	Payload       json.RawMessage `json:"-"`
+}
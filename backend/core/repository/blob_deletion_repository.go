@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"quickshare/core/model"
+	"time"
+)
+
+type BlobDeletionRepository interface {
+	// ClaimBlobDeletions returns up to limit due deletions and hides them from other workers for lease
+	ClaimBlobDeletions(limit int, lease time.Duration) ([]*model.BlobDeletion, error)
+	CompleteBlobDeletion(id int64) error
+	RetryBlobDeletion(id int64, nextAttemptAt time.Time, lastError string) error
+}
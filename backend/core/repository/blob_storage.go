@@ -1,11 +1,46 @@
 package repository
 
-import "time"
+import (
+	"io"
+	"quickshare/core/model"
+	"time"
+)
 
+type BlobObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// PresignedRequest is a presigned URL and the headers that were signed with it, the request fails without them
+type PresignedRequest struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// BlobStorageRepository stores the objects. The encryption given to the object
+// methods is the StorageEncryption recorded on the upload: an object is always
+// read, and its previews written, the way it was stored, whatever the current mode.
 type BlobStorageRepository interface {
-	GeneratePresignedUploadURL(objectKey string, expiresIn time.Duration) (string, error)
+	// GeneratePresignedUploadURL signs the Content-Disposition naming the object fileName, when it is set, with the
+	// upload: the client sends it along with the other headers and the object is served under that name
+	GeneratePresignedUploadURL(objectKey string, expiresIn time.Duration, fileName string) (*PresignedRequest, error)
+	// GeneratePresignedDownloadURL is for the objects that can't be read through the public URL (sse-kms, sse-c),
+	// the response names the file fileName when it is set
+	GeneratePresignedDownloadURL(objectKey string, encryption *model.StorageEncryption, expiresIn time.Duration, fileName string) (*PresignedRequest, error)
 	GetPublicURL(objectKey string) string
-	ObjectExists(objectKey string) (bool, error)
-	GetObjectMetadata(objectKey string) (map[string]string, error)
+	// StorageEncryption is the server-side encryption new objects are written with, nil for the bucket default
+	StorageEncryption() *model.StorageEncryption
+	ObjectExists(objectKey string, encryption *model.StorageEncryption) (bool, error)
+	GetObjectMetadata(objectKey string, encryption *model.StorageEncryption) (map[string]string, error)
+	// ReadRange returns up to length bytes of the object starting at offset, less when the object is shorter
+	ReadRange(objectKey string, encryption *model.StorageEncryption, offset int64, length int64) ([]byte, error)
+	// Open streams the whole object, the caller closes it
+	Open(objectKey string, encryption *model.StorageEncryption) (io.ReadCloser, error)
+	// Put stores a small object the server made itself (previews), uploads go through the presigned URLs
+	Put(objectKey string, encryption *model.StorageEncryption, content []byte, contentType string) error
 	Delete(objectKey string) error
-}
\ No newline at end of file
+	CheckBucket() error
+	// List returns one page of objects under prefix and the token of the next page ("" on the last one)
+	List(prefix string, continuationToken string) ([]BlobObject, string, error)
+}
@@ -0,0 +1,9 @@
+package repository
+
+import "quickshare/core/model"
+
+type PreviewRepository interface {
+	// SavePreview creates the preview of the upload in that size, or replaces it
+	SavePreview(preview *model.Preview) (*model.Preview, error)
+	GetPreview(uploadID string, size string) (*model.Preview, error)
+}
@@ -0,0 +1,16 @@
+package repository
+
+import "io"
+
+type ScanResult struct {
+	Clean bool
+	// Signature names what was found when the content isn't clean
+	Signature string
+}
+
+// Scanner inspects content for malware
+type Scanner interface {
+	Scan(content io.Reader) (ScanResult, error)
+	// Ping checks the scanner is reachable, it is used by the readiness probe
+	Ping() error
+}
@@ -0,0 +1,14 @@
+package repository
+
+import (
+	"errors"
+	"quickshare/core/model"
+)
+
+// ErrSlugTaken is returned when a short link is created with a slug that already exists
+var ErrSlugTaken = errors.New("slug is already taken")
+
+type ShortLinkRepository interface {
+	CreateShortLink(shortLink *model.ShortLink) (*model.ShortLink, error)
+	GetShortLinkBySlug(slug string) (*model.ShortLink, error)
+}
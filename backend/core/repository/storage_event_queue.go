@@ -0,0 +1,18 @@
+package repository
+
+import "time"
+
+// QueueMessage is a storage notification waiting in a queue
+type QueueMessage struct {
+	ID            string
+	ReceiptHandle string
+	Body          []byte
+}
+
+// StorageEventQueue is a queue receiving the bucket notifications (SQS or compatible)
+type StorageEventQueue interface {
+	// Receive waits up to wait for at most max messages, an empty result is not an error
+	Receive(max int, wait time.Duration) ([]QueueMessage, error)
+	// Ack removes a handled message so it isn't delivered again
+	Ack(message QueueMessage) error
+}
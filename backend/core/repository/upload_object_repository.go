@@ -1,12 +1,57 @@
 package repository
 
 import (
+	"errors"
 	"quickshare/core/model"
+	"time"
 )
 
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// UploadObjectFilter narrows ListUploadObjects, zero values are ignored
+type UploadObjectFilter struct {
+	OwnerID        string
+	Status         string
+	PreviewStatus  string
+	MimeType       string
+	MinSize        *int64
+	MaxSize        *int64
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	ExpiresAfter   time.Time
+	ExpiresBefore  time.Time
+	FileNamePrefix string
+	// Trashed lists soft deleted uploads instead of live ones, IncludeTrashed lists both
+	Trashed        bool
+	IncludeTrashed bool
+	DeletedBefore  time.Time
+}
+
 type UploadObjectRepository interface {
 	CreateUploadObject(uploadObject *model.UploadObject) (*model.UploadObject, error)
 	GetUploadObject(id string) (*model.UploadObject, error)
 	UpdateUploadObject(id string, uploadObject *model.UploadObject) (*model.UploadObject, error)
 	DeleteUploadObject(id string) error
+	// ListUploadObjects returns up to limit uploads, newest first, and the cursor of the next page ("" on the last one)
+	ListUploadObjects(filter UploadObjectFilter, cursor string, limit int) ([]*model.UploadObject, string, error)
+	FailStalePendingUploads(createdBefore time.Time) (int64, error)
+	// CreateUploadObjectAndPublish and UpdateUploadObjectAndPublish store the event with the change, in one transaction
+	CreateUploadObjectAndPublish(uploadObject *model.UploadObject, event *model.WebhookEvent) (*model.UploadObject, error)
+	UpdateUploadObjectAndPublish(id string, uploadObject *model.UploadObject, event *model.WebhookEvent) (*model.UploadObject, error)
+	// CreateUploadObjectsAndPublish creates every upload and stores every event in one transaction, all or none
+	CreateUploadObjectsAndPublish(uploadObjects []*model.UploadObject, events []*model.WebhookEvent) error
+	// TransitionUploadObject saves the upload, and the event unless nil, only while the row is live and in the from
+	// status. It returns sql.ErrNoRows when a concurrent change moved the upload on first
+	TransitionUploadObject(id string, from string, uploadObject *model.UploadObject, event *model.WebhookEvent) (*model.UploadObject, error)
+	// RejectUploadObject saves the upload like TransitionUploadObject and queues the deletion of its object in the same transaction
+	RejectUploadObject(id string, from string, uploadObject *model.UploadObject) (*model.UploadObject, error)
+	// RecordScanFailure and RecordPreviewFailure count a failed worker run on the upload, they return the failures so far
+	RecordScanFailure(id string, lastError string) (int, error)
+	RecordPreviewFailure(id string, lastError string) (int, error)
+	// PurgeUploadObject deletes a trashed row, queues its object for deletion and stores the event in one transaction
+	PurgeUploadObject(id string, objectKey string, event *model.WebhookEvent) error
+	// FindUploadObjectsByObjectKeys returns the uploads, trashed ones included, stored under any of the keys
+	FindUploadObjectsByObjectKeys(objectKeys []string) ([]*model.UploadObject, error)
+	// ListBundleMembers returns the members of a bundle, trashed ones included, sorted by file name
+	ListBundleMembers(bundleID string) ([]*model.UploadObject, error)
 }
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"quickshare/core/model"
+	"time"
+)
+
+type EventPublisher interface {
+	// PublishEvent stores the event and one pending delivery per subscribed webhook
+	PublishEvent(event *model.WebhookEvent) error
+}
+
+type WebhookRepository interface {
+	EventPublisher
+
+	CreateWebhook(webhook *model.Webhook) (*model.Webhook, error)
+	GetWebhook(id string) (*model.Webhook, error)
+	ListWebhooks() ([]*model.Webhook, error)
+	DeleteWebhook(id string) error
+
+	ListWebhookDeliveries(webhookID string, status string, limit int) ([]*model.WebhookDelivery, error)
+	// RedeliverWebhookDelivery puts a delivered or dead delivery back in the queue
+	RedeliverWebhookDelivery(id int64) (*model.WebhookDelivery, error)
+
+	// ClaimWebhookDeliveries returns up to limit due deliveries and hides them from other dispatchers for lease
+	ClaimWebhookDeliveries(limit int, lease time.Duration) ([]*model.WebhookDelivery, error)
+	MarkWebhookDeliveryDelivered(id int64, statusCode int) error
+	MarkWebhookDeliveryFailed(id int64, status string, nextAttemptAt time.Time, statusCode int, lastError string) error
+}
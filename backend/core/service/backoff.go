@@ -0,0 +1,26 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// backoffDelay doubles initial after every attempt, up to max
+func backoffDelay(attempts int, initial, max time.Duration) time.Duration {
+	delay := initial
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
+
+// randomID returns prefix followed by 32 random hex characters
+func randomID(prefix string) string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return prefix + hex.EncodeToString(buf)
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"log"
+	"quickshare/core/repository"
+	"time"
+)
+
+const (
+	blobDeletionBatchSize  = 100
+	blobDeletionLease      = 5 * time.Minute
+	blobDeletionRetryDelay = 30 * time.Second
+	blobDeletionMaxDelay   = 6 * time.Hour
+)
+
+// BlobDeletionWorker drains the blob_deletions outbox, a delete is only
+// removed from it once the storage confirmed it, so failures are retried forever
+type BlobDeletionWorker struct {
+	repository  repository.BlobDeletionRepository
+	blobStorage repository.BlobStorageRepository
+	interval    time.Duration
+}
+
+func NewBlobDeletionWorker(repo repository.BlobDeletionRepository, blobStorage repository.BlobStorageRepository, interval time.Duration) *BlobDeletionWorker {
+	return &BlobDeletionWorker{
+		repository:  repo,
+		blobStorage: blobStorage,
+		interval:    interval,
+	}
+}
+
+func (w *BlobDeletionWorker) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.RunOnce()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *BlobDeletionWorker) RunOnce() {
+	deletions, err := w.repository.ClaimBlobDeletions(blobDeletionBatchSize, blobDeletionLease)
+	if err != nil {
+		log.Println("blob deletion: error claiming deletions", err)
+		return
+	}
+
+	for _, deletion := range deletions {
+		if err := w.blobStorage.Delete(deletion.ObjectKey); err != nil {
+			nextAttemptAt := time.Now().Add(backoffDelay(deletion.Attempts, blobDeletionRetryDelay, blobDeletionMaxDelay))
+			log.Printf("blob deletion: attempt %d for %s failed, retrying at %s: %v", deletion.Attempts, deletion.ObjectKey, nextAttemptAt.Format(time.RFC3339), err)
+			if err := w.repository.RetryBlobDeletion(deletion.ID, nextAttemptAt, err.Error()); err != nil {
+				log.Println("blob deletion: error scheduling retry", deletion.ID, err)
+			}
+			continue
+		}
+
+		if err := w.repository.CompleteBlobDeletion(deletion.ID); err != nil {
+			// the lease runs out and the delete is replayed, S3 deletes are idempotent
+			log.Println("blob deletion: error completing deletion", deletion.ID, err)
+		}
+	}
+}
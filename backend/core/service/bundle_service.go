@@ -0,0 +1,369 @@
+package service
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+	"quickshare/pkg/objectkey"
+	"strings"
+	"time"
+)
+
+// MaxBundleMembers caps the files of a bundle, each one is a row and a presigned URL
+const MaxBundleMembers = 1000
+
+var (
+	ErrInvalidBundle   = errors.New("invalid bundle")
+	ErrNotABundle      = errors.New("upload is not a bundle")
+	ErrBundleNotReady  = errors.New("bundle members are not all available yet")
+	ErrBundleConfirmed = errors.New("bundle is already confirmed")
+)
+
+type BundleFile struct {
+	// FileName is the path of the file inside the bundle, e.g. "docs/report.pdf"
+	FileName   string            `json:"file_name"`
+	FileSize   int64             `json:"file_size"`
+	MimeType   string            `json:"mime_type"`
+	Encryption *model.Encryption `json:"encryption,omitempty"`
+}
+
+type BundleRequest struct {
+	Name      string       `json:"name"`
+	OwnerID   string       `json:"owner_id,omitempty"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	Files     []BundleFile `json:"files"`
+}
+
+// BundleMemberUpload is the upload URL of one member, the file name tells which
+type BundleMemberUpload struct {
+	FileName string `json:"file_name"`
+	*UploadResponse
+}
+
+type BundleResponse struct {
+	ID        string               `json:"id"`
+	ExpiresAt time.Time            `json:"expires_at"`
+	Members   []BundleMemberUpload `json:"members"`
+}
+
+// BundleService groups uploads in bundles: a parent record without object and
+// member uploads that go through the usual upload and confirm flow
+type BundleService struct {
+	repository          repository.UploadObjectRepository
+	blobStorage         repository.BlobStorageRepository
+	uploadObjectService *UploadObjectService
+}
+
+func NewBundleService(repo repository.UploadObjectRepository, blobStorage repository.BlobStorageRepository, uploadObjectService *UploadObjectService) *BundleService {
+	return &BundleService{
+		repository:          repo,
+		blobStorage:         blobStorage,
+		uploadObjectService: uploadObjectService,
+	}
+}
+
+// CreateBundle records the bundle and initiates the upload of every member
+func (s *BundleService) CreateBundle(request *BundleRequest) (*BundleResponse, error) {
+	if err := s.validate(request); err != nil {
+		return nil, err
+	}
+
+	bundle := &model.UploadObject{
+		ID:        randomID(""),
+		Kind:      model.UploadKindBundle,
+		FileName:  archiveName(request.Name),
+		MimeType:  "application/zip",
+		Status:    model.UploadStatusPending,
+		OwnerID:   request.OwnerID,
+		ExpiresAt: request.ExpiresAt,
+	}
+	// no object is ever stored there, the key only keeps the bundle apart from the uploads
+	bundle.ObjectKey = "bundles/" + bundle.ID
+	for _, file := range request.Files {
+		bundle.FileSize += file.FileSize
+	}
+	if bundle.ExpiresAt.IsZero() {
+		bundle.ExpiresAt = time.Now().Add(s.uploadObjectService.config.DefaultTTL)
+	}
+
+	now := time.Now().UTC()
+	bundle.CreatedAt, bundle.UpdatedAt = now, now
+	event, err := newEvent(model.EventUploadInitiated, bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadObjects := []*model.UploadObject{bundle}
+	events := []*model.WebhookEvent{event}
+	uploads := make([]*repository.PresignedRequest, 0, len(request.Files))
+	for _, file := range request.Files {
+		member := &model.UploadObject{
+			ID:         randomID(""),
+			BundleID:   bundle.ID,
+			FileName:   file.FileName,
+			FileSize:   file.FileSize,
+			MimeType:   file.MimeType,
+			OwnerID:    bundle.OwnerID,
+			ExpiresAt:  bundle.ExpiresAt,
+			Encryption: file.Encryption,
+		}
+		upload, event, err := s.uploadObjectService.prepareUpload(member)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initiate the upload of %s: %w", file.FileName, err)
+		}
+		uploadObjects = append(uploadObjects, member)
+		events = append(events, event)
+		uploads = append(uploads, upload)
+	}
+
+	// the bundle and its members are saved together, a failure leaves none of them behind
+	if err := s.repository.CreateUploadObjectsAndPublish(uploadObjects, events); err != nil {
+		return nil, fmt.Errorf("failed to create bundle: %w", err)
+	}
+
+	response := &BundleResponse{ID: bundle.ID, ExpiresAt: bundle.ExpiresAt}
+	for i, member := range uploadObjects[1:] {
+		response.Members = append(response.Members, BundleMemberUpload{FileName: member.FileName, UploadResponse: uploadResponse(member, uploads[i])})
+	}
+
+	return response, nil
+}
+
+func (s *BundleService) validate(request *BundleRequest) error {
+	if strings.TrimSpace(request.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidBundle)
+	}
+	if len(request.Files) == 0 || len(request.Files) > MaxBundleMembers {
+		return fmt.Errorf("%w: a bundle holds between 1 and %d files", ErrInvalidBundle, MaxBundleMembers)
+	}
+	if err := s.uploadObjectService.checkExpiry(request.ExpiresAt); err != nil {
+		return fmt.Errorf("%w: expires_at %v", ErrInvalidBundle, err)
+	}
+
+	seen := make(map[string]bool, len(request.Files))
+	for i, file := range request.Files {
+		name, err := memberPath(file.FileName)
+		if err != nil {
+			return fmt.Errorf("%w: files[%d]: %v", ErrInvalidBundle, i, err)
+		}
+		if seen[name] {
+			return fmt.Errorf("%w: files[%d]: %s appears twice", ErrInvalidBundle, i, name)
+		}
+		seen[name] = true
+		request.Files[i].FileName = name
+
+		if file.FileSize < 0 {
+			return fmt.Errorf("%w: files[%d]: file_size must not be negative", ErrInvalidBundle, i)
+		}
+		if maxSize := s.uploadObjectService.config.MaxFileSize; maxSize > 0 && file.FileSize > maxSize {
+			return fmt.Errorf("%w: %s", ErrFileTooLarge, name)
+		}
+	}
+	return nil
+}
+
+// memberPath cleans the path of a member, it must stay inside the archive and
+// every segment must pass the rules of a plain file name
+func memberPath(name string) (string, error) {
+	name = objectkey.Normalize(name)
+	if name == "" || strings.HasPrefix(name, "/") {
+		return "", errors.New("file_name must be a relative path")
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == ".." {
+			return "", errors.New("file_name must not contain ..")
+		}
+	}
+	cleaned := path.Clean(name)
+	for _, segment := range strings.Split(cleaned, "/") {
+		if err := checkFileName(segment); err != nil {
+			return "", fmt.Errorf("file_name %v", err)
+		}
+	}
+	return cleaned, nil
+}
+
+func archiveName(name string) string {
+	name = path.Base(strings.ReplaceAll(strings.TrimSpace(name), `\`, "/"))
+	if !strings.EqualFold(path.Ext(name), ".zip") {
+		name += ".zip"
+	}
+	return name
+}
+
+// getBundle returns the bundle id, trashed or not
+func (s *BundleService) getBundle(id string) (*model.UploadObject, error) {
+	bundle, err := s.repository.GetUploadObject(id)
+	if err != nil {
+		return nil, err
+	}
+	if bundle.Kind != model.UploadKindBundle {
+		return nil, ErrNotABundle
+	}
+	return bundle, nil
+}
+
+// ConfirmBundle confirms the members still pending and completes the bundle.
+// Members refused by the content policy stay out of it, other failures abort.
+func (s *BundleService) ConfirmBundle(id string) (*model.UploadObject, error) {
+	bundle, err := s.getBundle(id)
+	if err != nil {
+		return nil, err
+	}
+	if bundle.DeletedAt != nil {
+		return nil, ErrUploadDeleted
+	}
+	if bundle.Status != model.UploadStatusPending {
+		return nil, ErrBundleConfirmed
+	}
+
+	members, err := s.repository.ListBundleMembers(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		if member.Status != model.UploadStatusPending || member.DeletedAt != nil {
+			continue
+		}
+		_, err := s.uploadObjectService.ConfirmUpload(member.ID)
+		if errors.Is(err, ErrMimeTypeNotAllowed) || errors.Is(err, ErrUploadNotPending) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to confirm %s: %w", member.FileName, err)
+		}
+	}
+
+	now := time.Now().UTC()
+	bundle.ConfirmedAt = &now
+	bundle.Status = model.UploadStatusCompleted
+	return s.uploadObjectService.updateAndPublish(id, bundle, model.EventUploadCompleted)
+}
+
+// Members lists the live members of a bundle
+func (s *BundleService) Members(id string) ([]*model.UploadObject, error) {
+	bundle, err := s.getBundle(id)
+	if err != nil {
+		return nil, err
+	}
+	if bundle.DeletedAt != nil {
+		return nil, ErrUploadDeleted
+	}
+	if time.Now().After(bundle.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+	return s.liveMembers(bundle.ID)
+}
+
+// liveMembers lists the members of a bundle that are not in the trash
+func (s *BundleService) liveMembers(bundleID string) ([]*model.UploadObject, error) {
+	members, err := s.repository.ListBundleMembers(bundleID)
+	if err != nil {
+		return nil, err
+	}
+	live := make([]*model.UploadObject, 0, len(members))
+	for _, member := range members {
+		if member.DeletedAt == nil {
+			live = append(live, member)
+		}
+	}
+	return live, nil
+}
+
+// BundleArchive streams the zip of a bundle
+type BundleArchive struct {
+	Name        string
+	members     []*model.UploadObject
+	blobStorage repository.BlobStorageRepository
+}
+
+// OpenArchive checks the bundle can be downloaded, the archive is only written by WriteTo
+func (s *BundleService) OpenArchive(id string) (*BundleArchive, error) {
+	bundle, err := s.getBundle(id)
+	if err != nil {
+		return nil, err
+	}
+	if bundle.DeletedAt != nil {
+		return nil, ErrUploadDeleted
+	}
+	if bundle.Status != model.UploadStatusCompleted {
+		return nil, ErrUploadNotCompleted
+	}
+	if time.Now().After(bundle.ExpiresAt) {
+		return nil, ErrUploadExpired
+	}
+
+	members, err := s.liveMembers(bundle.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &BundleArchive{Name: bundle.FileName, blobStorage: s.blobStorage}
+	for _, member := range members {
+		switch member.Status {
+		case model.UploadStatusCompleted:
+			archive.members = append(archive.members, member)
+		case model.UploadStatusPending, model.UploadStatusScanning:
+			return nil, ErrBundleNotReady
+		default:
+			// rejected, quarantined and failed members can't be downloaded on their own either
+			log.Printf("bundle %s: leaving %s out of the archive, it is %s", id, member.FileName, member.Status)
+		}
+	}
+
+	s.uploadObjectService.publish(model.EventUploadDownloaded, bundle)
+	return archive, nil
+}
+
+// WriteTo writes the zip to w as the member objects are read, nothing is buffered on disk.
+// Members are stored without compression, most shared files are compressed already,
+// and encrypted members are written as the ciphertext the storage holds.
+func (a *BundleArchive) WriteTo(w io.Writer) (int64, error) {
+	counter := &countingWriter{writer: w}
+	archive := zip.NewWriter(counter)
+
+	for _, member := range a.members {
+		modified := member.CreatedAt
+		if member.ConfirmedAt != nil {
+			modified = *member.ConfirmedAt
+		}
+
+		entry, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     member.FileName,
+			Method:   zip.Store,
+			Modified: modified,
+		})
+		if err != nil {
+			return counter.written, err
+		}
+
+		object, err := a.blobStorage.Open(member.ObjectKey, member.StorageEncryption)
+		if err != nil {
+			return counter.written, fmt.Errorf("failed to open %s: %w", member.FileName, err)
+		}
+		_, err = io.Copy(entry, object)
+		object.Close()
+		if err != nil {
+			return counter.written, fmt.Errorf("failed to copy %s: %w", member.FileName, err)
+		}
+	}
+
+	err := archive.Close()
+	return counter.written, err
+}
+
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.writer.Write(p)
+	c.written += int64(n)
+	return n, err
+}
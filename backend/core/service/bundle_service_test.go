@@ -0,0 +1,208 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"quickshare/core/model"
+	"testing"
+	"time"
+)
+
+func TestBundleService_CreateConfirmAndArchive(t *testing.T) {
+	repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{}}
+	blobStorage := &fakeBlobStorage{contents: map[string][]byte{}}
+	events := &fakeEventPublisher{}
+	uploadObjectService := NewUploadObjectService(repo, blobStorage, events, UploadObjectServiceConfig{
+		DefaultTTL:        time.Hour,
+		DeleteGracePeriod: time.Hour,
+		MimePolicy:        MimePolicy{Deny: []string{"application/x-elf"}},
+	})
+	bundleService := NewBundleService(repo, blobStorage, uploadObjectService)
+
+	contents := map[string][]byte{
+		"docs/report.pdf": []byte("%PDF-1.7\nreport"),
+		"notes.txt":       []byte("plain notes"),
+		"bin/tool":        []byte("\x7fELF\x02\x01\x01 binary"),
+	}
+	response, err := bundleService.CreateBundle(&BundleRequest{
+		Name: "project",
+		Files: []BundleFile{
+			{FileName: "docs/./report.pdf", FileSize: 15, MimeType: "application/pdf"},
+			{FileName: "notes.txt", FileSize: 11, MimeType: "text/plain"},
+			{FileName: "bin/tool", FileSize: 15, MimeType: "application/octet-stream"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(response.Members) != 3 || response.Members[0].FileName != "docs/report.pdf" || response.Members[0].UploadURL == "" {
+		t.Fatalf("expected the upload URL of every member, got %+v", response.Members)
+	}
+
+	bundle := repo.uploadObjects[response.ID]
+	if bundle.Kind != model.UploadKindBundle || bundle.FileName != "project.zip" || bundle.FileSize != 41 {
+		t.Errorf("expected the project.zip bundle of 41 bytes, got %+v", bundle)
+	}
+	for _, member := range response.Members {
+		blobStorage.contents[member.ObjectKey] = contents[member.FileName]
+	}
+
+	if _, err := uploadObjectService.GetDownloadURL(response.ID); !errors.Is(err, ErrUploadIsBundle) {
+		t.Errorf("expected ErrUploadIsBundle for the download URL of a bundle, got %v", err)
+	}
+	if _, err := bundleService.OpenArchive(response.ID); err == nil {
+		t.Error("expected the archive of an unconfirmed bundle to be refused")
+	}
+
+	// confirming the bundle confirms its members, the binary is rejected by the policy
+	confirmed, err := bundleService.ConfirmBundle(response.ID)
+	if err != nil {
+		t.Fatalf("unexpected error confirming: %v", err)
+	}
+	if confirmed.Status != model.UploadStatusCompleted {
+		t.Errorf("expected a completed bundle, got %s", confirmed.Status)
+	}
+	if _, err := bundleService.ConfirmBundle(response.ID); !errors.Is(err, ErrBundleConfirmed) {
+		t.Errorf("expected ErrBundleConfirmed, got %v", err)
+	}
+
+	members, err := bundleService.Members(response.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	statuses := map[string]string{}
+	for _, member := range members {
+		statuses[member.FileName] = member.Status
+	}
+	if statuses["notes.txt"] != model.UploadStatusCompleted || statuses["bin/tool"] != model.UploadStatusRejected {
+		t.Errorf("expected notes.txt completed and bin/tool rejected, got %v", statuses)
+	}
+
+	archive, err := bundleService.OpenArchive(response.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	written, err := archive.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error writing the archive: %v", err)
+	}
+	if written != int64(buf.Len()) {
+		t.Errorf("expected WriteTo to count %d bytes, got %d", buf.Len(), written)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	var names []string
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+		entry, _ := file.Open()
+		content, _ := io.ReadAll(entry)
+		entry.Close()
+		if !bytes.Equal(content, contents[file.Name]) {
+			t.Errorf("expected %s to hold %q, got %q", file.Name, contents[file.Name], content)
+		}
+	}
+	if len(names) != 2 || names[0] != "docs/report.pdf" || names[1] != "notes.txt" {
+		t.Errorf("expected the completed members only, got %v", names)
+	}
+}
+
+func TestBundleService_DeleteAndRestoreCascade(t *testing.T) {
+	repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{}}
+	blobStorage := &fakeBlobStorage{contents: map[string][]byte{}}
+	uploadObjectService := NewUploadObjectService(repo, blobStorage, &fakeEventPublisher{}, UploadObjectServiceConfig{
+		DefaultTTL:        time.Hour,
+		DeleteGracePeriod: time.Hour,
+	})
+	bundleService := NewBundleService(repo, blobStorage, uploadObjectService)
+
+	response, err := bundleService.CreateBundle(&BundleRequest{
+		Name:  "photos.zip",
+		Files: []BundleFile{{FileName: "a.jpg", FileSize: 1}, {FileName: "b.jpg", FileSize: 1}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// b.jpg was trashed on its own before the bundle
+	earlier := time.Now().Add(-time.Minute)
+	repo.uploadObjects[response.Members[1].ID].DeletedAt = &earlier
+
+	if _, err := uploadObjectService.DeleteUploadObject(response.ID); err != nil {
+		t.Fatalf("unexpected error deleting: %v", err)
+	}
+	if repo.uploadObjects[response.Members[0].ID].DeletedAt == nil {
+		t.Error("expected the members to be trashed with the bundle")
+	}
+	if _, err := bundleService.Members(response.ID); !errors.Is(err, ErrUploadDeleted) {
+		t.Errorf("expected %v listing a trashed bundle, got %v", ErrUploadDeleted, err)
+	}
+	if _, err := bundleService.OpenArchive(response.ID); !errors.Is(err, ErrUploadDeleted) {
+		t.Errorf("expected %v zipping a trashed bundle, got %v", ErrUploadDeleted, err)
+	}
+
+	if _, err := uploadObjectService.RestoreUploadObject(response.ID); err != nil {
+		t.Fatalf("unexpected error restoring: %v", err)
+	}
+	if repo.uploadObjects[response.Members[0].ID].DeletedAt != nil {
+		t.Error("expected a.jpg to come back with the bundle")
+	}
+	if repo.uploadObjects[response.Members[1].ID].DeletedAt == nil {
+		t.Error("expected b.jpg to stay in the trash")
+	}
+	members, err := bundleService.Members(response.ID)
+	if err != nil {
+		t.Fatalf("unexpected error listing: %v", err)
+	}
+	if len(members) != 1 || members[0].ID != response.Members[0].ID {
+		t.Errorf("expected only a.jpg to be listed, got %d members", len(members))
+	}
+
+	repo.uploadObjects[response.ID].ExpiresAt = earlier
+	if _, err := bundleService.Members(response.ID); !errors.Is(err, ErrUploadExpired) {
+		t.Errorf("expected %v listing an expired bundle, got %v", ErrUploadExpired, err)
+	}
+}
+
+func TestBundleService_InvalidRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		request BundleRequest
+		wantErr error
+	}{
+		{name: "no name", request: BundleRequest{Files: []BundleFile{{FileName: "a"}}}, wantErr: ErrInvalidBundle},
+		{name: "no files", request: BundleRequest{Name: "empty"}, wantErr: ErrInvalidBundle},
+		{name: "path traversal", request: BundleRequest{Name: "x", Files: []BundleFile{{FileName: "../etc/passwd"}}}, wantErr: ErrInvalidBundle},
+		{name: "absolute path", request: BundleRequest{Name: "x", Files: []BundleFile{{FileName: "/etc/passwd"}}}, wantErr: ErrInvalidBundle},
+		{name: "backslash", request: BundleRequest{Name: "x", Files: []BundleFile{{FileName: `docs\report.pdf`}}}, wantErr: ErrInvalidBundle},
+		{name: "control character", request: BundleRequest{Name: "x", Files: []BundleFile{{FileName: "docs/report\r\n.pdf"}}}, wantErr: ErrInvalidBundle},
+		{name: "only a dot", request: BundleRequest{Name: "x", Files: []BundleFile{{FileName: "./"}}}, wantErr: ErrInvalidBundle},
+		{name: "duplicate", request: BundleRequest{Name: "x", Files: []BundleFile{{FileName: "a/b"}, {FileName: "a//b"}}}, wantErr: ErrInvalidBundle},
+		{name: "member too large", request: BundleRequest{Name: "x", Files: []BundleFile{{FileName: "big", FileSize: 2048}}}, wantErr: ErrFileTooLarge},
+		{
+			// the first member is fine, the bundle and it must not be left behind
+			name:    "member with an unsupported encryption",
+			request: BundleRequest{Name: "x", Files: []BundleFile{{FileName: "a"}, {FileName: "b", Encryption: &model.Encryption{Algorithm: "rot13"}}}},
+			wantErr: ErrInvalidEncryption,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{}}
+			uploadObjectService := NewUploadObjectService(repo, &fakeBlobStorage{}, &fakeEventPublisher{}, UploadObjectServiceConfig{MaxFileSize: 1024})
+
+			_, err := NewBundleService(repo, &fakeBlobStorage{}, uploadObjectService).CreateBundle(&tt.request)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+			if len(repo.uploadObjects) != 0 {
+				t.Errorf("expected nothing to be created, got %d uploads", len(repo.uploadObjects))
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"math"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+	web "quickshare/pkg"
+	"sort"
+	"time"
+)
+
+type fakeUploadObjectRepository struct {
+	repository.UploadObjectRepository
+
+	uploadObjects map[string]*model.UploadObject
+	// events are the types of the events saved along with the changes
+	events []string
+	// failures counts the failed worker runs by "scan/" or "preview/" and upload ID
+	failures map[string]int
+	// blobDeletions are the object keys queued for the blob deletion worker
+	blobDeletions []string
+}
+
+func (f *fakeUploadObjectRepository) CreateUploadObject(uploadObject *model.UploadObject) (*model.UploadObject, error) {
+	created := *uploadObject
+	f.uploadObjects[uploadObject.ID] = &created
+	return uploadObject, nil
+}
+
+func (f *fakeUploadObjectRepository) GetUploadObject(id string) (*model.UploadObject, error) {
+	uploadObject, ok := f.uploadObjects[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *uploadObject
+	return &copied, nil
+}
+
+func (f *fakeUploadObjectRepository) UpdateUploadObject(id string, uploadObject *model.UploadObject) (*model.UploadObject, error) {
+	updated := *uploadObject
+	f.uploadObjects[id] = &updated
+	return uploadObject, nil
+}
+
+func (f *fakeUploadObjectRepository) CreateUploadObjectAndPublish(uploadObject *model.UploadObject, event *model.WebhookEvent) (*model.UploadObject, error) {
+	f.events = append(f.events, event.Type)
+	return f.CreateUploadObject(uploadObject)
+}
+
+func (f *fakeUploadObjectRepository) CreateUploadObjectsAndPublish(uploadObjects []*model.UploadObject, events []*model.WebhookEvent) error {
+	for _, uploadObject := range uploadObjects {
+		f.CreateUploadObject(uploadObject)
+	}
+	for _, event := range events {
+		f.events = append(f.events, event.Type)
+	}
+	return nil
+}
+
+func (f *fakeUploadObjectRepository) UpdateUploadObjectAndPublish(id string, uploadObject *model.UploadObject, event *model.WebhookEvent) (*model.UploadObject, error) {
+	f.events = append(f.events, event.Type)
+	return f.UpdateUploadObject(id, uploadObject)
+}
+
+func (f *fakeUploadObjectRepository) TransitionUploadObject(id string, from string, uploadObject *model.UploadObject, event *model.WebhookEvent) (*model.UploadObject, error) {
+	stored, ok := f.uploadObjects[id]
+	if !ok || stored.Status != from || stored.DeletedAt != nil {
+		return nil, sql.ErrNoRows
+	}
+	if event != nil {
+		f.events = append(f.events, event.Type)
+	}
+	return f.UpdateUploadObject(id, uploadObject)
+}
+
+func (f *fakeUploadObjectRepository) RejectUploadObject(id string, from string, uploadObject *model.UploadObject) (*model.UploadObject, error) {
+	updated, err := f.TransitionUploadObject(id, from, uploadObject, nil)
+	if err != nil {
+		return nil, err
+	}
+	f.blobDeletions = append(f.blobDeletions, uploadObject.ObjectKey)
+	return updated, nil
+}
+
+func (f *fakeUploadObjectRepository) ListUploadObjects(filter repository.UploadObjectFilter, cursor string, limit int) ([]*model.UploadObject, string, error) {
+	var found []*model.UploadObject
+	for _, uploadObject := range f.uploadObjects {
+		trashed := uploadObject.DeletedAt != nil
+		if filter.Trashed != trashed && !filter.IncludeTrashed {
+			continue
+		}
+		if !filter.DeletedBefore.IsZero() && (!trashed || !uploadObject.DeletedAt.Before(filter.DeletedBefore)) {
+			continue
+		}
+		if !filter.ExpiresBefore.IsZero() && !uploadObject.ExpiresAt.Before(filter.ExpiresBefore) {
+			continue
+		}
+		if (filter.Status == "" || uploadObject.Status == filter.Status) && (filter.PreviewStatus == "" || uploadObject.PreviewStatus == filter.PreviewStatus) {
+			copied := *uploadObject
+			found = append(found, &copied)
+		}
+	}
+	return found, "", nil
+}
+
+func (f *fakeUploadObjectRepository) FailStalePendingUploads(createdBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeUploadObjectRepository) RecordScanFailure(id string, lastError string) (int, error) {
+	return f.recordFailure("scan/" + id)
+}
+
+func (f *fakeUploadObjectRepository) RecordPreviewFailure(id string, lastError string) (int, error) {
+	return f.recordFailure("preview/" + id)
+}
+
+func (f *fakeUploadObjectRepository) recordFailure(key string) (int, error) {
+	if f.failures == nil {
+		f.failures = map[string]int{}
+	}
+	f.failures[key]++
+	return f.failures[key], nil
+}
+
+func (f *fakeUploadObjectRepository) FindUploadObjectsByObjectKeys(objectKeys []string) ([]*model.UploadObject, error) {
+	var found []*model.UploadObject
+	for _, uploadObject := range f.uploadObjects {
+		for _, key := range objectKeys {
+			if uploadObject.ObjectKey == key {
+				copied := *uploadObject
+				found = append(found, &copied)
+				break
+			}
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeUploadObjectRepository) ListBundleMembers(bundleID string) ([]*model.UploadObject, error) {
+	var members []*model.UploadObject
+	for _, uploadObject := range f.uploadObjects {
+		if uploadObject.BundleID == bundleID {
+			copied := *uploadObject
+			members = append(members, &copied)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].FileName < members[j].FileName })
+	return members, nil
+}
+
+type fakeBlobStorage struct {
+	repository.BlobStorageRepository
+
+	// contents of the objects, a missing key reads as a small PDF
+	contents map[string][]byte
+	deleted  []string
+	// encryption is the server-side encryption of new objects, sse-c adds the customer key headers to the requests
+	encryption *model.StorageEncryption
+	// openErr fails every Open, like an unreachable storage
+	openErr error
+	// objects are listed under every prefix, when set ObjectExists only finds them
+	objects []repository.BlobObject
+}
+
+func (f *fakeBlobStorage) GeneratePresignedUploadURL(objectKey string, expiresIn time.Duration, fileName string) (*repository.PresignedRequest, error) {
+	presigned := f.presign(objectKey, f.encryption)
+	if presigned.Headers == nil {
+		presigned.Headers = map[string]string{}
+	}
+	presigned.Headers["Content-Disposition"] = web.ContentDisposition("attachment", fileName)
+	return presigned, nil
+}
+
+func (f *fakeBlobStorage) GeneratePresignedDownloadURL(objectKey string, encryption *model.StorageEncryption, expiresIn time.Duration, fileName string) (*repository.PresignedRequest, error) {
+	return f.presign(objectKey, encryption), nil
+}
+
+func (f *fakeBlobStorage) presign(objectKey string, encryption *model.StorageEncryption) *repository.PresignedRequest {
+	presigned := &repository.PresignedRequest{URL: "https://storage.test/" + objectKey + "?X-Amz-Signature=test"}
+	if encryption != nil && encryption.Mode == model.StorageEncryptionSSEC {
+		presigned.Headers = map[string]string{"X-Amz-Server-Side-Encryption-Customer-Key": "test"}
+	}
+	return presigned
+}
+
+func (f *fakeBlobStorage) StorageEncryption() *model.StorageEncryption {
+	return f.encryption
+}
+
+func (f *fakeBlobStorage) ObjectExists(objectKey string, encryption *model.StorageEncryption) (bool, error) {
+	if f.objects == nil {
+		return true, nil
+	}
+	for _, object := range f.objects {
+		if object.Key == objectKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeBlobStorage) List(prefix string, continuationToken string) ([]repository.BlobObject, string, error) {
+	return f.objects, "", nil
+}
+
+func (f *fakeBlobStorage) GetObjectMetadata(objectKey string, encryption *model.StorageEncryption) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func (f *fakeBlobStorage) ReadRange(objectKey string, encryption *model.StorageEncryption, offset int64, length int64) ([]byte, error) {
+	content, ok := f.contents[objectKey]
+	if !ok {
+		content = []byte("%PDF-1.7\n")
+	}
+	return content[offset:min(offset+length, int64(len(content)))], nil
+}
+
+func (f *fakeBlobStorage) Open(objectKey string, encryption *model.StorageEncryption) (io.ReadCloser, error) {
+	if f.openErr != nil {
+		return nil, f.openErr
+	}
+	content, _ := f.ReadRange(objectKey, encryption, 0, math.MaxInt32)
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+func (f *fakeBlobStorage) Put(objectKey string, encryption *model.StorageEncryption, content []byte, contentType string) error {
+	if f.contents == nil {
+		f.contents = map[string][]byte{}
+	}
+	f.contents[objectKey] = content
+	return nil
+}
+
+func (f *fakeBlobStorage) GetPublicURL(objectKey string) string {
+	return "https://storage.test/" + objectKey
+}
+
+func (f *fakeBlobStorage) Delete(objectKey string) error {
+	f.deleted = append(f.deleted, objectKey)
+	return nil
+}
+
+type fakePreviewRepository struct {
+	previews map[string]*model.Preview
+}
+
+func (f *fakePreviewRepository) SavePreview(preview *model.Preview) (*model.Preview, error) {
+	if f.previews == nil {
+		f.previews = map[string]*model.Preview{}
+	}
+	saved := *preview
+	f.previews[preview.UploadID+"/"+preview.Size] = &saved
+	return preview, nil
+}
+
+func (f *fakePreviewRepository) GetPreview(uploadID string, size string) (*model.Preview, error) {
+	preview, ok := f.previews[uploadID+"/"+size]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *preview
+	return &copied, nil
+}
+
+type fakeEventPublisher struct {
+	events []string
+}
+
+func (f *fakeEventPublisher) PublishEvent(event *model.WebhookEvent) error {
+	f.events = append(f.events, event.Type)
+	return nil
+}
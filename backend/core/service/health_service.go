@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	HealthStatusUp   = "up"
+	HealthStatusDown = "down"
+)
+
+// readinessTimeout bounds a readiness report, a hanging dependency is reported down instead of blocking /readyz
+const readinessTimeout = 5 * time.Second
+
+type HealthCheck func() error
+
+type DependencyHealth struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status       string                      `json:"status"`
+	CheckedAt    time.Time                   `json:"checked_at"`
+	Dependencies map[string]DependencyHealth `json:"dependencies"`
+}
+
+type HealthService struct {
+	checks  map[string]HealthCheck
+	timeout time.Duration
+}
+
+func NewHealthService() *HealthService {
+	return &HealthService{checks: make(map[string]HealthCheck), timeout: readinessTimeout}
+}
+
+// Register adds a named dependency to the readiness report
+func (s *HealthService) Register(name string, check HealthCheck) {
+	s.checks[name] = check
+}
+
+type checkResult struct {
+	name   string
+	health DependencyHealth
+}
+
+// Readiness runs every registered check concurrently and reports "down" if any of them fails.
+// Checks still running at the deadline are reported down, they finish in the background.
+func (s *HealthService) Readiness() *HealthReport {
+	report := &HealthReport{
+		Status:       HealthStatusUp,
+		CheckedAt:    time.Now().UTC(),
+		Dependencies: make(map[string]DependencyHealth, len(s.checks)),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	// buffered, the checks that miss the deadline don't block on it
+	results := make(chan checkResult, len(s.checks))
+	for name, check := range s.checks {
+		go func(name string, check HealthCheck) {
+			result := DependencyHealth{Status: HealthStatusUp}
+			if err := check(); err != nil {
+				result.Status, result.Error = HealthStatusDown, err.Error()
+			}
+			result.LatencyMs = latencyMs(time.Since(start))
+			results <- checkResult{name: name, health: result}
+		}(name, check)
+	}
+
+wait:
+	for range s.checks {
+		select {
+		case result := <-results:
+			report.Dependencies[result.name] = result.health
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	for name := range s.checks {
+		if _, ok := report.Dependencies[name]; !ok {
+			report.Dependencies[name] = DependencyHealth{
+				Status:    HealthStatusDown,
+				LatencyMs: latencyMs(time.Since(start)),
+				Error:     fmt.Sprintf("no answer within %s", s.timeout),
+			}
+		}
+		if report.Dependencies[name].Status != HealthStatusUp {
+			report.Status = HealthStatusDown
+		}
+	}
+
+	return report
+}
+
+func latencyMs(elapsed time.Duration) float64 {
+	return float64(elapsed.Microseconds()) / 1000
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHealthService_Readiness(t *testing.T) {
+	// release unblocks the hanging checks once the test is over
+	release := make(chan struct{})
+	defer close(release)
+
+	// both wait for the other one, they only pass when run concurrently
+	var started sync.WaitGroup
+	started.Add(2)
+	together := func() error {
+		started.Done()
+		done := make(chan struct{})
+		go func() { started.Wait(); close(done) }()
+		select {
+		case <-done:
+			return nil
+		case <-release:
+			return errors.New("ran alone")
+		}
+	}
+
+	tests := []struct {
+		name       string
+		checks     map[string]HealthCheck
+		wantStatus string
+		// wantDependencies holds the status and error of each dependency
+		wantDependencies map[string][2]string
+	}{
+		{
+			name:             "all up",
+			checks:           map[string]HealthCheck{"database": func() error { return nil }, "blob_storage": func() error { return nil }},
+			wantStatus:       HealthStatusUp,
+			wantDependencies: map[string][2]string{"database": {HealthStatusUp, ""}, "blob_storage": {HealthStatusUp, ""}},
+		},
+		{
+			name: "one failing",
+			checks: map[string]HealthCheck{
+				"database":     func() error { return nil },
+				"blob_storage": func() error { return errors.New("bucket not found") },
+			},
+			wantStatus:       HealthStatusDown,
+			wantDependencies: map[string][2]string{"database": {HealthStatusUp, ""}, "blob_storage": {HealthStatusDown, "bucket not found"}},
+		},
+		{
+			name: "one hanging past the deadline",
+			checks: map[string]HealthCheck{
+				"database": func() error { return nil },
+				"scanner":  func() error { <-release; return nil },
+			},
+			wantStatus:       HealthStatusDown,
+			wantDependencies: map[string][2]string{"database": {HealthStatusUp, ""}, "scanner": {HealthStatusDown, "no answer within 50ms"}},
+		},
+		{
+			name:             "checks run concurrently",
+			checks:           map[string]HealthCheck{"database": together, "blob_storage": together},
+			wantStatus:       HealthStatusUp,
+			wantDependencies: map[string][2]string{"database": {HealthStatusUp, ""}, "blob_storage": {HealthStatusUp, ""}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			healthService := NewHealthService()
+			healthService.timeout = 50 * time.Millisecond
+			for name, check := range tt.checks {
+				healthService.Register(name, check)
+			}
+
+			start := time.Now()
+			report := healthService.Readiness()
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("expected the report within the deadline, took %s", elapsed)
+			}
+
+			// checked through the JSON /readyz serves
+			body, err := json.Marshal(report)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded struct {
+				Status       string `json:"status"`
+				Dependencies map[string]struct {
+					Status string `json:"status"`
+					Error  string `json:"error"`
+				} `json:"dependencies"`
+			}
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				t.Fatal(err)
+			}
+
+			if decoded.Status != tt.wantStatus {
+				t.Errorf("expected status %s, got %s", tt.wantStatus, decoded.Status)
+			}
+			dependencies := map[string][2]string{}
+			for name, dependency := range decoded.Dependencies {
+				dependencies[name] = [2]string{dependency.Status, dependency.Error}
+			}
+			if !reflect.DeepEqual(dependencies, tt.wantDependencies) {
+				t.Errorf("expected dependencies %v, got %v", tt.wantDependencies, dependencies)
+			}
+		})
+	}
+}
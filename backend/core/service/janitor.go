@@ -0,0 +1,103 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"quickshare/core/repository"
+	"time"
+)
+
+// purgeBatchSize bounds the work of a single run, what is left is picked up by the next one
+const purgeBatchSize = 100
+
+type JanitorConfig struct {
+	Interval time.Duration
+	// PendingTimeout is how long an upload may stay pending before it is marked as failed
+	PendingTimeout time.Duration
+	// DeleteGracePeriod is how long deleted uploads stay in the trash before being purged
+	DeleteGracePeriod time.Duration
+}
+
+// Janitor periodically applies the lifecycle rules that no request triggers by itself
+type Janitor struct {
+	repository          repository.UploadObjectRepository
+	uploadObjectService *UploadObjectService
+	config              JanitorConfig
+}
+
+func NewJanitor(repo repository.UploadObjectRepository, uploadObjectService *UploadObjectService, config JanitorConfig) *Janitor {
+	return &Janitor{
+		repository:          repo,
+		uploadObjectService: uploadObjectService,
+		config:              config,
+	}
+}
+
+// Run applies the rules every Interval until stop is closed
+func (j *Janitor) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(j.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		j.RunOnce()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *Janitor) RunOnce() {
+	failed, err := j.repository.FailStalePendingUploads(time.Now().Add(-j.config.PendingTimeout))
+	if err != nil {
+		log.Println("janitor: error failing stale pending uploads", err)
+	} else if failed > 0 {
+		log.Printf("janitor: marked %d stale pending uploads as failed", failed)
+	}
+
+	j.expireUploads()
+	j.purgeTrash()
+}
+
+// expireUploads moves the uploads past their expiry to the trash, announcing them as expired
+func (j *Janitor) expireUploads() {
+	filter := repository.UploadObjectFilter{ExpiresBefore: time.Now()}
+
+	expired, _, err := j.repository.ListUploadObjects(filter, "", purgeBatchSize)
+	if err != nil {
+		log.Println("janitor: error listing expired uploads", err)
+		return
+	}
+
+	for _, uploadObject := range expired {
+		// the members of an expired bundle may already be trashed along with it
+		if _, err := j.uploadObjectService.ExpireUploadObject(uploadObject.ID); err != nil && !errors.Is(err, ErrUploadDeleted) {
+			log.Println("janitor: error expiring upload", uploadObject.ID, err)
+			continue
+		}
+		log.Println("janitor: expired upload", uploadObject.ID)
+	}
+}
+
+func (j *Janitor) purgeTrash() {
+	filter := repository.UploadObjectFilter{
+		Trashed:       true,
+		DeletedBefore: time.Now().Add(-j.config.DeleteGracePeriod),
+	}
+
+	expired, _, err := j.repository.ListUploadObjects(filter, "", purgeBatchSize)
+	if err != nil {
+		log.Println("janitor: error listing expired trash", err)
+		return
+	}
+
+	for _, uploadObject := range expired {
+		if err := j.uploadObjectService.PurgeUploadObject(uploadObject.ID); err != nil {
+			log.Println("janitor: error purging upload", uploadObject.ID, err)
+			continue
+		}
+		log.Println("janitor: purged upload", uploadObject.ID)
+	}
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"quickshare/core/model"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJanitor_ExpiresUploads(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{
+		"ex10172": {ID: "ex10172", Status: model.UploadStatusCompleted, ExpiresAt: past},
+		"li10172": {ID: "li10172", Status: model.UploadStatusCompleted, ExpiresAt: future},
+		"bu10172": {ID: "bu10172", Kind: model.UploadKindBundle, Status: model.UploadStatusCompleted, ExpiresAt: past},
+		"me10172": {ID: "me10172", BundleID: "bu10172", Status: model.UploadStatusCompleted, ExpiresAt: past},
+	}}
+	uploadObjectService := NewUploadObjectService(repo, &fakeBlobStorage{}, &fakeEventPublisher{}, UploadObjectServiceConfig{DeleteGracePeriod: time.Hour})
+	janitor := NewJanitor(repo, uploadObjectService, JanitorConfig{DeleteGracePeriod: time.Hour})
+
+	janitor.RunOnce()
+	// a second run finds nothing left to expire
+	janitor.RunOnce()
+
+	for id, wantTrashed := range map[string]bool{"ex10172": true, "li10172": false, "bu10172": true, "me10172": true} {
+		if trashed := repo.uploadObjects[id].DeletedAt != nil; trashed != wantTrashed {
+			t.Errorf("%s: expected trashed %v, got %v", id, wantTrashed, trashed)
+		}
+	}
+
+	want := []string{model.EventUploadExpired, model.EventUploadExpired, model.EventUploadExpired}
+	if !reflect.DeepEqual(repo.events, want) {
+		t.Errorf("expected events %v, got %v", want, repo.events)
+	}
+}
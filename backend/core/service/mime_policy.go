@@ -0,0 +1,135 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// SniffLength is how much of an object is read to detect its type, enough
+// for http.DetectContentType (512 bytes) and the zip based office formats
+const SniffLength = 4096
+
+const (
+	MimePolicyActionReject     = "reject"
+	MimePolicyActionQuarantine = "quarantine"
+)
+
+// magicRule matches a signature at a fixed offset of the content
+type magicRule struct {
+	offset    int
+	signature []byte
+	mimeType  string
+}
+
+// magicRules are checked before http.DetectContentType, which knows nothing
+// about executables and reports most binary formats as application/octet-stream
+var magicRules = []magicRule{
+	{0, []byte("\x7fELF"), "application/x-elf"},
+	{0, []byte("\xfe\xed\xfa\xce"), "application/x-mach-binary"},
+	{0, []byte("\xfe\xed\xfa\xcf"), "application/x-mach-binary"},
+	{0, []byte("\xce\xfa\xed\xfe"), "application/x-mach-binary"},
+	{0, []byte("\xcf\xfa\xed\xfe"), "application/x-mach-binary"},
+	{0, []byte("\xca\xfe\xba\xbe"), "application/x-mach-binary"},
+	{0, []byte("#!"), "text/x-shellscript"},
+	{0, []byte("\x00asm"), "application/wasm"},
+	{0, []byte("dex\n"), "application/vnd.android.dex"},
+	{0, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1"), "application/x-ole-storage"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), "application/x-7z-compressed"},
+	{0, []byte("\xfd7zXZ\x00"), "application/x-xz"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{0, []byte("\x28\xb5\x2f\xfd"), "application/zstd"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{4, []byte("ftypheic"), "image/heic"},
+	{4, []byte("ftypheix"), "image/heic"},
+	{4, []byte("ftypmif1"), "image/heif"},
+	{4, []byte("ftypavif"), "image/avif"},
+	{4, []byte("ftypqt  "), "video/quicktime"},
+}
+
+// peOffset is where the DOS header of an executable stores e_lfanew, the offset of the PE header
+const peOffset = 0x3c
+
+// isPortableExecutable checks the PE signature e_lfanew points to, "MZ" alone
+// starts plenty of text files. Headers past the sniffed content go undetected.
+func isPortableExecutable(content []byte) bool {
+	if len(content) < peOffset+4 || !bytes.HasPrefix(content, []byte("MZ")) {
+		return false
+	}
+	offset := int64(binary.LittleEndian.Uint32(content[peOffset:]))
+	return offset+4 <= int64(len(content)) && bytes.Equal(content[offset:offset+4], []byte("PE\x00\x00"))
+}
+
+// zipRules tell the zip based formats apart by the entries near the start of the archive
+var zipRules = []struct {
+	marker   string
+	mimeType string
+}{
+	{"mimetypeapplication/epub+zip", "application/epub+zip"},
+	{"mimetypeapplication/vnd.oasis.opendocument.text", "application/vnd.oasis.opendocument.text"},
+	{"mimetypeapplication/vnd.oasis.opendocument.spreadsheet", "application/vnd.oasis.opendocument.spreadsheet"},
+	{"word/", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	{"xl/", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	{"ppt/", "application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+	{"AndroidManifest.xml", "application/vnd.android.package-archive"},
+	{"META-INF/MANIFEST.MF", "application/java-archive"},
+}
+
+// DetectMimeType returns the media type of content, without parameters
+func DetectMimeType(content []byte) string {
+	if isPortableExecutable(content) {
+		return "application/vnd.microsoft.portable-executable"
+	}
+	for _, rule := range magicRules {
+		if len(content) >= rule.offset+len(rule.signature) && bytes.Equal(content[rule.offset:rule.offset+len(rule.signature)], rule.signature) {
+			return rule.mimeType
+		}
+	}
+
+	detected := http.DetectContentType(content)
+	if detected == "application/zip" {
+		for _, rule := range zipRules {
+			if bytes.Contains(content, []byte(rule.marker)) {
+				return rule.mimeType
+			}
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(detected)
+	if err != nil {
+		return detected
+	}
+	return mediaType
+}
+
+// MimePolicy decides which detected types may be stored. An empty Allow
+// accepts everything that Deny doesn't list, entries may be "type/*".
+type MimePolicy struct {
+	Allow  []string
+	Deny   []string
+	Action string
+}
+
+func (p MimePolicy) Allows(mimeType string) bool {
+	if matchMimeTypes(p.Deny, mimeType) {
+		return false
+	}
+	return len(p.Allow) == 0 || matchMimeTypes(p.Allow, mimeType)
+}
+
+func matchMimeTypes(patterns []string, mimeType string) bool {
+	mimeType = strings.ToLower(mimeType)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "*/*" || pattern == mimeType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mimeType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
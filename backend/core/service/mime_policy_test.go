@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"quickshare/core/model"
+	"reflect"
+	"testing"
+)
+
+func TestDetectMimeType(t *testing.T) {
+	tar := make([]byte, 512)
+	copy(tar[257:], "ustar\x0000")
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{name: "pdf", content: []byte("%PDF-1.7\n"), want: "application/pdf"},
+		{name: "png", content: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), want: "image/png"},
+		{name: "plain text drops the charset", content: []byte("hello world"), want: "text/plain"},
+		{name: "windows executable", content: peExecutable(), want: "application/vnd.microsoft.portable-executable"},
+		{name: "MZ without a PE header", content: []byte("MZ is the postal code of the Mazowieckie region, see page 12 of the report"), want: "text/plain"},
+		{name: "PE header past the content", content: peExecutable()[:0x40], want: "application/octet-stream"},
+		{name: "linux executable", content: []byte("\x7fELF\x02\x01\x01"), want: "application/x-elf"},
+		{name: "mach-o executable", content: []byte("\xcf\xfa\xed\xfe\x07\x00\x00\x01"), want: "application/x-mach-binary"},
+		{name: "shell script", content: []byte("#!/bin/sh\nrm -rf /\n"), want: "text/x-shellscript"},
+		{name: "heic", content: []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), want: "image/heic"},
+		{name: "tar", content: tar, want: "application/x-tar"},
+		{name: "docx", content: []byte("PK\x03\x04\x14\x00\x06\x00\x08\x00\x00\x00!\x00[Content_Types].xml....word/document.xml"), want: "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{name: "plain zip", content: []byte("PK\x03\x04\x14\x00\x00\x00\x08\x00notes.txt"), want: "application/zip"},
+		{name: "empty", content: []byte{}, want: "text/plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectMimeType(tt.content); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMimePolicy_Allows(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   MimePolicy
+		mimeType string
+		want     bool
+	}{
+		{name: "empty policy allows everything", policy: MimePolicy{}, mimeType: "application/x-elf", want: true},
+		{name: "denied type", policy: MimePolicy{Deny: []string{"application/x-elf"}}, mimeType: "application/x-elf", want: false},
+		{name: "type not in the allowlist", policy: MimePolicy{Allow: []string{"image/*", "application/pdf"}}, mimeType: "text/plain", want: false},
+		{name: "wildcard allowlist", policy: MimePolicy{Allow: []string{"image/*"}}, mimeType: "image/png", want: true},
+		{name: "denylist wins over allowlist", policy: MimePolicy{Allow: []string{"image/*"}, Deny: []string{"image/svg+xml"}}, mimeType: "image/svg+xml", want: false},
+		{name: "case insensitive", policy: MimePolicy{Deny: []string{"Application/PDF"}}, mimeType: "application/pdf", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Allows(tt.mimeType); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestUploadObjectService_ConfirmUpload_MimePolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		action      string
+		wantStatus  string
+		wantDeleted bool
+	}{
+		{name: "reject queues the deletion of the object", action: MimePolicyActionReject, wantStatus: model.UploadStatusRejected, wantDeleted: true},
+		{name: "quarantine keeps the object", action: MimePolicyActionQuarantine, wantStatus: model.UploadStatusQuarantined},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{
+				"in10172": {ID: "in10172", MimeType: "application/pdf", ObjectKey: "uploads/in10172/invoice.pdf", Status: model.UploadStatusPending},
+			}}
+			blobStorage := &fakeBlobStorage{contents: map[string][]byte{
+				"uploads/in10172/invoice.pdf": peExecutable(),
+			}}
+			uploadObjectService := NewUploadObjectService(repo, blobStorage, &fakeEventPublisher{}, UploadObjectServiceConfig{
+				MimePolicy: MimePolicy{Deny: []string{"application/vnd.microsoft.portable-executable"}, Action: tt.action},
+			})
+
+			_, err := uploadObjectService.ConfirmUpload("in10172")
+			if !errors.Is(err, ErrMimeTypeNotAllowed) {
+				t.Fatalf("expected ErrMimeTypeNotAllowed, got %v", err)
+			}
+
+			stored := repo.uploadObjects["in10172"]
+			if stored.Status != tt.wantStatus {
+				t.Errorf("expected status %q, got %q", tt.wantStatus, stored.Status)
+			}
+			if stored.MimeType != "application/pdf" || stored.DetectedMimeType != "application/vnd.microsoft.portable-executable" {
+				t.Errorf("expected declared and detected types to be kept apart, got %q and %q", stored.MimeType, stored.DetectedMimeType)
+			}
+			if queued := reflect.DeepEqual(repo.blobDeletions, []string{"uploads/in10172/invoice.pdf"}); queued != tt.wantDeleted {
+				t.Errorf("expected the object queued for deletion %v, got %v", tt.wantDeleted, repo.blobDeletions)
+			}
+			// the worker deletes it, nothing is removed behind the outbox
+			if len(blobStorage.deleted) > 0 {
+				t.Errorf("expected no direct delete, got %v", blobStorage.deleted)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+)
+
+// PreviewSizes are the boxes, in pixels, the previews are scaled down to fit in
+var PreviewSizes = map[string]int{
+	"small":  160,
+	"medium": 480,
+	"large":  1024,
+}
+
+const DefaultPreviewSize = "medium"
+
+// previewMimeTypes are the types pkg/thumbnail decodes. Rendering PDFs would
+// take a PDF rasterizer and there is none in pure Go, so they get no preview.
+var previewMimeTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var (
+	ErrInvalidPreviewSize  = errors.New("invalid preview size, expected small, medium or large")
+	ErrPreviewNotAvailable = errors.New("no preview available for this upload")
+)
+
+// queuePreview marks an upload about to be completed for the preview worker
+func (s *UploadObjectService) queuePreview(uploadObject *model.UploadObject) {
+	if s.config.GeneratePreviews && previewable(uploadObject) {
+		uploadObject.PreviewStatus = model.PreviewStatusPending
+	}
+}
+
+// previewable tells whether the content of an upload is an image pkg/thumbnail can read,
+// ciphertext never is. The sniffed type wins over the declared one.
+func previewable(uploadObject *model.UploadObject) bool {
+	if uploadObject.Encryption != nil || uploadObject.Kind == model.UploadKindBundle {
+		return false
+	}
+	mimeType := uploadObject.DetectedMimeType
+	if mimeType == "" {
+		mimeType = uploadObject.MimeType
+	}
+	return previewMimeTypes[mimeType]
+}
+
+// previewKey derives the object key of a preview from its upload, the extension follows the format
+func previewKey(uploadID string, size string, mimeType string) string {
+	extension := ".jpg"
+	if mimeType == "image/png" {
+		extension = ".png"
+	}
+	return "previews/" + uploadID + "/" + size + extension
+}
+
+// PreviewService serves the thumbnails the PreviewWorker made
+type PreviewService struct {
+	repository  repository.UploadObjectRepository
+	previews    repository.PreviewRepository
+	blobStorage repository.BlobStorageRepository
+}
+
+func NewPreviewService(repo repository.UploadObjectRepository, previews repository.PreviewRepository, blobStorage repository.BlobStorageRepository) *PreviewService {
+	return &PreviewService{
+		repository:  repo,
+		previews:    previews,
+		blobStorage: blobStorage,
+	}
+}
+
+// OpenPreview returns the preview of an upload and streams its content, the caller closes it.
+// Previews follow their upload: none is served for an upload that can't be downloaded.
+func (s *PreviewService) OpenPreview(id string, size string) (*model.Preview, io.ReadCloser, error) {
+	if size == "" {
+		size = DefaultPreviewSize
+	}
+	if _, ok := PreviewSizes[size]; !ok {
+		return nil, nil, ErrInvalidPreviewSize
+	}
+
+	uploadObject, err := s.repository.GetUploadObject(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkDownloadable(uploadObject); err != nil {
+		return nil, nil, err
+	}
+	if uploadObject.PreviewStatus != model.PreviewStatusReady {
+		return nil, nil, ErrPreviewNotAvailable
+	}
+
+	preview, err := s.previews.GetPreview(id, size)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, ErrPreviewNotAvailable
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := s.blobStorage.Open(preview.ObjectKey, uploadObject.StorageEncryption)
+	if err != nil {
+		return nil, nil, err
+	}
+	return preview, content, nil
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+	"quickshare/pkg/thumbnail"
+	"sort"
+	"time"
+)
+
+// previewBatchSize bounds the work of a single run, what is left is picked up by the next one
+const previewBatchSize = 20
+
+var errPreviewSourceTooLarge = errors.New("image is larger than the preview max source size")
+
+type PreviewWorkerConfig struct {
+	Interval time.Duration
+	// MaxSourceSize and MaxPixels bound the images decoded in memory
+	MaxSourceSize int64
+	MaxPixels     int64
+	// MaxAttempts failed runs mark the preview as failed
+	MaxAttempts int
+}
+
+// PreviewWorker makes the thumbnails of the uploads whose preview is pending.
+// Images that can't be decoded are marked as failed for good, storage and
+// database errors leave the upload pending for the next run until MaxAttempts.
+type PreviewWorker struct {
+	repository  repository.UploadObjectRepository
+	previews    repository.PreviewRepository
+	blobStorage repository.BlobStorageRepository
+	config      PreviewWorkerConfig
+}
+
+func NewPreviewWorker(repo repository.UploadObjectRepository, previews repository.PreviewRepository, blobStorage repository.BlobStorageRepository, config PreviewWorkerConfig) *PreviewWorker {
+	return &PreviewWorker{
+		repository:  repo,
+		previews:    previews,
+		blobStorage: blobStorage,
+		config:      config,
+	}
+}
+
+func (w *PreviewWorker) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.RunOnce()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *PreviewWorker) RunOnce() {
+	filter := repository.UploadObjectFilter{Status: model.UploadStatusCompleted, PreviewStatus: model.PreviewStatusPending}
+
+	uploadObjects, _, err := w.repository.ListUploadObjects(filter, "", previewBatchSize)
+	if err != nil {
+		log.Println("preview: error listing uploads", err)
+		return
+	}
+
+	for _, uploadObject := range uploadObjects {
+		if err := w.generate(uploadObject); err != nil {
+			w.fail(uploadObject, err)
+		}
+	}
+}
+
+// fail counts the failed run, the preview is marked as failed once it ran out of attempts
+func (w *PreviewWorker) fail(uploadObject *model.UploadObject, generateErr error) {
+	attempts, err := w.repository.RecordPreviewFailure(uploadObject.ID, generateErr.Error())
+	if err != nil {
+		log.Println("preview: error generating previews of upload", uploadObject.ID, generateErr, "and recording the failure", err)
+		return
+	}
+	if attempts < w.config.MaxAttempts {
+		log.Printf("preview: attempt %d for upload %s failed, retrying on the next run: %v", attempts, uploadObject.ID, generateErr)
+		return
+	}
+
+	log.Printf("preview: giving up on upload %s after %d attempts: %v", uploadObject.ID, attempts, generateErr)
+	if err := w.finish(uploadObject.ID, model.PreviewStatusFailed); err != nil {
+		log.Println("preview: error marking the preview of upload", uploadObject.ID, "as failed", err)
+	}
+}
+
+func (w *PreviewWorker) generate(uploadObject *model.UploadObject) error {
+	content, err := w.read(uploadObject)
+	if errors.Is(err, errPreviewSourceTooLarge) {
+		log.Printf("preview: upload %s is too large for a preview", uploadObject.ID)
+		return w.finish(uploadObject.ID, model.PreviewStatusFailed)
+	}
+	if err != nil {
+		return err
+	}
+
+	img, err := thumbnail.Decode(content, w.config.MaxPixels)
+	if err != nil {
+		// retrying won't make the image any more readable
+		log.Printf("preview: upload %s can't be decoded: %v", uploadObject.ID, err)
+		return w.finish(uploadObject.ID, model.PreviewStatusFailed)
+	}
+
+	sizes := make([]string, 0, len(PreviewSizes))
+	for size := range PreviewSizes {
+		sizes = append(sizes, size)
+	}
+	sort.Strings(sizes)
+
+	for _, size := range sizes {
+		thumb, err := thumbnail.Generate(img, PreviewSizes[size])
+		if err != nil {
+			return fmt.Errorf("failed to generate the %s preview: %w", size, err)
+		}
+
+		objectKey := previewKey(uploadObject.ID, size, thumb.MimeType)
+		if err := w.blobStorage.Put(objectKey, uploadObject.StorageEncryption, thumb.Content, thumb.MimeType); err != nil {
+			return err
+		}
+		_, err = w.previews.SavePreview(&model.Preview{
+			UploadID:  uploadObject.ID,
+			Size:      size,
+			ObjectKey: objectKey,
+			MimeType:  thumb.MimeType,
+			Width:     thumb.Width,
+			Height:    thumb.Height,
+			FileSize:  int64(len(thumb.Content)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.finish(uploadObject.ID, model.PreviewStatusReady)
+}
+
+// read loads the whole image, up to MaxSourceSize
+func (w *PreviewWorker) read(uploadObject *model.UploadObject) ([]byte, error) {
+	if uploadObject.FileSize > w.config.MaxSourceSize {
+		return nil, errPreviewSourceTooLarge
+	}
+
+	object, err := w.blobStorage.Open(uploadObject.ObjectKey, uploadObject.StorageEncryption)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	// the recorded size may come from the client, the read is bounded all the same
+	content, err := io.ReadAll(io.LimitReader(object, w.config.MaxSourceSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > w.config.MaxSourceSize {
+		return nil, errPreviewSourceTooLarge
+	}
+	return content, nil
+}
+
+// finish records the outcome, unless another instance got there first
+func (w *PreviewWorker) finish(id string, status string) error {
+	uploadObject, err := w.repository.GetUploadObject(id)
+	if err != nil {
+		return err
+	}
+	if uploadObject.PreviewStatus != model.PreviewStatusPending {
+		return nil
+	}
+
+	uploadObject.PreviewStatus = status
+	_, err = w.repository.UpdateUploadObject(id, uploadObject)
+	return err
+}
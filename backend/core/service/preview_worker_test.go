@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"quickshare/core/model"
+	"testing"
+	"time"
+)
+
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPreviewWorker_RunOnce(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    []byte
+		encryption *model.Encryption
+		wantStatus string
+		// wantSizes are the preview dimensions by size name
+		wantSizes map[string][2]int
+	}{
+		{
+			name:       "image gets its previews",
+			content:    testPNG(t, 800, 400),
+			wantStatus: model.PreviewStatusReady,
+			wantSizes:  map[string][2]int{"small": {160, 80}, "medium": {480, 240}, "large": {800, 400}},
+		},
+		{name: "truncated image fails for good", content: testPNG(t, 800, 400)[:100], wantStatus: model.PreviewStatusFailed},
+		{name: "image larger than the max source size fails", content: append(testPNG(t, 10, 10), make([]byte, 70000)...), wantStatus: model.PreviewStatusFailed},
+		{name: "PDF gets no preview", content: []byte("%PDF-1.7\n")},
+		{name: "encrypted upload gets no preview", content: []byte("QSE1 ciphertext"), encryption: &model.Encryption{Algorithm: "XChaCha20-Poly1305", ChunkSize: 65536}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{
+				"do10172": {ID: "do10172", ObjectKey: "uploads/do10172/picture", MimeType: "image/png", Status: model.UploadStatusPending, ExpiresAt: time.Now().Add(time.Hour), Encryption: tt.encryption},
+			}}
+			blobStorage := &fakeBlobStorage{contents: map[string][]byte{"uploads/do10172/picture": tt.content}}
+			previews := &fakePreviewRepository{}
+			uploadObjectService := NewUploadObjectService(repo, blobStorage, &fakeEventPublisher{}, UploadObjectServiceConfig{GeneratePreviews: true})
+
+			if _, err := uploadObjectService.ConfirmUpload("do10172"); err != nil {
+				t.Fatalf("unexpected error confirming: %v", err)
+			}
+			wantQueued := tt.wantStatus != ""
+			if queued := repo.uploadObjects["do10172"].PreviewStatus == model.PreviewStatusPending; queued != wantQueued {
+				t.Fatalf("expected the upload queued for previews %v, got preview status %q", wantQueued, repo.uploadObjects["do10172"].PreviewStatus)
+			}
+
+			NewPreviewWorker(repo, previews, blobStorage, PreviewWorkerConfig{MaxSourceSize: 64 * 1024, MaxPixels: 1 << 20, MaxAttempts: 3}).RunOnce()
+
+			if status := repo.uploadObjects["do10172"].PreviewStatus; status != tt.wantStatus {
+				t.Errorf("expected preview status %q, got %q", tt.wantStatus, status)
+			}
+
+			previewService := NewPreviewService(repo, previews, blobStorage)
+			for size, dimensions := range tt.wantSizes {
+				preview, content, err := previewService.OpenPreview("do10172", size)
+				if err != nil {
+					t.Fatalf("unexpected error opening the %s preview: %v", size, err)
+				}
+				body, _ := io.ReadAll(content)
+				content.Close()
+
+				img, format, err := image.Decode(bytes.NewReader(body))
+				if err != nil {
+					t.Fatalf("the %s preview is not an image: %v", size, err)
+				}
+				if format != "jpeg" || preview.ObjectKey != "previews/do10172/"+size+".jpg" {
+					t.Errorf("expected a JPEG under a derived key, got %s under %s", format, preview.ObjectKey)
+				}
+				if got := [2]int{img.Bounds().Dx(), img.Bounds().Dy()}; got != dimensions || got != [2]int{preview.Width, preview.Height} {
+					t.Errorf("expected a %v %s preview, got %v recorded as %dx%d", dimensions, size, got, preview.Width, preview.Height)
+				}
+			}
+
+			if _, _, err := previewService.OpenPreview("do10172", "huge"); !errors.Is(err, ErrInvalidPreviewSize) {
+				t.Errorf("expected ErrInvalidPreviewSize, got %v", err)
+			}
+			_, content, err := previewService.OpenPreview("do10172", "")
+			if tt.wantStatus == model.PreviewStatusReady {
+				if err != nil {
+					t.Errorf("expected the medium preview by default, got %v", err)
+				} else {
+					content.Close()
+				}
+			} else if !errors.Is(err, ErrPreviewNotAvailable) {
+				t.Errorf("expected ErrPreviewNotAvailable, got %v", err)
+			}
+		})
+	}
+}
+
+func TestPreviewWorker_GivesUpAfterMaxAttempts(t *testing.T) {
+	repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{
+		"do10172": {ID: "do10172", ObjectKey: "uploads/do10172/picture", MimeType: "image/png", Status: model.UploadStatusCompleted, PreviewStatus: model.PreviewStatusPending, FileSize: 1024},
+	}}
+	blobStorage := &fakeBlobStorage{openErr: errors.New("connection reset")}
+	worker := NewPreviewWorker(repo, &fakePreviewRepository{}, blobStorage, PreviewWorkerConfig{MaxSourceSize: 64 * 1024, MaxPixels: 1 << 20, MaxAttempts: 3})
+
+	for run := 1; run <= 3; run++ {
+		worker.RunOnce()
+		status := repo.uploadObjects["do10172"].PreviewStatus
+		if run < 3 && status != model.PreviewStatusPending {
+			t.Fatalf("run %d: expected the preview to stay pending, got %s", run, status)
+		}
+	}
+
+	if status := repo.uploadObjects["do10172"].PreviewStatus; status != model.PreviewStatusFailed {
+		t.Errorf("expected the preview failed after 3 attempts, got %q", status)
+	}
+}
+
+func TestPreviewService_FollowsTheUpload(t *testing.T) {
+	now := time.Now()
+	repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{
+		"deleted": {ID: "deleted", Status: model.UploadStatusCompleted, PreviewStatus: model.PreviewStatusReady, ExpiresAt: now.Add(time.Hour), DeletedAt: &now},
+		"expired": {ID: "expired", Status: model.UploadStatusCompleted, PreviewStatus: model.PreviewStatusReady, ExpiresAt: now.Add(-time.Hour)},
+	}}
+	previews := &fakePreviewRepository{}
+	for id := range repo.uploadObjects {
+		previews.SavePreview(&model.Preview{UploadID: id, Size: "medium", ObjectKey: "previews/" + id + "/medium.jpg"})
+	}
+	previewService := NewPreviewService(repo, previews, &fakeBlobStorage{})
+
+	if _, _, err := previewService.OpenPreview("deleted", "medium"); !errors.Is(err, ErrUploadDeleted) {
+		t.Errorf("expected ErrUploadDeleted, got %v", err)
+	}
+	if _, _, err := previewService.OpenPreview("expired", "medium"); err == nil {
+		t.Error("expected the preview of an expired upload to be refused")
+	}
+}
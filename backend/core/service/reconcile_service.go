@@ -0,0 +1,167 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+	"time"
+)
+
+const (
+	reconcilePrefix    = uploadKeyPrefix + "/"
+	reconcilePageLimit = MaxListLimit
+	// objects younger than this may belong to an upload whose row isn't committed yet
+	reconcileOrphanMinAge = time.Hour
+)
+
+type ReconcileReport struct {
+	StartedAt      time.Time `json:"started_at"`
+	FinishedAt     time.Time `json:"finished_at"`
+	Fix            bool      `json:"fix"`
+	ScannedBlobs   int       `json:"scanned_blobs"`
+	ScannedUploads int       `json:"scanned_uploads"`
+	// OrphanedObjects are keys in the bucket that no upload row points to
+	OrphanedObjects []string `json:"orphaned_objects"`
+	// MissingObjects are completed uploads whose object is not in the bucket
+	MissingObjects []string `json:"missing_objects"`
+	// UnconfirmedUploads are pending uploads whose object was actually uploaded
+	UnconfirmedUploads []string `json:"unconfirmed_uploads"`
+	Errors             []string `json:"errors,omitempty"`
+}
+
+// ReconcileService finds, and optionally fixes, drift between the bucket and upload_objects
+type ReconcileService struct {
+	repository          repository.UploadObjectRepository
+	blobStorage         repository.BlobStorageRepository
+	uploadObjectService *UploadObjectService
+}
+
+func NewReconcileService(repo repository.UploadObjectRepository, blobStorage repository.BlobStorageRepository, uploadObjectService *UploadObjectService) *ReconcileService {
+	return &ReconcileService{
+		repository:          repo,
+		blobStorage:         blobStorage,
+		uploadObjectService: uploadObjectService,
+	}
+}
+
+// Reconcile walks the bucket then the table. With fix, orphaned objects are
+// deleted, uploads missing their object are marked as failed and unconfirmed
+// uploads are confirmed. Errors on single items are reported, not returned.
+func (s *ReconcileService) Reconcile(fix bool) (*ReconcileReport, error) {
+	report := &ReconcileReport{
+		StartedAt:          time.Now().UTC(),
+		Fix:                fix,
+		OrphanedObjects:    []string{},
+		MissingObjects:     []string{},
+		UnconfirmedUploads: []string{},
+	}
+
+	if err := s.reconcileBucket(report); err != nil {
+		return nil, err
+	}
+	if err := s.reconcileUploads(report); err != nil {
+		return nil, err
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	return report, nil
+}
+
+func (s *ReconcileService) reconcileBucket(report *ReconcileReport) error {
+	token := ""
+	for {
+		objects, nextToken, err := s.blobStorage.List(reconcilePrefix, token)
+		if err != nil {
+			return err
+		}
+		report.ScannedBlobs += len(objects)
+
+		keys := make([]string, 0, len(objects))
+		for _, object := range objects {
+			keys = append(keys, object.Key)
+		}
+
+		uploadObjects, err := s.repository.FindUploadObjectsByObjectKeys(keys)
+		if err != nil {
+			return err
+		}
+		byKey := make(map[string]*model.UploadObject, len(uploadObjects))
+		for _, uploadObject := range uploadObjects {
+			byKey[uploadObject.ObjectKey] = uploadObject
+		}
+
+		for _, object := range objects {
+			uploadObject, ok := byKey[object.Key]
+			switch {
+			case !ok && time.Since(object.LastModified) >= reconcileOrphanMinAge:
+				report.OrphanedObjects = append(report.OrphanedObjects, object.Key)
+				if report.Fix {
+					s.fix(report, "deleting orphaned object "+object.Key, s.blobStorage.Delete(object.Key))
+				}
+			case ok && uploadObject.Status == model.UploadStatusPending && uploadObject.DeletedAt == nil:
+				report.UnconfirmedUploads = append(report.UnconfirmedUploads, uploadObject.ID)
+				if report.Fix {
+					_, err := s.uploadObjectService.ConfirmUpload(uploadObject.ID)
+					s.fix(report, "confirming upload "+uploadObject.ID, err)
+				}
+			}
+		}
+
+		if nextToken == "" {
+			return nil
+		}
+		token = nextToken
+	}
+}
+
+func (s *ReconcileService) reconcileUploads(report *ReconcileReport) error {
+	filter := repository.UploadObjectFilter{
+		Status:         model.UploadStatusCompleted,
+		IncludeTrashed: true,
+	}
+
+	cursor := ""
+	for {
+		uploadObjects, nextCursor, err := s.repository.ListUploadObjects(filter, cursor, reconcilePageLimit)
+		if err != nil {
+			return err
+		}
+		report.ScannedUploads += len(uploadObjects)
+
+		for _, uploadObject := range uploadObjects {
+			// bundles have no object, their members are checked on their own
+			if uploadObject.Kind == model.UploadKindBundle {
+				continue
+			}
+			exists, err := s.blobStorage.ObjectExists(uploadObject.ObjectKey, uploadObject.StorageEncryption)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("checking upload %s: %v", uploadObject.ID, err))
+				continue
+			}
+			if exists {
+				continue
+			}
+
+			report.MissingObjects = append(report.MissingObjects, uploadObject.ID)
+			if report.Fix {
+				uploadObject.Status = model.UploadStatusFailed
+				_, err := s.repository.UpdateUploadObject(uploadObject.ID, uploadObject)
+				s.fix(report, "failing upload "+uploadObject.ID, err)
+			}
+		}
+
+		if nextCursor == "" {
+			return nil
+		}
+		cursor = nextCursor
+	}
+}
+
+func (s *ReconcileService) fix(report *ReconcileReport, action string, err error) {
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", action, err))
+		return
+	}
+	log.Println("reconcile:", action)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"quickshare/core/model"
+	"quickshare/core/repository"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestReconcileService_Reconcile(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+
+	tests := []struct {
+		name          string
+		uploadObjects []*model.UploadObject
+		objects       []repository.BlobObject
+		fix           bool
+		wantOrphaned  []string
+		wantMissing   []string
+		wantPending   []string
+		// wantStatuses are the statuses of the uploads after the run, by ID
+		wantStatuses map[string]string
+		wantDeleted  []string
+		wantEvents   []string
+	}{
+		{
+			name:         "orphaned object older than the cutoff",
+			objects:      []repository.BlobObject{{Key: "uploads/or10172/report.pdf", LastModified: old}},
+			wantOrphaned: []string{"uploads/or10172/report.pdf"},
+		},
+		{
+			name:         "orphaned object deleted with fix",
+			objects:      []repository.BlobObject{{Key: "uploads/or10172/report.pdf", LastModified: old}},
+			fix:          true,
+			wantOrphaned: []string{"uploads/or10172/report.pdf"},
+			wantDeleted:  []string{"uploads/or10172/report.pdf"},
+		},
+		{
+			// its row may not be committed yet
+			name:    "object younger than the cutoff",
+			objects: []repository.BlobObject{{Key: "uploads/ne10172/report.pdf", LastModified: now.Add(-time.Minute)}},
+			fix:     true,
+		},
+		{
+			name: "pending upload whose object was uploaded",
+			uploadObjects: []*model.UploadObject{
+				{ID: "pe10172", ObjectKey: "uploads/pe10172/report.pdf", Status: model.UploadStatusPending, ExpiresAt: now.Add(time.Hour)},
+			},
+			objects:      []repository.BlobObject{{Key: "uploads/pe10172/report.pdf", LastModified: old}},
+			wantPending:  []string{"pe10172"},
+			wantStatuses: map[string]string{"pe10172": model.UploadStatusPending},
+		},
+		{
+			name: "pending upload confirmed with fix",
+			uploadObjects: []*model.UploadObject{
+				{ID: "pe10172", ObjectKey: "uploads/pe10172/report.pdf", Status: model.UploadStatusPending, ExpiresAt: now.Add(time.Hour)},
+			},
+			objects:      []repository.BlobObject{{Key: "uploads/pe10172/report.pdf", LastModified: old}},
+			fix:          true,
+			wantPending:  []string{"pe10172"},
+			wantStatuses: map[string]string{"pe10172": model.UploadStatusCompleted},
+			wantEvents:   []string{model.EventUploadCompleted},
+		},
+		{
+			name: "trashed pending upload is left alone",
+			uploadObjects: []*model.UploadObject{
+				{ID: "tr10172", ObjectKey: "uploads/tr10172/report.pdf", Status: model.UploadStatusPending, ExpiresAt: now.Add(time.Hour), DeletedAt: &old},
+			},
+			objects:      []repository.BlobObject{{Key: "uploads/tr10172/report.pdf", LastModified: old}},
+			fix:          true,
+			wantStatuses: map[string]string{"tr10172": model.UploadStatusPending},
+		},
+		{
+			name: "completed upload missing its object",
+			uploadObjects: []*model.UploadObject{
+				{ID: "mi10172", ObjectKey: "uploads/mi10172/report.pdf", Status: model.UploadStatusCompleted, ExpiresAt: now.Add(time.Hour)},
+			},
+			objects:      []repository.BlobObject{},
+			wantMissing:  []string{"mi10172"},
+			wantStatuses: map[string]string{"mi10172": model.UploadStatusCompleted},
+		},
+		{
+			name: "completed upload missing its object failed with fix",
+			uploadObjects: []*model.UploadObject{
+				{ID: "mi10172", ObjectKey: "uploads/mi10172/report.pdf", Status: model.UploadStatusCompleted, ExpiresAt: now.Add(time.Hour)},
+				{ID: "ok10172", ObjectKey: "uploads/ok10172/report.pdf", Status: model.UploadStatusCompleted, ExpiresAt: now.Add(time.Hour)},
+			},
+			objects:      []repository.BlobObject{{Key: "uploads/ok10172/report.pdf", LastModified: old}},
+			fix:          true,
+			wantMissing:  []string{"mi10172"},
+			wantStatuses: map[string]string{"mi10172": model.UploadStatusFailed, "ok10172": model.UploadStatusCompleted},
+		},
+		{
+			name: "bundles have no object",
+			uploadObjects: []*model.UploadObject{
+				{ID: "bu10172", Kind: model.UploadKindBundle, ObjectKey: "bundles/bu10172", Status: model.UploadStatusCompleted, ExpiresAt: now.Add(time.Hour)},
+			},
+			objects:      []repository.BlobObject{},
+			fix:          true,
+			wantStatuses: map[string]string{"bu10172": model.UploadStatusCompleted},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{}}
+			for _, uploadObject := range tt.uploadObjects {
+				repo.uploadObjects[uploadObject.ID] = uploadObject
+			}
+			blobStorage := &fakeBlobStorage{objects: tt.objects}
+			uploadObjectService := NewUploadObjectService(repo, blobStorage, &fakeEventPublisher{}, UploadObjectServiceConfig{})
+
+			report, err := NewReconcileService(repo, blobStorage, uploadObjectService).Reconcile(tt.fix)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(report.Errors) > 0 {
+				t.Fatalf("unexpected errors: %v", report.Errors)
+			}
+
+			for name, lists := range map[string][2][]string{
+				"orphaned objects":    {report.OrphanedObjects, tt.wantOrphaned},
+				"missing objects":     {report.MissingObjects, tt.wantMissing},
+				"unconfirmed uploads": {report.UnconfirmedUploads, tt.wantPending},
+			} {
+				got, want := lists[0], lists[1]
+				sort.Strings(got)
+				if len(got) != 0 || len(want) != 0 {
+					if !reflect.DeepEqual(got, want) {
+						t.Errorf("expected %s %v, got %v", name, want, got)
+					}
+				}
+			}
+			if report.ScannedBlobs != len(tt.objects) {
+				t.Errorf("expected %d blobs scanned, got %d", len(tt.objects), report.ScannedBlobs)
+			}
+
+			for id, want := range tt.wantStatuses {
+				if status := repo.uploadObjects[id].Status; status != want {
+					t.Errorf("%s: expected status %s, got %s", id, want, status)
+				}
+			}
+			if !reflect.DeepEqual(blobStorage.deleted, tt.wantDeleted) {
+				t.Errorf("expected deleted objects %v, got %v", tt.wantDeleted, blobStorage.deleted)
+			}
+			if !reflect.DeepEqual(repo.events, tt.wantEvents) {
+				t.Errorf("expected events %v, got %v", tt.wantEvents, repo.events)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+	"time"
+)
+
+// scanBatchSize bounds the work of a single run, what is left is picked up by the next one
+const scanBatchSize = 20
+
+type ScanWorkerConfig struct {
+	Interval time.Duration
+	// MaxAttempts failed scans quarantine the upload
+	MaxAttempts int
+}
+
+// ScanWorker runs the malware scan of the uploads in the scanning status. An
+// upload whose scan fails stays there and is scanned again on the next run,
+// until MaxAttempts failures quarantine it for an operator to review.
+type ScanWorker struct {
+	repository          repository.UploadObjectRepository
+	blobStorage         repository.BlobStorageRepository
+	scanner             repository.Scanner
+	uploadObjectService *UploadObjectService
+	config              ScanWorkerConfig
+}
+
+func NewScanWorker(repo repository.UploadObjectRepository, blobStorage repository.BlobStorageRepository, scanner repository.Scanner, uploadObjectService *UploadObjectService, config ScanWorkerConfig) *ScanWorker {
+	return &ScanWorker{
+		repository:          repo,
+		blobStorage:         blobStorage,
+		scanner:             scanner,
+		uploadObjectService: uploadObjectService,
+		config:              config,
+	}
+}
+
+func (w *ScanWorker) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.RunOnce()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *ScanWorker) RunOnce() {
+	filter := repository.UploadObjectFilter{Status: model.UploadStatusScanning}
+
+	uploadObjects, _, err := w.repository.ListUploadObjects(filter, "", scanBatchSize)
+	if err != nil {
+		log.Println("scan: error listing uploads", err)
+		return
+	}
+
+	for _, uploadObject := range uploadObjects {
+		if err := w.scan(uploadObject); err != nil {
+			w.fail(uploadObject, err)
+		}
+	}
+}
+
+// fail counts the failed scan, the upload is quarantined once it ran out of attempts
+func (w *ScanWorker) fail(uploadObject *model.UploadObject, scanErr error) {
+	attempts, err := w.repository.RecordScanFailure(uploadObject.ID, scanErr.Error())
+	if err != nil {
+		log.Println("scan: error scanning upload", uploadObject.ID, scanErr, "and recording the failure", err)
+		return
+	}
+	if attempts < w.config.MaxAttempts {
+		log.Printf("scan: attempt %d of upload %s failed, retrying on the next run: %v", attempts, uploadObject.ID, scanErr)
+		return
+	}
+
+	reason := fmt.Sprintf("scan failed %d times: %v", attempts, scanErr)
+	if _, err := w.uploadObjectService.FailScan(uploadObject.ID, reason); err != nil && !errors.Is(err, ErrUploadNotScanning) {
+		log.Println("scan: error quarantining upload", uploadObject.ID, err)
+	}
+}
+
+func (w *ScanWorker) scan(uploadObject *model.UploadObject) error {
+	content, err := w.blobStorage.Open(uploadObject.ObjectKey, uploadObject.StorageEncryption)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	result, err := w.scanner.Scan(content)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.uploadObjectService.FinishScan(uploadObject.ID, result)
+	// another instance got there first
+	if errors.Is(err, ErrUploadNotScanning) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeScanner struct {
+	err error
+}
+
+func (f *fakeScanner) Scan(content io.Reader) (repository.ScanResult, error) {
+	if f.err != nil {
+		return repository.ScanResult{}, f.err
+	}
+	body, _ := io.ReadAll(content)
+	if strings.Contains(string(body), "EICAR") {
+		return repository.ScanResult{Signature: "Eicar-Signature"}, nil
+	}
+	return repository.ScanResult{Clean: true}, nil
+}
+
+func (f *fakeScanner) Ping() error {
+	return f.err
+}
+
+func TestScanWorker_RunOnce(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		scanErr    error
+		wantStatus string
+		wantReason string
+		wantEvents []string
+	}{
+		{name: "clean upload is completed", content: "%PDF-1.7\n", wantStatus: model.UploadStatusCompleted, wantEvents: []string{model.EventUploadCompleted}},
+		{name: "infected upload is quarantined", content: "X5O!P%@AP EICAR", wantStatus: model.UploadStatusQuarantined, wantReason: "malware found: Eicar-Signature", wantEvents: []string{model.EventUploadQuarantined}},
+		{name: "failed scan is retried later", content: "%PDF-1.7\n", scanErr: errors.New("connection refused"), wantStatus: model.UploadStatusScanning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{
+				"do10172": {ID: "do10172", ObjectKey: "uploads/do10172/document.pdf", Status: model.UploadStatusPending, ExpiresAt: time.Now().Add(time.Hour)},
+			}}
+			blobStorage := &fakeBlobStorage{contents: map[string][]byte{"uploads/do10172/document.pdf": []byte(tt.content)}}
+			events := &fakeEventPublisher{}
+			uploadObjectService := NewUploadObjectService(repo, blobStorage, events, UploadObjectServiceConfig{ScanUploads: true})
+
+			// confirming only sends the upload to the scan
+			uploadObject, err := uploadObjectService.ConfirmUpload("do10172")
+			if err != nil {
+				t.Fatalf("unexpected error confirming: %v", err)
+			}
+			if uploadObject.Status != model.UploadStatusScanning || len(repo.events) != 0 {
+				t.Fatalf("expected a scanning upload and no event, got %s and %v", uploadObject.Status, repo.events)
+			}
+			if _, err := uploadObjectService.GetDownloadURL("do10172"); err == nil {
+				t.Error("expected the download of a scanning upload to be refused")
+			}
+
+			NewScanWorker(repo, blobStorage, &fakeScanner{err: tt.scanErr}, uploadObjectService, ScanWorkerConfig{Interval: time.Second, MaxAttempts: 3}).RunOnce()
+
+			stored := repo.uploadObjects["do10172"]
+			if stored.Status != tt.wantStatus || stored.QuarantineReason != tt.wantReason {
+				t.Errorf("expected status %q reason %q, got %q %q", tt.wantStatus, tt.wantReason, stored.Status, stored.QuarantineReason)
+			}
+			if len(tt.wantEvents) > 0 && !reflect.DeepEqual(repo.events, tt.wantEvents) {
+				t.Errorf("expected events %v, got %v", tt.wantEvents, repo.events)
+			}
+
+			_, err = uploadObjectService.GetDownloadURL("do10172")
+			if tt.wantStatus == model.UploadStatusQuarantined && !errors.Is(err, ErrUploadQuarantined) {
+				t.Errorf("expected ErrUploadQuarantined, got %v", err)
+			}
+		})
+	}
+}
+
+func TestScanWorker_GivesUpAfterMaxAttempts(t *testing.T) {
+	repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{
+		"do10172": {ID: "do10172", ObjectKey: "uploads/do10172/document.pdf", Status: model.UploadStatusScanning, ExpiresAt: time.Now().Add(time.Hour)},
+	}}
+	blobStorage := &fakeBlobStorage{}
+	uploadObjectService := NewUploadObjectService(repo, blobStorage, &fakeEventPublisher{}, UploadObjectServiceConfig{ScanUploads: true})
+	worker := NewScanWorker(repo, blobStorage, &fakeScanner{err: errors.New("connection refused")}, uploadObjectService, ScanWorkerConfig{Interval: time.Second, MaxAttempts: 3})
+
+	for run := 1; run <= 3; run++ {
+		worker.RunOnce()
+		stored := repo.uploadObjects["do10172"]
+		if run < 3 && stored.Status != model.UploadStatusScanning {
+			t.Fatalf("run %d: expected the upload to stay scanning, got %s", run, stored.Status)
+		}
+	}
+
+	stored := repo.uploadObjects["do10172"]
+	if stored.Status != model.UploadStatusQuarantined || stored.QuarantineReason != "scan failed 3 times: connection refused" {
+		t.Errorf("expected the upload quarantined after 3 failed scans, got %q %q", stored.Status, stored.QuarantineReason)
+	}
+	if !reflect.DeepEqual(repo.events, []string{model.EventUploadQuarantined}) {
+		t.Errorf("expected a quarantined event, got %v", repo.events)
+	}
+
+	// quarantined uploads are not listed for the scan anymore
+	worker.RunOnce()
+	if repo.failures["scan/do10172"] != 3 {
+		t.Errorf("expected 3 recorded failures, got %d", repo.failures["scan/do10172"])
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+	"time"
+)
+
+const (
+	slugLength   = 8
+	slugAlphabet = "abcdefghijkmnopqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	// slugAttempts bounds the retries on a slug collision
+	slugAttempts = 3
+)
+
+var ErrShortLinkExpired = errors.New("short link has expired")
+
+// ShortLinkService hands out short /s/{slug} links to uploads. The server
+// only ever sees the path, a key in the URL fragment (#k=...) stays in the
+// browser and survives the redirect to the upload.
+type ShortLinkService struct {
+	repository       repository.ShortLinkRepository
+	uploadRepository repository.UploadObjectRepository
+}
+
+func NewShortLinkService(repo repository.ShortLinkRepository, uploadRepo repository.UploadObjectRepository) *ShortLinkService {
+	return &ShortLinkService{
+		repository:       repo,
+		uploadRepository: uploadRepo,
+	}
+}
+
+// CreateShortLink creates a link to the upload that expires with it
+func (s *ShortLinkService) CreateShortLink(uploadID string) (*model.ShortLink, error) {
+	uploadObject, err := s.uploadRepository.GetUploadObject(uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if uploadObject.DeletedAt != nil {
+		return nil, ErrUploadDeleted
+	}
+
+	for attempt := 1; ; attempt++ {
+		shortLink, err := s.repository.CreateShortLink(&model.ShortLink{
+			ID:           randomID("sl_"),
+			Slug:         randomSlug(),
+			OriginalLink: "/download/" + uploadObject.ID,
+			UploadID:     uploadObject.ID,
+			ExpiresAt:    uploadObject.ExpiresAt,
+		})
+		if errors.Is(err, repository.ErrSlugTaken) && attempt < slugAttempts {
+			continue
+		}
+		return shortLink, err
+	}
+}
+
+// ResolveShortLink returns the link of slug as long as it hasn't expired
+func (s *ShortLinkService) ResolveShortLink(slug string) (*model.ShortLink, error) {
+	shortLink, err := s.repository.GetShortLinkBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(shortLink.ExpiresAt) {
+		return nil, ErrShortLinkExpired
+	}
+	return shortLink, nil
+}
+
+// randomSlug leaves out the characters that are easily mistaken for each other (0/O, 1/l/I)
+func randomSlug() string {
+	slug := make([]byte, slugLength)
+	max := big.NewInt(int64(len(slugAlphabet)))
+	for i := range slug {
+		n, _ := rand.Int(rand.Reader, max)
+		slug[i] = slugAlphabet[n.Int64()]
+	}
+	return string(slug)
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+	"strings"
+	"time"
+)
+
+var ErrInvalidStorageEvent = errors.New("invalid storage event")
+
+// StorageObjectEvent is a single ObjectCreated record of a bucket notification
+type StorageObjectEvent struct {
+	EventName string
+	Bucket    string
+	ObjectKey string
+	Size      int64
+}
+
+type StorageEventResult struct {
+	Received int `json:"received"`
+	// Confirmed are the ids of the uploads confirmed by this notification
+	Confirmed []string `json:"confirmed"`
+	// Skipped counts records for other buckets, unknown keys or uploads that aren't pending anymore
+	Skipped int `json:"skipped"`
+}
+
+// s3Notification covers the S3 event notification format, which MinIO also
+// sends, and the SNS envelope it arrives in when SNS fans out to SQS
+type s3Notification struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key  string `json:"key"`
+				Size int64  `json:"size"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+
+	// s3:TestEvent, sent once when the notification is configured
+	Event string `json:"Event"`
+
+	// SNS envelope
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// ParseStorageEvents extracts the ObjectCreated records of a notification,
+// object keys are URL-decoded the way S3 encodes them
+func ParseStorageEvents(body []byte) ([]StorageObjectEvent, error) {
+	var notification s3Notification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidStorageEvent, err)
+	}
+
+	if notification.Type == "Notification" && notification.Message != "" {
+		return ParseStorageEvents([]byte(notification.Message))
+	}
+
+	events := []StorageObjectEvent{}
+	for _, record := range notification.Records {
+		eventName := strings.TrimPrefix(record.EventName, "s3:")
+		if !strings.HasPrefix(eventName, "ObjectCreated:") {
+			continue
+		}
+
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad object key %q", ErrInvalidStorageEvent, record.S3.Object.Key)
+		}
+
+		events = append(events, StorageObjectEvent{
+			EventName: eventName,
+			Bucket:    record.S3.Bucket.Name,
+			ObjectKey: key,
+			Size:      record.S3.Object.Size,
+		})
+	}
+	return events, nil
+}
+
+// StorageEventService confirms uploads from the bucket notifications, so
+// clients that never call the confirm endpoint don't stay pending forever
+type StorageEventService struct {
+	repository          repository.UploadObjectRepository
+	uploadObjectService *UploadObjectService
+	bucket              string
+}
+
+func NewStorageEventService(repo repository.UploadObjectRepository, uploadObjectService *UploadObjectService, bucket string) *StorageEventService {
+	return &StorageEventService{
+		repository:          repo,
+		uploadObjectService: uploadObjectService,
+		bucket:              bucket,
+	}
+}
+
+// HandleNotification runs ConfirmUpload for every pending upload stored under
+// a created object. Notifications are delivered at least once, uploads that are
+// already confirmed are skipped so replaying one has no effect.
+func (s *StorageEventService) HandleNotification(body []byte) (*StorageEventResult, error) {
+	events, err := ParseStorageEvents(body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &StorageEventResult{Received: len(events), Confirmed: []string{}}
+
+	keys := make([]string, 0, len(events))
+	for _, event := range events {
+		if s.bucket != "" && event.Bucket != s.bucket {
+			result.Skipped++
+			continue
+		}
+		keys = append(keys, event.ObjectKey)
+	}
+	if len(keys) == 0 {
+		return result, nil
+	}
+
+	uploadObjects, err := s.repository.FindUploadObjectsByObjectKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]*model.UploadObject, len(uploadObjects))
+	for _, uploadObject := range uploadObjects {
+		byKey[uploadObject.ObjectKey] = uploadObject
+	}
+
+	for _, key := range keys {
+		uploadObject, ok := byKey[key]
+		if !ok || uploadObject.Status != model.UploadStatusPending || uploadObject.DeletedAt != nil {
+			result.Skipped++
+			continue
+		}
+
+		_, err := s.uploadObjectService.ConfirmUpload(uploadObject.ID)
+		if errors.Is(err, ErrMimeTypeNotAllowed) || errors.Is(err, ErrUploadNotPending) || errors.Is(err, ErrUploadDeleted) {
+			// the upload was refused, or confirmed or deleted since it was looked up,
+			// a redelivery would not change that
+			result.Skipped++
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to confirm upload %s: %w", uploadObject.ID, err)
+		}
+		// a key listed twice in the same notification is only confirmed once
+		uploadObject.Status = model.UploadStatusCompleted
+		result.Confirmed = append(result.Confirmed, uploadObject.ID)
+	}
+
+	return result, nil
+}
+
+const storageEventBatchSize = 10
+
+// StorageEventPoller feeds the messages of a StorageEventQueue to the StorageEventService
+type StorageEventPoller struct {
+	queue    repository.StorageEventQueue
+	service  *StorageEventService
+	waitTime time.Duration
+}
+
+func NewStorageEventPoller(queue repository.StorageEventQueue, service *StorageEventService, waitTime time.Duration) *StorageEventPoller {
+	return &StorageEventPoller{
+		queue:    queue,
+		service:  service,
+		waitTime: waitTime,
+	}
+}
+
+// Run long-polls the queue until stop is closed
+func (p *StorageEventPoller) Run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if err := p.RunOnce(); err != nil {
+			log.Println("storage events: error receiving messages", err)
+			select {
+			case <-stop:
+				return
+			case <-time.After(p.waitTime):
+			}
+		}
+	}
+}
+
+// RunOnce handles one batch. Messages that failed are not acked and come back
+// after the queue visibility timeout, malformed ones are dropped.
+func (p *StorageEventPoller) RunOnce() error {
+	messages, err := p.queue.Receive(storageEventBatchSize, p.waitTime)
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		result, err := p.service.HandleNotification(message.Body)
+		switch {
+		case errors.Is(err, ErrInvalidStorageEvent):
+			log.Println("storage events: dropping message", message.ID, err)
+		case err != nil:
+			log.Println("storage events: error handling message", message.ID, err)
+			continue
+		case len(result.Confirmed) > 0:
+			log.Println("storage events: confirmed uploads", result.Confirmed)
+		}
+
+		if err := p.queue.Ack(message); err != nil {
+			log.Println("storage events: error acking message", message.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"quickshare/core/model"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	return body
+}
+
+func TestParseStorageEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    []StorageObjectEvent
+		wantErr bool
+	}{
+		{
+			name: "success - S3 notification with an encoded key",
+			file: "s3_object_created.json",
+			want: []StorageObjectEvent{{EventName: "ObjectCreated:Put", Bucket: "quickshare-assets", ObjectKey: "uploads/re10172/report Q4(2024).pdf", Size: 1024}},
+		},
+		{
+			name: "success - S3 notification inside an SNS envelope",
+			file: "sns_s3_object_created.json",
+			want: []StorageObjectEvent{{EventName: "ObjectCreated:Put", Bucket: "quickshare-assets", ObjectKey: "uploads/re10172/report Q4(2024).pdf", Size: 1024}},
+		},
+		{
+			name: "success - MinIO webhook notification",
+			file: "minio_object_created.json",
+			want: []StorageObjectEvent{{EventName: "ObjectCreated:Put", Bucket: "quickshare-assets", ObjectKey: "uploads/ph2017/photo.jpg", Size: 2048}},
+		},
+		{
+			name: "success - test event has no records",
+			file: "s3_test_event.json",
+			want: []StorageObjectEvent{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStorageEvents(readTestdata(t, tt.file))
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := ParseStorageEvents([]byte("not json")); err == nil {
+		t.Error("expected an error for a malformed notification")
+	}
+}
+
+func TestStorageEventService_HandleNotification(t *testing.T) {
+	now := time.Now()
+	deletedAt := now
+
+	repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{
+		"re10172": {ID: "re10172", ObjectKey: "uploads/re10172/report Q4(2024).pdf", Status: model.UploadStatusPending, CreatedAt: now},
+		"ph2017":  {ID: "ph2017", ObjectKey: "uploads/ph2017/photo.jpg", Status: model.UploadStatusPending, DeletedAt: &deletedAt},
+	}}
+	events := &fakeEventPublisher{}
+	uploadObjectService := NewUploadObjectService(repo, &fakeBlobStorage{}, events, UploadObjectServiceConfig{})
+	storageEventService := NewStorageEventService(repo, uploadObjectService, "quickshare-assets")
+
+	// the first delivery confirms, replays of the same notification change nothing
+	for i, wantConfirmed := range [][]string{{"re10172"}, {}} {
+		result, err := storageEventService.HandleNotification(readTestdata(t, "s3_object_created.json"))
+		if err != nil {
+			t.Fatalf("delivery %d: unexpected error %v", i, err)
+		}
+		if !reflect.DeepEqual(result.Confirmed, wantConfirmed) {
+			t.Errorf("delivery %d: expected confirmed %v, got %v", i, wantConfirmed, result.Confirmed)
+		}
+	}
+
+	if status := repo.uploadObjects["re10172"].Status; status != model.UploadStatusCompleted {
+		t.Errorf("expected upload to be completed, got %s", status)
+	}
+	if repo.uploadObjects["re10172"].ConfirmedAt == nil {
+		t.Error("expected confirmed_at to be set")
+	}
+	if !reflect.DeepEqual(repo.events, []string{model.EventUploadCompleted}) {
+		t.Errorf("expected a single completed event, got %v", repo.events)
+	}
+
+	// trashed uploads are not confirmed
+	result, err := storageEventService.HandleNotification(readTestdata(t, "minio_object_created.json"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(result.Confirmed) != 0 || result.Skipped != 1 {
+		t.Errorf("expected the trashed upload to be skipped, got %+v", result)
+	}
+
+	// notifications of other buckets are ignored
+	otherBucket := NewStorageEventService(repo, uploadObjectService, "another-bucket")
+	result, err = otherBucket.HandleNotification(readTestdata(t, "sns_s3_object_created.json"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if result.Skipped != 1 {
+		t.Errorf("expected the record to be skipped, got %+v", result)
+	}
+}
+
+// staleRepository serves the uploads as they were before a concurrent request
+// confirmed them, like two deliveries of the same notification handled at once
+type staleRepository struct {
+	*fakeUploadObjectRepository
+	stale map[string]*model.UploadObject
+}
+
+func (r *staleRepository) GetUploadObject(id string) (*model.UploadObject, error) {
+	copied := *r.stale[id]
+	return &copied, nil
+}
+
+func (r *staleRepository) FindUploadObjectsByObjectKeys(objectKeys []string) ([]*model.UploadObject, error) {
+	var found []*model.UploadObject
+	for _, uploadObject := range r.stale {
+		copied := *uploadObject
+		found = append(found, &copied)
+	}
+	return found, nil
+}
+
+func TestStorageEventService_ConcurrentConfirmation(t *testing.T) {
+	confirmedAt := time.Now()
+	repo := &staleRepository{
+		fakeUploadObjectRepository: &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{
+			"re10172": {ID: "re10172", ObjectKey: "uploads/re10172/report Q4(2024).pdf", Status: model.UploadStatusQuarantined, ConfirmedAt: &confirmedAt},
+		}},
+		stale: map[string]*model.UploadObject{
+			"re10172": {ID: "re10172", ObjectKey: "uploads/re10172/report Q4(2024).pdf", Status: model.UploadStatusPending},
+		},
+	}
+	uploadObjectService := NewUploadObjectService(repo, &fakeBlobStorage{}, &fakeEventPublisher{}, UploadObjectServiceConfig{})
+	storageEventService := NewStorageEventService(repo, uploadObjectService, "quickshare-assets")
+
+	result, err := storageEventService.HandleNotification(readTestdata(t, "s3_object_created.json"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(result.Confirmed) != 0 || result.Skipped != 1 {
+		t.Errorf("expected the upload confirmed in the meantime to be skipped, got %+v", result)
+	}
+	if stored := repo.uploadObjects["re10172"]; stored.Status != model.UploadStatusQuarantined || len(repo.events) != 0 {
+		t.Errorf("expected the quarantined upload to be left alone, got %s and events %v", stored.Status, repo.events)
+	}
+}
@@ -1,102 +1,415 @@
 package service
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log"
 	"quickshare/core/model"
 	"quickshare/core/repository"
+	"quickshare/pkg/crypto"
+	"quickshare/pkg/objectkey"
 	"time"
 )
 type UploadResponse struct {
-	ID        string    `json:"id"`
-	UploadURL string    `json:"upload_url"`
-	ObjectKey string    `json:"object_key"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ID        string `json:"id"`
+	UploadURL string `json:"upload_url"`
+	// UploadHeaders must be sent with the PUT to the upload URL (server-side encryption...)
+	UploadHeaders map[string]string `json:"upload_headers,omitempty"`
+	ObjectKey     string            `json:"object_key"`
+	ExpiresAt     time.Time         `json:"expires_at"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+type UploadListResponse struct {
+	Items      []*model.UploadObject `json:"items"`
+	NextCursor string                `json:"next_cursor,omitempty"`
+}
+
+// uploadKeyPrefix starts the object key of every upload
+const uploadKeyPrefix = "uploads"
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+)
+
+var (
+	ErrFileTooLarge         = errors.New("file exceeds the maximum allowed size")
+	ErrUploadDeleted        = errors.New("upload has been deleted")
+	ErrUploadNotDeleted     = errors.New("upload is not deleted")
+	ErrRestoreWindowExpired = errors.New("restore window has expired")
+	ErrMimeTypeNotAllowed   = errors.New("file type is not allowed")
+	ErrUploadNotScanning    = errors.New("upload is not being scanned")
+	ErrUploadQuarantined    = errors.New("upload is quarantined")
+	ErrInvalidEncryption    = errors.New("invalid encryption metadata")
+	ErrUploadIsBundle       = errors.New("upload is a bundle, use the bundle endpoints")
+	ErrUploadNotCompleted   = errors.New("upload not completed yet")
+	ErrUploadExpired        = errors.New("upload has expired")
+	ErrUploadNotPending     = errors.New("upload is not pending, it was already confirmed")
+)
+
+type UploadObjectServiceConfig struct {
+	PresignExpiry time.Duration
+	DefaultTTL    time.Duration
+	MaxFileSize   int64
+	// MaxTTL caps the expires_at clients ask for, no cap when zero
+	MaxTTL time.Duration
+	// KeySharding is one of the objectkey.Shard* schemes, the object keys of new uploads are spread with it
+	KeySharding string
+	// DeleteGracePeriod is how long a deleted upload can be restored before the janitor purges it
+	DeleteGracePeriod time.Duration
+	// MimePolicy is checked against the type sniffed from the content at confirm time
+	MimePolicy MimePolicy
+	// ScanUploads sends confirmed uploads to the scanning status instead of completing them
+	ScanUploads bool
+	// GeneratePreviews marks the completed image uploads for the preview worker
+	GeneratePreviews bool
 }
 
 type UploadObjectService struct {
 	repository  repository.UploadObjectRepository
 	blobStorage repository.BlobStorageRepository
+	events      repository.EventPublisher
+	config      UploadObjectServiceConfig
 }
 
-func NewUploadObjectService(repo repository.UploadObjectRepository, blobStorage repository.BlobStorageRepository) *UploadObjectService {
+func NewUploadObjectService(repo repository.UploadObjectRepository, blobStorage repository.BlobStorageRepository, events repository.EventPublisher, config UploadObjectServiceConfig) *UploadObjectService {
 	return &UploadObjectService{
 		repository:  repo,
 		blobStorage: blobStorage,
+		events:      events,
+		config:      config,
+	}
+}
+
+// newEvent builds the lifecycle event of the upload for the webhooks, the
+// upload in its payload is as it is about to be saved
+func newEvent(eventType string, uploadObject *model.UploadObject) (*model.WebhookEvent, error) {
+	event := &model.WebhookEvent{
+		ID:       randomID("evt_"),
+		Type:     eventType,
+		UploadID: uploadObject.ID,
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":         event.ID,
+		"type":       eventType,
+		"created_at": time.Now().UTC(),
+		"data":       map[string]interface{}{"upload": uploadObject},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	event.Payload = payload
+	return event, nil
+}
+
+// publish records an event that comes with no state change, such as a
+// download. A failure is logged and doesn't fail the request.
+func (s *UploadObjectService) publish(eventType string, uploadObject *model.UploadObject) {
+	event, err := newEvent(eventType, uploadObject)
+	if err == nil {
+		err = s.events.PublishEvent(event)
+	}
+	if err != nil {
+		log.Printf("error publishing %s event for upload %s: %v", eventType, uploadObject.ID, err)
+	}
+}
+
+// updateAndPublish saves the upload and its eventType event in one transaction
+func (s *UploadObjectService) updateAndPublish(id string, uploadObject *model.UploadObject, eventType string) (*model.UploadObject, error) {
+	uploadObject.UpdatedAt = time.Now().UTC()
+	event, err := newEvent(eventType, uploadObject)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.UpdateUploadObjectAndPublish(id, uploadObject, event)
+}
+
+// transition saves an upload leaving the from status, with its eventType event
+// unless empty. When a concurrent request moved the upload on first, the change
+// is dropped and conflict is returned.
+func (s *UploadObjectService) transition(id string, from string, uploadObject *model.UploadObject, eventType string, conflict error) (*model.UploadObject, error) {
+	uploadObject.UpdatedAt = time.Now().UTC()
+	var event *model.WebhookEvent
+	if eventType != "" {
+		var err error
+		if event, err = newEvent(eventType, uploadObject); err != nil {
+			return nil, err
+		}
 	}
+
+	updated, err := s.repository.TransitionUploadObject(id, from, uploadObject, event)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, conflict
+	}
+	return updated, err
 }
 
-func (s *UploadObjectService) generateID(uploadObject *model.UploadObject) string {
-	fileName := uploadObject.FileName[:2]
-	fileSize := fmt.Sprintf("%d", uploadObject.FileSize)[:2]
-	now := fmt.Sprintf("%d", time.Now().Unix())[:2]
+// validateEncryption checks the metadata of a client-side encrypted upload, the
+// server never decrypts it but clients must be able to
+func validateEncryption(encryption *model.Encryption) error {
+	if encryption == nil {
+		return nil
+	}
+	if !crypto.Supported(encryption.Algorithm) {
+		return fmt.Errorf("%w: algorithm must be one of %v", ErrInvalidEncryption, crypto.Algorithms())
+	}
+	if encryption.ChunkSize < crypto.MinChunkSize || encryption.ChunkSize > crypto.MaxChunkSize {
+		return fmt.Errorf("%w: chunk_size must be between %d and %d", ErrInvalidEncryption, crypto.MinChunkSize, crypto.MaxChunkSize)
+	}
+	return nil
+}
 
-	return fmt.Sprintf("%s%s%s", fileName, fileSize, now)
+// DeleteUploadObject moves the upload to the trash, the blob is kept until PurgeUploadObject
+func (s *UploadObjectService) DeleteUploadObject(id string) (*model.UploadObject, error) {
+	return s.trash(id, model.EventUploadDeleted)
 }
 
-func (s *UploadObjectService) DeleteUploadObject(id string) error {
+// ExpireUploadObject moves an upload past its expiry to the trash, where the
+// janitor purges it once the grace period is over
+func (s *UploadObjectService) ExpireUploadObject(id string) (*model.UploadObject, error) {
+	return s.trash(id, model.EventUploadExpired)
+}
+
+// trash soft deletes the upload and the members of a bundle, publishing eventType for each
+func (s *UploadObjectService) trash(id string, eventType string) (*model.UploadObject, error) {
 	uploadObject, err := s.repository.GetUploadObject(id)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if uploadObject.DeletedAt != nil {
+		return nil, ErrUploadDeleted
+	}
+
+	now := time.Now().UTC()
+	uploadObject.DeletedAt = &now
+	deleted, err := s.updateAndPublish(id, uploadObject, eventType)
+	if err != nil {
+		return nil, err
+	}
+
+	// the members of a bundle go to the trash with it, those already there keep their own deletion date
+	err = s.updateBundleMembers(deleted, func(member *model.UploadObject) string {
+		if member.DeletedAt != nil {
+			return ""
+		}
+		member.DeletedAt = &now
+		return eventType
+	})
+	return deleted, err
+}
+
+// updateBundleMembers saves the members change touched, change returns the event to publish or "" to skip the member
+func (s *UploadObjectService) updateBundleMembers(uploadObject *model.UploadObject, change func(member *model.UploadObject) string) error {
+	if uploadObject.Kind != model.UploadKindBundle {
+		return nil
+	}
+
+	members, err := s.repository.ListBundleMembers(uploadObject.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list the members of bundle %s: %w", uploadObject.ID, err)
+	}
+	for _, member := range members {
+		eventType := change(member)
+		if eventType == "" {
+			continue
+		}
+		if _, err := s.updateAndPublish(member.ID, member, eventType); err != nil {
+			return fmt.Errorf("failed to update member %s of bundle %s: %w", member.ID, uploadObject.ID, err)
+		}
 	}
+	return nil
+}
+
+// RestoreUploadObject takes the upload out of the trash while the grace period lasts
+func (s *UploadObjectService) RestoreUploadObject(id string) (*model.UploadObject, error) {
+	uploadObject, err := s.repository.GetUploadObject(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if uploadObject.DeletedAt == nil {
+		return nil, ErrUploadNotDeleted
+	}
+
+	if time.Since(*uploadObject.DeletedAt) > s.config.DeleteGracePeriod {
+		return nil, ErrRestoreWindowExpired
+	}
+
+	deletedAt := *uploadObject.DeletedAt
+	uploadObject.DeletedAt = nil
+	restored, err := s.updateAndPublish(id, uploadObject, model.EventUploadRestored)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the members trashed along with the bundle come back
+	err = s.updateBundleMembers(restored, func(member *model.UploadObject) string {
+		if member.DeletedAt == nil || !member.DeletedAt.Equal(deletedAt) {
+			return ""
+		}
+		member.DeletedAt = nil
+		return model.EventUploadRestored
+	})
+	return restored, err
+}
 
-	if err := s.blobStorage.Delete(uploadObject.ID); err != nil {
-		return fmt.Errorf("failed to delete from storage: %w", err)
+// ListTrash pages through soft deleted uploads, the filter's Trashed flag is forced
+func (s *UploadObjectService) ListTrash(filter repository.UploadObjectFilter, cursor string, limit int) (*UploadListResponse, error) {
+	filter.Trashed = true
+	return s.ListUploadObjects(filter, cursor, limit)
+}
+
+// PurgeUploadObject removes the row for good and queues the blob deletion,
+// the BlobDeletionWorker deletes the object from storage
+func (s *UploadObjectService) PurgeUploadObject(id string) error {
+	uploadObject, err := s.repository.GetUploadObject(id)
+	if err != nil {
+		return err
 	}
 
-	return s.repository.DeleteUploadObject(id)
+	event, err := newEvent(model.EventUploadPurged, uploadObject)
+	if err != nil {
+		return err
+	}
+	if err := s.repository.PurgeUploadObject(id, uploadObject.ObjectKey, event); err != nil {
+		return fmt.Errorf("failed to purge upload: %w", err)
+	}
+	return nil
 }
 
+// InitiateUpload validates the upload a client declared, a *ValidationError lists the invalid fields
 func (s *UploadObjectService) InitiateUpload(uploadObject *model.UploadObject) (*UploadResponse, error) {
+	if err := s.validateUpload(uploadObject); err != nil {
+		return nil, err
+	}
+
+	uploadObject.ID = randomID("")
+	return s.initiateUpload(uploadObject)
+}
+
+// initiateUpload creates the record of an upload whose ID is set and hands out its upload URL
+func (s *UploadObjectService) initiateUpload(uploadObject *model.UploadObject) (*UploadResponse, error) {
+	upload, event, err := s.prepareUpload(uploadObject)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. save to database
+	created, err := s.repository.CreateUploadObjectAndPublish(uploadObject, event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload object: %w", err)
+	}
+
+	return uploadResponse(created, upload), nil
+}
+
+// prepareUpload fills in the pending upload and presigns its URL, nothing is saved yet
+func (s *UploadObjectService) prepareUpload(uploadObject *model.UploadObject) (*repository.PresignedRequest, *model.WebhookEvent, error) {
+	if err := validateEncryption(uploadObject.Encryption); err != nil {
+		return nil, nil, err
+	}
+
 	// 1. create upload object
-	uploadObject.ID = s.generateID(uploadObject)
-	uploadObject.Status = "pending"
-	uploadObject.ObjectKey = fmt.Sprintf("uploads/%s/%s", uploadObject.ID, uploadObject.FileName)
+	uploadObject.Kind = model.UploadKindFile
+	uploadObject.Status = model.UploadStatusPending
+	// the key gets a sanitized copy of the name, FileName keeps the one to show
+	uploadObject.FileName = objectkey.Normalize(uploadObject.FileName)
+	uploadObject.ObjectKey = objectkey.Builder{Prefix: uploadKeyPrefix, Sharding: s.config.KeySharding}.Key(uploadObject.ID, uploadObject.FileName, time.Now())
+	uploadObject.StorageEncryption = s.blobStorage.StorageEncryption()
 
 	if uploadObject.ExpiresAt.IsZero() {
-		uploadObject.ExpiresAt = time.Now().Add(time.Hour * 24)
+		uploadObject.ExpiresAt = time.Now().Add(s.config.DefaultTTL)
 	}
 
-	// 2. create presigned URL for upload (expires in 15 minutes)
-	uploadURL, err := s.blobStorage.GeneratePresignedUploadURL(uploadObject.ObjectKey, 15*time.Minute)
+	// 2. create presigned URL for upload
+	upload, err := s.blobStorage.GeneratePresignedUploadURL(uploadObject.ObjectKey, s.config.PresignExpiry, uploadObject.FileName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate upload URL: %w", err)
+		return nil, nil, fmt.Errorf("failed to generate upload URL: %w", err)
 	}
 
-	// 3. save to database
-	created, err := s.repository.CreateUploadObject(uploadObject)
+	now := time.Now().UTC()
+	uploadObject.CreatedAt, uploadObject.UpdatedAt = now, now
+	event, err := newEvent(model.EventUploadInitiated, uploadObject)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create upload object: %w", err)
+		return nil, nil, err
 	}
+	return upload, event, nil
+}
 
+func uploadResponse(created *model.UploadObject, upload *repository.PresignedRequest) *UploadResponse {
 	return &UploadResponse{
-		ID:         created.ID,
-		UploadURL:  uploadURL,
-		ObjectKey:  created.ObjectKey,
-		ExpiresAt:  created.ExpiresAt,
-	}, nil
+		ID:            created.ID,
+		UploadURL:     upload.URL,
+		UploadHeaders: upload.Headers,
+		ObjectKey:     created.ObjectKey,
+		ExpiresAt:     created.ExpiresAt,
+		CreatedAt:     created.CreatedAt,
+	}
+}
+
+func (s *UploadObjectService) GetUploadObject(id string) (*model.UploadObject, error) {
+	return s.repository.GetUploadObject(id)
 }
 
 // ConfirmUpload check if file was uploaded and update status
-func (s *UploadObjectService) ConfirmUpload(id string) error {
+func (s *UploadObjectService) ConfirmUpload(id string) (*model.UploadObject, error) {
 	// 1. get upload object from database
 	uploadObject, err := s.repository.GetUploadObject(id)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if uploadObject.Kind == model.UploadKindBundle {
+		return nil, ErrUploadIsBundle
+	}
+
+	if uploadObject.DeletedAt != nil {
+		return nil, ErrUploadDeleted
+	}
+
+	// a confirmed upload was sniffed and scanned already, confirming it again
+	// would put a quarantined or rejected upload back in circulation
+	if uploadObject.Status != model.UploadStatusPending {
+		return nil, ErrUploadNotPending
 	}
 
 	// 2. check if object exists in storage
-	exists, err := s.blobStorage.ObjectExists(uploadObject.ObjectKey)
+	exists, err := s.blobStorage.ObjectExists(uploadObject.ObjectKey, uploadObject.StorageEncryption)
 	if err != nil {
-		return fmt.Errorf("failed to verify object: %w", err)
+		return nil, fmt.Errorf("failed to verify object: %w", err)
 	}
 
 	if !exists {
-		return errors.New("file not found in storage")
+		return nil, errors.New("file not found in storage")
+	}
+
+	// the declared mime type is whatever the client sent, check what was actually stored.
+	// Ciphertext can't be sniffed nor scanned, encrypted uploads skip both once
+	// their content proved to be ciphertext.
+	if uploadObject.Encryption != nil {
+		if err := s.checkCiphertext(uploadObject); err != nil {
+			return nil, err
+		}
+	}
+	if uploadObject.Encryption == nil {
+		head, err := s.blobStorage.ReadRange(uploadObject.ObjectKey, uploadObject.StorageEncryption, 0, SniffLength)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object: %w", err)
+		}
+		uploadObject.DetectedMimeType = DetectMimeType(head)
+		if !s.config.MimePolicy.Allows(uploadObject.DetectedMimeType) {
+			return nil, s.refuseUpload(id, uploadObject)
+		}
 	}
 
 	// 3. get object metadata
-	metadata, err := s.blobStorage.GetObjectMetadata(uploadObject.ObjectKey)
+	metadata, err := s.blobStorage.GetObjectMetadata(uploadObject.ObjectKey, uploadObject.StorageEncryption)
 	if err == nil {
 		// update file size if available
 		if size, ok := metadata["size"]; ok {
@@ -105,25 +418,204 @@ func (s *UploadObjectService) ConfirmUpload(id string) error {
 	}
 
 		// 4. Atualiza status para "completed"
-	uploadObject.Status = "completed"
-	_, err = s.repository.UpdateUploadObject(id, uploadObject)
-	return err
+	now := time.Now().UTC()
+	uploadObject.ConfirmedAt = &now
+	if s.config.ScanUploads && uploadObject.Encryption == nil {
+		// the scan worker completes or quarantines it
+		uploadObject.Status = model.UploadStatusScanning
+		return s.transition(id, model.UploadStatusPending, uploadObject, "", ErrUploadNotPending)
+	}
+	uploadObject.Status = model.UploadStatusCompleted
+	s.queuePreview(uploadObject)
+	return s.transition(id, model.UploadStatusPending, uploadObject, model.EventUploadCompleted, ErrUploadNotPending)
 }
 
-// GetDownloadURL create presigned URL for download
-func (s *UploadObjectService) GetDownloadURL(id string) (string, error) {
+// checkCiphertext makes sure an upload declared as encrypted starts with the
+// header its metadata describes. The metadata comes from the client, content
+// without that header is handled as plaintext: sniffed, scanned and served as is.
+func (s *UploadObjectService) checkCiphertext(uploadObject *model.UploadObject) error {
+	content, err := s.blobStorage.ReadRange(uploadObject.ObjectKey, uploadObject.StorageEncryption, 0, int64(crypto.HeaderPrefixSize))
+	if err != nil {
+		return fmt.Errorf("failed to read object: %w", err)
+	}
+
+	header, err := crypto.ParseHeader(content)
+	if err == nil && header.Algorithm == uploadObject.Encryption.Algorithm && header.ChunkSize == uploadObject.Encryption.ChunkSize {
+		return nil
+	}
+	log.Printf("upload %s doesn't start with the header of its %s encryption, handling it as plaintext", uploadObject.ID, uploadObject.Encryption.Algorithm)
+	uploadObject.Encryption = nil
+	return nil
+}
+
+// FinishScan applies the verdict of the malware scan to an upload in the scanning status
+func (s *UploadObjectService) FinishScan(id string, result repository.ScanResult) (*model.UploadObject, error) {
 	uploadObject, err := s.repository.GetUploadObject(id)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if uploadObject.Status != "completed" {
-		return "", errors.New("upload not completed yet")
+	if uploadObject.Status != model.UploadStatusScanning {
+		return nil, ErrUploadNotScanning
+	}
+
+	if result.Clean {
+		uploadObject.Status = model.UploadStatusCompleted
+		s.queuePreview(uploadObject)
+		return s.transition(id, model.UploadStatusScanning, uploadObject, model.EventUploadCompleted, ErrUploadNotScanning)
+	}
+
+	log.Printf("upload %s quarantined: %s found", id, result.Signature)
+	uploadObject.Status = model.UploadStatusQuarantined
+	uploadObject.QuarantineReason = "malware found: " + result.Signature
+	return s.transition(id, model.UploadStatusScanning, uploadObject, model.EventUploadQuarantined, ErrUploadNotScanning)
+}
+
+// FailScan quarantines an upload the scan worker gave up on, reason tells why
+// for the operators reviewing it
+func (s *UploadObjectService) FailScan(id string, reason string) (*model.UploadObject, error) {
+	uploadObject, err := s.repository.GetUploadObject(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if uploadObject.Status != model.UploadStatusScanning {
+		return nil, ErrUploadNotScanning
+	}
+
+	log.Printf("upload %s quarantined: %s", id, reason)
+	uploadObject.Status = model.UploadStatusQuarantined
+	uploadObject.QuarantineReason = reason
+	return s.transition(id, model.UploadStatusScanning, uploadObject, model.EventUploadQuarantined, ErrUploadNotScanning)
+}
+
+// refuseUpload applies the policy action to an upload whose content type isn't allowed.
+// Rejected uploads lose their object, quarantined ones keep it for review.
+func (s *UploadObjectService) refuseUpload(id string, uploadObject *model.UploadObject) error {
+	if s.config.MimePolicy.Action == MimePolicyActionQuarantine {
+		uploadObject.Status = model.UploadStatusQuarantined
+		uploadObject.QuarantineReason = fmt.Sprintf("mime type %s is not allowed", uploadObject.DetectedMimeType)
+		if _, err := s.transition(id, model.UploadStatusPending, uploadObject, model.EventUploadQuarantined, ErrUploadNotPending); err != nil {
+			return err
+		}
+	} else {
+		uploadObject.Status = model.UploadStatusRejected
+		uploadObject.UpdatedAt = time.Now().UTC()
+		// the blob deletion worker removes the object, retrying until the storage takes it
+		_, err := s.repository.RejectUploadObject(id, model.UploadStatusPending, uploadObject)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUploadNotPending
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("upload %s %s: detected type %s is not allowed", id, uploadObject.Status, uploadObject.DetectedMimeType)
+	return fmt.Errorf("%w: %s", ErrMimeTypeNotAllowed, uploadObject.DetectedMimeType)
+}
+
+// GetDownloadURL returns the public URL of the object, or a presigned one when the storage encryption requires it
+func (s *UploadObjectService) GetDownloadURL(id string) (*repository.PresignedRequest, error) {
+	uploadObject, err := s.repository.GetUploadObject(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// a deleted bundle is reported as deleted, like any other upload
+	if uploadObject.Kind == model.UploadKindBundle && uploadObject.DeletedAt == nil {
+		return nil, ErrUploadIsBundle
+	}
+
+	if err := checkDownloadable(uploadObject); err != nil {
+		return nil, err
+	}
+
+	// the object was stored with its Content-Disposition, the public URL names the file as well
+	download := &repository.PresignedRequest{URL: s.blobStorage.GetPublicURL(uploadObject.ObjectKey)}
+	// objects encrypted with a KMS or customer key can't be read anonymously
+	if encryption := uploadObject.StorageEncryption; encryption != nil && encryption.Mode != model.StorageEncryptionSSES3 {
+		download, err = s.blobStorage.GeneratePresignedDownloadURL(uploadObject.ObjectKey, uploadObject.StorageEncryption, s.config.PresignExpiry, uploadObject.FileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate download URL: %w", err)
+		}
+	}
+
+	s.publish(model.EventUploadDownloaded, uploadObject)
+
+	return download, nil
+}
+
+// GetSharedUpload returns an upload, bundles included, as long as it can be downloaded.
+// Unlike GetDownloadURL it doesn't record a download.
+func (s *UploadObjectService) GetSharedUpload(id string) (*model.UploadObject, error) {
+	uploadObject, err := s.repository.GetUploadObject(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDownloadable(uploadObject); err != nil {
+		return nil, err
+	}
+	return uploadObject, nil
+}
+
+// OpenObject streams the object of an upload through the server, for the clients that can't
+// send the headers its presigned URL requires (sse-c). GetDownloadURL records the download.
+func (s *UploadObjectService) OpenObject(id string) (*model.UploadObject, io.ReadCloser, error) {
+	uploadObject, err := s.GetSharedUpload(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if uploadObject.Kind == model.UploadKindBundle {
+		return nil, nil, ErrUploadIsBundle
+	}
+
+	content, err := s.blobStorage.Open(uploadObject.ObjectKey, uploadObject.StorageEncryption)
+	if err != nil {
+		return nil, nil, err
+	}
+	return uploadObject, content, nil
+}
+
+// checkDownloadable tells why the content of an upload, or its previews, can't be served
+func checkDownloadable(uploadObject *model.UploadObject) error {
+	if uploadObject.DeletedAt != nil {
+		return ErrUploadDeleted
+	}
+
+	if uploadObject.Status == model.UploadStatusQuarantined {
+		return ErrUploadQuarantined
+	}
+
+	if uploadObject.Status != model.UploadStatusCompleted {
+		return ErrUploadNotCompleted
 	}
 
 	if time.Now().After(uploadObject.ExpiresAt) {
-		return "", errors.New("upload has expired")
+		return ErrUploadExpired
+	}
+	return nil
+}
+
+// ListUploadObjects returns one page of uploads, limit is clamped to MaxListLimit
+func (s *UploadObjectService) ListUploadObjects(filter repository.UploadObjectFilter, cursor string, limit int) (*UploadListResponse, error) {
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
 	}
 
-    return s.blobStorage.GetPublicURL(uploadObject.ObjectKey), nil
+	uploadObjects, nextCursor, err := s.repository.ListUploadObjects(filter, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	if uploadObjects == nil {
+		uploadObjects = []*model.UploadObject{}
+	}
+
+	return &UploadListResponse{
+		Items:      uploadObjects,
+		NextCursor: nextCursor,
+	}, nil
 }
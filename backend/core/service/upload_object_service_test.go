@@ -0,0 +1,307 @@
+package service
+
+import (
+	"errors"
+	"quickshare/core/model"
+	"quickshare/pkg/crypto"
+	"quickshare/pkg/objectkey"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadObjectService_EncryptedUpload(t *testing.T) {
+	tests := []struct {
+		name       string
+		encryption *model.Encryption
+		wantErr    error
+	}{
+		{name: "success - supported algorithm", encryption: &model.Encryption{Algorithm: crypto.AlgorithmXChaCha20Poly1305, KeyHint: "fragment", ChunkSize: crypto.DefaultChunkSize}},
+		{name: "error - unknown algorithm", encryption: &model.Encryption{Algorithm: "ROT13", ChunkSize: crypto.DefaultChunkSize}, wantErr: ErrInvalidEncryption},
+		{name: "error - chunk size out of range", encryption: &model.Encryption{Algorithm: crypto.AlgorithmAES256GCM, ChunkSize: 16}, wantErr: ErrInvalidEncryption},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{}}
+			// ciphertext sniffs as application/octet-stream, which the allowlist refuses
+			blobStorage := &fakeBlobStorage{contents: map[string][]byte{}}
+			uploadObjectService := NewUploadObjectService(repo, blobStorage, &fakeEventPublisher{}, UploadObjectServiceConfig{
+				MimePolicy:  MimePolicy{Allow: []string{"application/pdf"}},
+				ScanUploads: true,
+			})
+
+			response, err := uploadObjectService.InitiateUpload(&model.UploadObject{
+				FileName:   "secret.pdf",
+				FileSize:   crypto.EncryptedSize(tt.encryption.Algorithm, 1024, crypto.DefaultChunkSize),
+				ExpiresAt:  time.Now().Add(time.Hour),
+				Encryption: tt.encryption,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			blobStorage.contents[response.ObjectKey] = []byte("QSE1\x02\x00\x01\x00\x00 opaque ciphertext")
+
+			// the server can't sniff nor scan ciphertext, the upload is completed as is
+			uploadObject, err := uploadObjectService.ConfirmUpload(response.ID)
+			if err != nil {
+				t.Fatalf("unexpected error confirming: %v", err)
+			}
+			if uploadObject.Status != model.UploadStatusCompleted || uploadObject.DetectedMimeType != "" {
+				t.Errorf("expected a completed upload without detected type, got %s %q", uploadObject.Status, uploadObject.DetectedMimeType)
+			}
+			if *uploadObject.Encryption != *tt.encryption {
+				t.Errorf("expected encryption %+v, got %+v", tt.encryption, uploadObject.Encryption)
+			}
+		})
+	}
+}
+
+// peExecutable is the start of a Windows executable, e_lfanew pointing at the PE signature
+func peExecutable() []byte {
+	content := make([]byte, 0x80)
+	copy(content, "MZ")
+	content[0x3c] = 0x40
+	copy(content[0x40:], "PE\x00\x00")
+	return content
+}
+
+func TestUploadObjectService_FakeEncryptionMetadata(t *testing.T) {
+	encryption := &model.Encryption{Algorithm: crypto.AlgorithmAES256GCM, ChunkSize: crypto.DefaultChunkSize}
+	otherChunkSize := []byte("QSE1\x01\x00\x00\x10\x00 opaque ciphertext")
+
+	tests := []struct {
+		name        string
+		content     []byte
+		scanUploads bool
+		wantErr     error
+		wantStatus  string
+	}{
+		{name: "plaintext executable refused by the deny list", content: peExecutable(), wantErr: ErrMimeTypeNotAllowed, wantStatus: model.UploadStatusRejected},
+		{name: "plaintext sent to the scanner", content: []byte("%PDF-1.7\n"), scanUploads: true, wantStatus: model.UploadStatusScanning},
+		{name: "header of another chunk size", content: otherChunkSize, scanUploads: true, wantStatus: model.UploadStatusScanning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{}}
+			blobStorage := &fakeBlobStorage{contents: map[string][]byte{}}
+			uploadObjectService := NewUploadObjectService(repo, blobStorage, &fakeEventPublisher{}, UploadObjectServiceConfig{
+				MimePolicy:  MimePolicy{Deny: []string{"application/vnd.microsoft.portable-executable"}},
+				ScanUploads: tt.scanUploads,
+			})
+
+			response, err := uploadObjectService.InitiateUpload(&model.UploadObject{FileName: "invoice.pdf", FileSize: int64(len(tt.content)), Encryption: encryption})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			blobStorage.contents[response.ObjectKey] = tt.content
+
+			if _, err := uploadObjectService.ConfirmUpload(response.ID); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			stored := repo.uploadObjects[response.ID]
+			if stored.Status != tt.wantStatus {
+				t.Errorf("expected status %s, got %s", tt.wantStatus, stored.Status)
+			}
+			if stored.Encryption != nil {
+				t.Errorf("expected the unproven encryption metadata to be dropped, got %+v", stored.Encryption)
+			}
+		})
+	}
+}
+
+func TestUploadObjectService_ConfirmUploadStatus(t *testing.T) {
+	tests := []struct {
+		status  string
+		wantErr error
+	}{
+		{status: model.UploadStatusPending},
+		{status: model.UploadStatusScanning, wantErr: ErrUploadNotPending},
+		{status: model.UploadStatusCompleted, wantErr: ErrUploadNotPending},
+		{status: model.UploadStatusQuarantined, wantErr: ErrUploadNotPending},
+		{status: model.UploadStatusRejected, wantErr: ErrUploadNotPending},
+		{status: model.UploadStatusFailed, wantErr: ErrUploadNotPending},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{
+				"do10172": {ID: "do10172", ObjectKey: "uploads/do10172/document.pdf", Status: tt.status, QuarantineReason: "kept", ExpiresAt: time.Now().Add(time.Hour)},
+			}}
+			uploadObjectService := NewUploadObjectService(repo, &fakeBlobStorage{}, &fakeEventPublisher{}, UploadObjectServiceConfig{})
+
+			_, err := uploadObjectService.ConfirmUpload("do10172")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil {
+				return
+			}
+			if stored := repo.uploadObjects["do10172"]; stored.Status != tt.status || stored.QuarantineReason != "kept" || len(repo.events) != 0 {
+				t.Errorf("expected the %s upload to be left alone, got %+v and events %v", tt.status, stored, repo.events)
+			}
+		})
+	}
+}
+
+func TestUploadObjectService_StorageEncryption(t *testing.T) {
+	tests := []struct {
+		name               string
+		encryption         *model.StorageEncryption
+		wantHeaders        bool
+		wantSignedDownload bool
+	}{
+		{name: "bucket default", encryption: nil},
+		{name: "sse-s3", encryption: &model.StorageEncryption{Mode: model.StorageEncryptionSSES3}},
+		{name: "sse-kms", encryption: &model.StorageEncryption{Mode: model.StorageEncryptionSSEKMS, KeyID: "alias/quickshare"}, wantSignedDownload: true},
+		{name: "sse-c", encryption: &model.StorageEncryption{Mode: model.StorageEncryptionSSEC, KeyID: "sha256:0011"}, wantHeaders: true, wantSignedDownload: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{}}
+			blobStorage := &fakeBlobStorage{encryption: tt.encryption}
+			uploadObjectService := NewUploadObjectService(repo, blobStorage, &fakeEventPublisher{}, UploadObjectServiceConfig{})
+
+			response, err := uploadObjectService.InitiateUpload(&model.UploadObject{
+				FileName:  "report.pdf",
+				FileSize:  1024,
+				ExpiresAt: time.Now().Add(time.Hour),
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (response.UploadHeaders["X-Amz-Server-Side-Encryption-Customer-Key"] != "") != tt.wantHeaders {
+				t.Errorf("expected customer key headers %v, got %v", tt.wantHeaders, response.UploadHeaders)
+			}
+			// the public URL of the unsigned downloads serves the object with the disposition stored on upload
+			if disposition := response.UploadHeaders["Content-Disposition"]; disposition != `attachment; filename="report.pdf"` {
+				t.Errorf("expected the upload to store the file name, got Content-Disposition %q", disposition)
+			}
+			if stored := repo.uploadObjects[response.ID]; !reflect.DeepEqual(stored.StorageEncryption, tt.encryption) {
+				t.Errorf("expected storage encryption %+v to be recorded, got %+v", tt.encryption, stored.StorageEncryption)
+			}
+
+			if _, err := uploadObjectService.ConfirmUpload(response.ID); err != nil {
+				t.Fatalf("unexpected error confirming: %v", err)
+			}
+			download, err := uploadObjectService.GetDownloadURL(response.ID)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if strings.Contains(download.URL, "X-Amz-Signature") != tt.wantSignedDownload {
+				t.Errorf("expected signed download %v, got %s", tt.wantSignedDownload, download.URL)
+			}
+			if (len(download.Headers) > 0) != tt.wantHeaders {
+				t.Errorf("expected download headers %v, got %v", tt.wantHeaders, download.Headers)
+			}
+		})
+	}
+}
+
+func TestUploadObjectService_InitiateUploadValidation(t *testing.T) {
+	tests := []struct {
+		name         string
+		uploadObject model.UploadObject
+		wantFields   []string
+		wantMimeType string
+	}{
+		{name: "valid", uploadObject: model.UploadObject{FileName: "report.pdf", FileSize: 1024, MimeType: "application/pdf"}, wantMimeType: "application/pdf"},
+		{name: "mime type parameters kept", uploadObject: model.UploadObject{FileName: "notes.txt", FileSize: 1, MimeType: "text/plain; charset=utf-8"}, wantMimeType: "text/plain; charset=utf-8"},
+		{name: "empty file", uploadObject: model.UploadObject{FileName: "empty.txt", MimeType: "text/plain"}, wantFields: []string{"file_size"}},
+		{name: "mime type defaults", uploadObject: model.UploadObject{FileName: "a", FileSize: 1}, wantMimeType: "application/octet-stream"},
+		{name: "empty file name", uploadObject: model.UploadObject{FileSize: 1}, wantFields: []string{"file_name"}},
+		{name: "path traversal", uploadObject: model.UploadObject{FileName: "../../etc/passwd", FileSize: 1}, wantFields: []string{"file_name"}},
+		{name: "windows path", uploadObject: model.UploadObject{FileName: `..\boot.ini`, FileSize: 1}, wantFields: []string{"file_name"}},
+		{name: "dot dot", uploadObject: model.UploadObject{FileName: "..", FileSize: 1}, wantFields: []string{"file_name"}},
+		{name: "control characters", uploadObject: model.UploadObject{FileName: "a\r\nb.txt", FileSize: 1}, wantFields: []string{"file_name"}},
+		{name: "file name too long", uploadObject: model.UploadObject{FileName: strings.Repeat("a", MaxFileNameLength+1), FileSize: 1}, wantFields: []string{"file_name"}},
+		{name: "negative size", uploadObject: model.UploadObject{FileName: "a.bin", FileSize: -1}, wantFields: []string{"file_size"}},
+		{name: "too large", uploadObject: model.UploadObject{FileName: "a.bin", FileSize: 2048}, wantFields: []string{"file_size"}},
+		{name: "malformed mime type", uploadObject: model.UploadObject{FileName: "a.bin", FileSize: 1, MimeType: "pdf"}, wantFields: []string{"mime_type"}},
+		{name: "expired", uploadObject: model.UploadObject{FileName: "a.bin", FileSize: 1, ExpiresAt: time.Now().Add(-time.Minute)}, wantFields: []string{"expires_at"}},
+		{name: "past the max TTL", uploadObject: model.UploadObject{FileName: "a.bin", FileSize: 1, ExpiresAt: time.Now().Add(48 * time.Hour)}, wantFields: []string{"expires_at"}},
+		{
+			name:         "every field reported",
+			uploadObject: model.UploadObject{FileName: "", FileSize: -5, MimeType: "text", ExpiresAt: time.Now().Add(-time.Hour)},
+			wantFields:   []string{"file_name", "file_size", "mime_type", "expires_at"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{}}
+			uploadObjectService := NewUploadObjectService(repo, &fakeBlobStorage{}, &fakeEventPublisher{}, UploadObjectServiceConfig{
+				DefaultTTL:  time.Hour,
+				MaxTTL:      24 * time.Hour,
+				MaxFileSize: 1024,
+			})
+
+			uploadObject := tt.uploadObject
+			response, err := uploadObjectService.InitiateUpload(&uploadObject)
+
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				var fields []string
+				for _, field := range validationErr.Fields {
+					fields = append(fields, field.Field)
+				}
+				if !reflect.DeepEqual(fields, tt.wantFields) {
+					t.Fatalf("expected invalid fields %v, got %v", tt.wantFields, validationErr.Fields)
+				}
+				if !errors.Is(err, ErrInvalidUpload) {
+					t.Errorf("expected the error to match ErrInvalidUpload")
+				}
+				return
+			}
+			if err != nil || tt.wantFields != nil {
+				t.Fatalf("expected invalid fields %v, got error %v", tt.wantFields, err)
+			}
+			if stored := repo.uploadObjects[response.ID]; stored.MimeType != tt.wantMimeType {
+				t.Errorf("expected mime type %q, got %q", tt.wantMimeType, stored.MimeType)
+			}
+		})
+	}
+}
+
+func TestUploadObjectService_ObjectKey(t *testing.T) {
+	tests := []struct {
+		name          string
+		fileName      string
+		sharding      string
+		wantFileName  string
+		wantKeyPrefix string
+		wantKeyName   string
+	}{
+		{name: "plain name", fileName: "report.pdf", wantFileName: "report.pdf", wantKeyPrefix: "uploads/", wantKeyName: "/report.pdf"},
+		{name: "display name kept", fileName: "Q3 report #2.pdf", wantFileName: "Q3 report #2.pdf", wantKeyPrefix: "uploads/", wantKeyName: "/Q3_report_2.pdf"},
+		{name: "normalized", fileName: " résumé.pdf", wantFileName: "résumé.pdf", wantKeyPrefix: "uploads/", wantKeyName: "/résumé.pdf"},
+		{name: "date sharding", fileName: "a.txt", sharding: objectkey.ShardDate, wantFileName: "a.txt", wantKeyPrefix: "uploads/" + time.Now().UTC().Format("2006/01/02") + "/", wantKeyName: "/a.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUploadObjectRepository{uploadObjects: map[string]*model.UploadObject{}}
+			uploadObjectService := NewUploadObjectService(repo, &fakeBlobStorage{}, &fakeEventPublisher{}, UploadObjectServiceConfig{KeySharding: tt.sharding})
+
+			response, err := uploadObjectService.InitiateUpload(&model.UploadObject{FileName: tt.fileName, FileSize: 1})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			stored := repo.uploadObjects[response.ID]
+			if stored.FileName != tt.wantFileName {
+				t.Errorf("expected file name %q, got %q", tt.wantFileName, stored.FileName)
+			}
+			if want := tt.wantKeyPrefix + response.ID + tt.wantKeyName; stored.ObjectKey != want {
+				t.Errorf("expected object key %q, got %q", want, stored.ObjectKey)
+			}
+		})
+	}
+}
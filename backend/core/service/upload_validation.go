@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"quickshare/core/model"
+	"quickshare/pkg/objectkey"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxFileNameLength is in bytes, the limit of most file systems
+	MaxFileNameLength = 255
+	maxMimeTypeLength = 255
+	// defaultMimeType is recorded for the uploads that don't declare one
+	defaultMimeType = "application/octet-stream"
+)
+
+var ErrInvalidUpload = errors.New("invalid upload")
+
+// FieldError tells what is wrong with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request, it matches ErrInvalidUpload
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Field + " " + field.Message
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalidUpload, strings.Join(messages, ", "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidUpload
+}
+
+// validateUpload checks what the client declared about a new upload and fills
+// the defaults in, every invalid field is reported at once
+func (s *UploadObjectService) validateUpload(uploadObject *model.UploadObject) error {
+	var fields []FieldError
+	invalid := func(field string, format string, args ...interface{}) {
+		fields = append(fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	uploadObject.FileName = objectkey.Normalize(uploadObject.FileName)
+	if err := checkFileName(uploadObject.FileName); err != nil {
+		invalid("file_name", "%v", err)
+	}
+
+	switch {
+	case uploadObject.FileSize <= 0:
+		invalid("file_size", "must be positive")
+	case s.config.MaxFileSize > 0 && uploadObject.FileSize > s.config.MaxFileSize:
+		invalid("file_size", "%v, at most %d bytes", ErrFileTooLarge, s.config.MaxFileSize)
+	}
+
+	uploadObject.MimeType = strings.TrimSpace(uploadObject.MimeType)
+	if uploadObject.MimeType == "" {
+		uploadObject.MimeType = defaultMimeType
+	} else if err := checkMimeType(uploadObject.MimeType); err != nil {
+		invalid("mime_type", "%v", err)
+	}
+
+	if err := s.checkExpiry(uploadObject.ExpiresAt); err != nil {
+		invalid("expires_at", "%v", err)
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// checkFileName accepts a plain file name, it is shown on the download page and
+// in the Content-Disposition of the downloads
+func checkFileName(name string) error {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return errors.New("is required")
+	case len(name) > MaxFileNameLength:
+		return fmt.Errorf("must be at most %d bytes", MaxFileNameLength)
+	case !utf8.ValidString(name):
+		return errors.New("must be valid UTF-8")
+	case strings.ContainsAny(name, `/\`), name == ".", name == "..":
+		return errors.New("must be a file name, not a path")
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		return errors.New("must not contain control characters")
+	}
+	return nil
+}
+
+func checkMimeType(mimeType string) error {
+	if len(mimeType) > maxMimeTypeLength {
+		return fmt.Errorf("must be at most %d bytes", maxMimeTypeLength)
+	}
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return errors.New("must be a MIME type such as application/pdf")
+	}
+	if kind, subtype, ok := strings.Cut(mediaType, "/"); !ok || kind == "" || subtype == "" || strings.Contains(subtype, "/") {
+		return errors.New("must be a MIME type such as application/pdf")
+	}
+	return nil
+}
+
+// checkExpiry accepts a zero time, the default TTL applies, or one in the
+// future within the max TTL
+func (s *UploadObjectService) checkExpiry(expiresAt time.Time) error {
+	if expiresAt.IsZero() {
+		return nil
+	}
+	now := time.Now()
+	if !expiresAt.After(now) {
+		return errors.New("must be in the future")
+	}
+	if s.config.MaxTTL > 0 && expiresAt.After(now.Add(s.config.MaxTTL)) {
+		return fmt.Errorf("must be within %s", s.config.MaxTTL)
+	}
+	return nil
+}
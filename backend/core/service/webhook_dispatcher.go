@@ -0,0 +1,130 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+	"strconv"
+	"time"
+)
+
+const (
+	webhookBatchSize = 50
+	// a claimed delivery is retried by another dispatcher if this one dies while sending
+	webhookLease = 2 * time.Minute
+
+	HeaderWebhookEvent     = "X-Quickshare-Event"
+	HeaderWebhookDelivery  = "X-Quickshare-Delivery"
+	HeaderWebhookSignature = "X-Quickshare-Signature"
+)
+
+type WebhookDispatcherConfig struct {
+	Interval          time.Duration
+	Timeout           time.Duration
+	MaxAttempts       int
+	RetryInitialDelay time.Duration
+	RetryMaxDelay     time.Duration
+}
+
+// WebhookDispatcher sends pending deliveries, failed ones are retried with
+// exponential backoff until MaxAttempts and then left in the dead state
+type WebhookDispatcher struct {
+	repository repository.WebhookRepository
+	client     *http.Client
+	config     WebhookDispatcherConfig
+}
+
+func NewWebhookDispatcher(repo repository.WebhookRepository, config WebhookDispatcherConfig) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		repository: repo,
+		client:     &http.Client{Timeout: config.Timeout},
+		config:     config,
+	}
+}
+
+func (d *WebhookDispatcher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		d.RunOnce()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *WebhookDispatcher) RunOnce() {
+	deliveries, err := d.repository.ClaimWebhookDeliveries(webhookBatchSize, webhookLease)
+	if err != nil {
+		log.Println("webhooks: error claiming deliveries", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		statusCode, err := d.send(delivery)
+		if err == nil {
+			if err := d.repository.MarkWebhookDeliveryDelivered(delivery.ID, statusCode); err != nil {
+				log.Println("webhooks: error marking delivery as delivered", delivery.ID, err)
+			}
+			continue
+		}
+
+		status := model.DeliveryStatusPending
+		nextAttemptAt := time.Now().Add(backoffDelay(delivery.Attempts, d.config.RetryInitialDelay, d.config.RetryMaxDelay))
+		if delivery.Attempts >= d.config.MaxAttempts {
+			status = model.DeliveryStatusDead
+		}
+
+		log.Printf("webhooks: delivery %d of %s to %s failed (attempt %d, now %s): %v", delivery.ID, delivery.EventType, delivery.WebhookURL, delivery.Attempts, status, err)
+		if err := d.repository.MarkWebhookDeliveryFailed(delivery.ID, status, nextAttemptAt, statusCode, err.Error()); err != nil {
+			log.Println("webhooks: error recording failed delivery", delivery.ID, err)
+		}
+	}
+}
+
+func (d *WebhookDispatcher) send(delivery *model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, delivery.WebhookURL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "quickshare-webhooks")
+	req.Header.Set(HeaderWebhookEvent, delivery.EventType)
+	req.Header.Set(HeaderWebhookDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderWebhookSignature, SignWebhookPayload(delivery.WebhookSecret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload returns the signature header value "t=<unix>,v1=<hex>", where
+// v1 is HMAC-SHA256(secret, "<unix>.<payload>"). Receivers recompute it and
+// should reject old timestamps to avoid replays.
+func SignWebhookPayload(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeWebhookRepository struct {
+	repository.WebhookRepository
+
+	due       []*model.WebhookDelivery
+	delivered map[int64]int
+	failed    map[int64]string
+}
+
+func (f *fakeWebhookRepository) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]*model.WebhookDelivery, error) {
+	due := f.due
+	f.due = nil
+	for _, delivery := range due {
+		delivery.Attempts++
+	}
+	return due, nil
+}
+
+func (f *fakeWebhookRepository) MarkWebhookDeliveryDelivered(id int64, statusCode int) error {
+	f.delivered[id] = statusCode
+	return nil
+}
+
+func (f *fakeWebhookRepository) MarkWebhookDeliveryFailed(id int64, status string, nextAttemptAt time.Time, statusCode int, lastError string) error {
+	f.failed[id] = status
+	return nil
+}
+
+func TestWebhookDispatcher_RunOnce(t *testing.T) {
+	payload := `{"type":"upload.completed"}`
+
+	tests := []struct {
+		name          string
+		statusCode    int
+		attempts      int
+		wantDelivered bool
+		wantStatus    string
+	}{
+		{name: "success - 2xx marks the delivery as delivered", statusCode: http.StatusNoContent, wantDelivered: true},
+		{name: "error - 5xx is retried", statusCode: http.StatusBadGateway, attempts: 1, wantStatus: model.DeliveryStatusPending},
+		{name: "error - last attempt goes to dead letter", statusCode: http.StatusInternalServerError, attempts: 2, wantStatus: model.DeliveryStatusDead},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+
+				signature := r.Header.Get(HeaderWebhookSignature)
+				timestamp, err := strconv.ParseInt(strings.TrimPrefix(strings.Split(signature, ",")[0], "t="), 10, 64)
+				if err != nil || SignWebhookPayload("whsec_test", timestamp, body) != signature {
+					t.Errorf("invalid signature %q", signature)
+				}
+				if r.Header.Get(HeaderWebhookEvent) != "upload.completed" {
+					t.Errorf("expected event header, got %q", r.Header.Get(HeaderWebhookEvent))
+				}
+
+				w.WriteHeader(tt.statusCode)
+			}))
+			defer server.Close()
+
+			repo := &fakeWebhookRepository{
+				due: []*model.WebhookDelivery{{
+					ID:            1,
+					EventType:     "upload.completed",
+					Attempts:      tt.attempts,
+					WebhookURL:    server.URL,
+					WebhookSecret: "whsec_test",
+					Payload:       []byte(payload),
+				}},
+				delivered: map[int64]int{},
+				failed:    map[int64]string{},
+			}
+
+			dispatcher := NewWebhookDispatcher(repo, WebhookDispatcherConfig{
+				Interval:          time.Second,
+				Timeout:           time.Second,
+				MaxAttempts:       3,
+				RetryInitialDelay: time.Second,
+				RetryMaxDelay:     time.Minute,
+			})
+			dispatcher.RunOnce()
+
+			if _, ok := repo.delivered[1]; ok != tt.wantDelivered {
+				t.Errorf("expected delivered %v, got %v", tt.wantDelivered, ok)
+			}
+			if repo.failed[1] != tt.wantStatus {
+				t.Errorf("expected failed status %q, got %q", tt.wantStatus, repo.failed[1])
+			}
+		})
+	}
+}
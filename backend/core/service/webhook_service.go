@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"quickshare/core/model"
+	"quickshare/core/repository"
+)
+
+const maxDeliveryListLimit = 200
+
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+type WebhookService struct {
+	repository repository.WebhookRepository
+}
+
+func NewWebhookService(repo repository.WebhookRepository) *WebhookService {
+	return &WebhookService{repository: repo}
+}
+
+// CreateWebhook registers an endpoint, the returned webhook is the only one carrying the signing secret
+func (s *WebhookService) CreateWebhook(endpoint string, events []string) (*model.Webhook, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidWebhook)
+	}
+
+	for _, event := range events {
+		if !knownEventType(event) {
+			return nil, fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+		}
+	}
+	if events == nil {
+		events = []string{}
+	}
+
+	return s.repository.CreateWebhook(&model.Webhook{
+		ID:     randomID("wh_"),
+		URL:    endpoint,
+		Secret: randomID("whsec_"),
+		Events: events,
+		Active: true,
+	})
+}
+
+func (s *WebhookService) ListWebhooks() ([]*model.Webhook, error) {
+	return s.repository.ListWebhooks()
+}
+
+func (s *WebhookService) DeleteWebhook(id string) error {
+	return s.repository.DeleteWebhook(id)
+}
+
+func (s *WebhookService) ListDeliveries(webhookID string, status string, limit int) ([]*model.WebhookDelivery, error) {
+	if _, err := s.repository.GetWebhook(webhookID); err != nil {
+		return nil, err
+	}
+
+	if limit <= 0 || limit > maxDeliveryListLimit {
+		limit = maxDeliveryListLimit
+	}
+	return s.repository.ListWebhookDeliveries(webhookID, status, limit)
+}
+
+func (s *WebhookService) Redeliver(deliveryID int64) (*model.WebhookDelivery, error) {
+	return s.repository.RedeliverWebhookDelivery(deliveryID)
+}
+
+func knownEventType(eventType string) bool {
+	for _, known := range model.EventTypes {
+		if known == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package bootstrap
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	"quickshare/internal/config"
+
+	_ "github.com/lib/pq"
+)
+
+// OpenDatabase opens the pool described by cfg and pings it, retrying with
+// exponential backoff and full jitter until cfg.ConnectRetries is exhausted
+func OpenDatabase(cfg config.DBConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", DSN(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime.Duration())
+
+	log.Printf("Attempting to connect to database at %s...", describe(cfg))
+
+	for attempt := 1; ; attempt++ {
+		err = db.Ping()
+		if err == nil {
+			log.Println("Successfully connected to database!")
+			return db, nil
+		}
+		if attempt >= cfg.ConnectRetries {
+			break
+		}
+
+		delay := Backoff(attempt, cfg.RetryInitialDelay.Duration(), cfg.RetryMaxDelay.Duration())
+		log.Printf("Retry %d/%d: Failed to ping database: %v (next attempt in %s)", attempt, cfg.ConnectRetries, err, delay.Round(time.Millisecond))
+		time.Sleep(delay)
+	}
+
+	db.Close()
+	return nil, fmt.Errorf("failed to connect to database after %d attempts: %w", cfg.ConnectRetries, err)
+}
+
+// DSN returns DATABASE_URL when set, otherwise a key/value connection string built from the individual fields
+func DSN(cfg config.DBConfig) string {
+	if cfg.URL != "" {
+		return cfg.URL
+	}
+
+	params := []struct{ key, value string }{
+		{"host", cfg.DBHost},
+		{"port", cfg.DBPort},
+		{"user", cfg.DBUser},
+		{"password", cfg.DBPassword},
+		{"dbname", cfg.DBName},
+		{"sslmode", cfg.SSLMode},
+		{"sslrootcert", cfg.SSLRootCert},
+	}
+
+	var parts []string
+	for _, p := range params {
+		if p.value != "" {
+			parts = append(parts, p.key+"="+quoteDSNValue(p.value))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Backoff returns a random delay in [0, min(max, initial*2^(attempt-1))]
+func Backoff(attempt int, initial, max time.Duration) time.Duration {
+	ceiling := initial
+	for i := 1; i < attempt && ceiling < max; i++ {
+		ceiling *= 2
+	}
+	if ceiling > max {
+		ceiling = max
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+func quoteDSNValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return "'" + escaped + "'"
+}
+
+// describe never includes credentials, it is only used for logs
+func describe(cfg config.DBConfig) string {
+	if cfg.URL != "" {
+		return "DATABASE_URL"
+	}
+	return cfg.DBHost + ":" + cfg.DBPort
+}
@@ -0,0 +1,58 @@
+package bootstrap
+
+import (
+	"quickshare/internal/config"
+	"testing"
+	"time"
+)
+
+func TestDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.DBConfig
+		want string
+	}{
+		{
+			name: "database url wins over fields",
+			cfg:  config.DBConfig{URL: "postgres://u:p@db:5432/qs?sslmode=require", DBHost: "ignored"},
+			want: "postgres://u:p@db:5432/qs?sslmode=require",
+		},
+		{
+			name: "fields with ssl options",
+			cfg: config.DBConfig{
+				DBHost: "db", DBPort: "5432", DBUser: "qs", DBPassword: "secret", DBName: "qs",
+				SSLMode: "verify-full", SSLRootCert: "/certs/ca.pem",
+			},
+			want: "host=db port=5432 user=qs password=secret dbname=qs sslmode=verify-full sslrootcert=/certs/ca.pem",
+		},
+		{
+			name: "values with spaces and quotes are escaped",
+			cfg:  config.DBConfig{DBHost: "db", DBPassword: `it's a secret`},
+			want: `host=db password='it\'s a secret'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DSN(tt.cfg); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	initial, max := 100*time.Millisecond, time.Second
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		ceiling := initial << (attempt - 1)
+		if ceiling > max {
+			ceiling = max
+		}
+		for i := 0; i < 50; i++ {
+			if got := Backoff(attempt, initial, max); got < 0 || got > ceiling {
+				t.Fatalf("attempt %d: expected delay in [0, %s], got %s", attempt, ceiling, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package bootstrap
+
+import (
+	"fmt"
+
+	"quickshare/adapter/repository"
+	"quickshare/internal/config"
+)
+
+// OpenBlobStorage builds the S3 adapter from cfg and fails fast when the bucket can't be reached
+func OpenBlobStorage(cfg config.S3Config) (*repository.S3BlobStorage, error) {
+	blobStorage, err := repository.NewS3BlobStorage(s3BlobStorageConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize S3: %w", err)
+	}
+
+	if err := blobStorage.CheckBucket(); err != nil {
+		return nil, fmt.Errorf("S3 bucket is not reachable: %w", err)
+	}
+
+	return blobStorage, nil
+}
+
+// OpenStorageEventQueue builds the SQS queue of the bucket notifications, with the S3 credentials
+func OpenStorageEventQueue(s3Config config.S3Config, cfg config.StorageEventsConfig) (*repository.SQSStorageEventQueue, error) {
+	queue, err := repository.NewSQSStorageEventQueue(s3BlobStorageConfig(s3Config), cfg.QueueURL, cfg.QueueEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize SQS: %w", err)
+	}
+	return queue, nil
+}
+
+func s3BlobStorageConfig(cfg config.S3Config) repository.S3BlobStorageConfig {
+	return repository.S3BlobStorageConfig{
+		Region:          cfg.Region,
+		Bucket:          cfg.Bucket,
+		AccessKeyID:     cfg.AccessKeyID,
+		SecretAccessKey: cfg.SecretAccessKey,
+
+		CredentialSource:     cfg.CredentialSource,
+		Profile:              cfg.Profile,
+		RoleARN:              cfg.RoleARN,
+		ExternalID:           cfg.ExternalID,
+		RoleSessionName:      cfg.RoleSessionName,
+		WebIdentityTokenFile: cfg.WebIdentityTokenFile,
+
+		Endpoint:        cfg.Endpoint,
+		PresignEndpoint: cfg.PresignEndpoint,
+		ForcePathStyle:  cfg.ForcePathStyle,
+		DisableSSL:      cfg.DisableSSL,
+		PublicBaseURL:   cfg.PublicBaseURL,
+
+		SSEMode:        cfg.SSEMode,
+		SSEKMSKeyID:    cfg.SSEKMSKeyID,
+		SSECustomerKey: cfg.SSECustomerKey,
+	}
+}
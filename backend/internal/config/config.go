@@ -1,62 +1,430 @@
 package config
 
-import "os"
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFileEnv  = "CONFIG_FILE"
+	configFileFlag = "config"
+	secretMask     = "********"
+)
 
 type DBConfig struct {
-	DBHost string
-	DBPort string
-	DBUser string
-	DBPassword string
-	DBName string
-}
+	Enabled     bool   `yaml:"enabled"`
+	URL         string `yaml:"url"`
+	DBHost      string `yaml:"host"`
+	DBPort      string `yaml:"port"`
+	DBUser      string `yaml:"user"`
+	DBPassword  string `yaml:"password"`
+	DBName      string `yaml:"name"`
+	SSLMode     string `yaml:"sslmode"`
+	SSLRootCert string `yaml:"sslrootcert"`
 
+	MaxOpenConns    int      `yaml:"max_open_conns"`
+	MaxIdleConns    int      `yaml:"max_idle_conns"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime"`
+
+	ConnectRetries    int      `yaml:"connect_retries"`
+	RetryInitialDelay Duration `yaml:"retry_initial_delay"`
+	RetryMaxDelay     Duration `yaml:"retry_max_delay"`
+}
 
 type ServerConfig struct {
-	Port string
+	Port string `yaml:"port"`
+	// PublicURL is the base of the share links put in QR codes, the origin of the request when empty
+	PublicURL string `yaml:"public_url"`
 }
 
 type S3Config struct {
-	Region          string
-	Bucket          string
-	AccessKeyID     string
-	SecretAccessKey string
+	Region          string `yaml:"region"`
+	Bucket          string `yaml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+
+	CredentialSource     string `yaml:"credential_source"`
+	Profile              string `yaml:"profile"`
+	RoleARN              string `yaml:"role_arn"`
+	ExternalID           string `yaml:"external_id"`
+	RoleSessionName      string `yaml:"role_session_name"`
+	WebIdentityTokenFile string `yaml:"web_identity_token_file"`
+
+	Endpoint        string `yaml:"endpoint"`
+	PresignEndpoint string `yaml:"presign_endpoint"`
+	ForcePathStyle  bool   `yaml:"force_path_style"`
+	DisableSSL      bool   `yaml:"disable_ssl"`
+	PublicBaseURL   string `yaml:"public_base_url"`
+
+	// SSEMode is sse-s3, sse-kms or sse-c, empty leaves encryption to the bucket default
+	SSEMode        string `yaml:"sse_mode"`
+	SSEKMSKeyID    string `yaml:"sse_kms_key_id"`
+	SSECustomerKey string `yaml:"sse_customer_key"`
+}
+
+type UploadConfig struct {
+	PresignExpiry Duration `yaml:"presign_expiry"`
+	DefaultTTL    Duration `yaml:"default_ttl"`
+	MaxFileSize   ByteSize `yaml:"max_file_size"`
+	// MaxTTL caps the expires_at clients ask for
+	MaxTTL Duration `yaml:"max_ttl"`
+	// KeySharding spreads the object keys of new uploads: none, date or hash
+	KeySharding string `yaml:"key_sharding"`
+	// DeleteGracePeriod is how long deleted uploads can be restored before being purged
+	DeleteGracePeriod Duration `yaml:"delete_grace_period"`
+	// the type sniffed at confirm time must match MimeAllowlist (when set) and not MimeDenylist,
+	// entries may be "type/*". MimePolicyAction is reject or quarantine.
+	MimeAllowlist    []string `yaml:"mime_allowlist"`
+	MimeDenylist     []string `yaml:"mime_denylist"`
+	MimePolicyAction string   `yaml:"mime_policy_action"`
+}
+
+type JanitorConfig struct {
+	Enabled        bool     `yaml:"enabled"`
+	Interval       Duration `yaml:"interval"`
+	PendingTimeout Duration `yaml:"pending_timeout"`
+}
+
+type WebhookConfig struct {
+	Enabled           bool     `yaml:"enabled"`
+	Interval          Duration `yaml:"interval"`
+	Timeout           Duration `yaml:"timeout"`
+	MaxAttempts       int      `yaml:"max_attempts"`
+	RetryInitialDelay Duration `yaml:"retry_initial_delay"`
+	RetryMaxDelay     Duration `yaml:"retry_max_delay"`
+}
+
+type StorageEventsConfig struct {
+	// QueueURL is the SQS queue receiving the bucket ObjectCreated notifications, empty disables the poller
+	QueueURL      string   `yaml:"queue_url"`
+	QueueEndpoint string   `yaml:"queue_endpoint"`
+	WaitTime      Duration `yaml:"wait_time"`
+}
+
+type ScannerConfig struct {
+	// Address of clamd (tcp://host:3310 or unix:///path/to/clamd.sock), empty disables scanning
+	Address  string   `yaml:"address"`
+	Timeout  Duration `yaml:"timeout"`
+	Interval Duration `yaml:"interval"`
+	// MaxAttempts failed scans quarantine the upload
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+type PreviewConfig struct {
+	// Enabled runs the preview worker, completed image uploads then get thumbnails
+	Enabled  bool     `yaml:"enabled"`
+	Interval Duration `yaml:"interval"`
+	// images are decoded in memory, larger files or images with more pixels get no preview
+	MaxSourceSize ByteSize `yaml:"max_source_size"`
+	MaxPixels     int      `yaml:"max_pixels"`
+	// MaxAttempts failed runs, storage or database errors, mark the preview as failed
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+type QRCodeConfig struct {
+	// Size is the width of the PNG codes in pixels, rounded down to a whole number of pixels per module
+	Size int `yaml:"size"`
+	// Level is the error correction level: L, M, Q or H
+	Level string `yaml:"level"`
+}
+
+type AdminConfig struct {
+	// Token protects the /admin API, which is disabled when empty
+	Token string `yaml:"token"`
 }
 
 type Config struct {
-	DBConfig     *DBConfig
-	ServerConfig *ServerConfig
-	S3Config     *S3Config
+	DBConfig      DBConfig      `yaml:"db"`
+	ServerConfig  ServerConfig  `yaml:"server"`
+	S3Config      S3Config      `yaml:"s3"`
+	UploadConfig  UploadConfig  `yaml:"upload"`
+	JanitorConfig JanitorConfig `yaml:"janitor"`
+	AdminConfig   AdminConfig   `yaml:"admin"`
+	WebhookConfig WebhookConfig `yaml:"webhooks"`
+
+	StorageEventsConfig StorageEventsConfig `yaml:"storage_events"`
+	ScannerConfig       ScannerConfig       `yaml:"scanner"`
+	PreviewConfig       PreviewConfig       `yaml:"previews"`
+	QRCodeConfig        QRCodeConfig        `yaml:"qr_codes"`
 }
 
-func NewConfig() *Config {
-	var dbConfig DBConfig
-	var serverConfig ServerConfig
-	var s3Config S3Config
+// binding ties a config field to its env var and command line flag
+type binding struct {
+	env    string
+	flag   string
+	usage  string
+	secret bool
+	value  flag.Value
+}
+
+func (c *Config) bindings() []binding {
+	return []binding{
+		{env: "DB_ENABLED", flag: "db-enabled", usage: "connect to the database", value: (*boolValue)(&c.DBConfig.Enabled)},
+		{env: "DATABASE_URL", flag: "database-url", usage: "full database DSN, replaces the individual db fields", secret: true, value: (*stringValue)(&c.DBConfig.URL)},
+		{env: "DB_HOST", flag: "db-host", usage: "database host", value: (*stringValue)(&c.DBConfig.DBHost)},
+		{env: "DB_PORT", flag: "db-port", usage: "database port", value: (*stringValue)(&c.DBConfig.DBPort)},
+		{env: "DB_USER", flag: "db-user", usage: "database user", value: (*stringValue)(&c.DBConfig.DBUser)},
+		{env: "DB_PASSWORD", flag: "db-password", usage: "database password", secret: true, value: (*stringValue)(&c.DBConfig.DBPassword)},
+		{env: "DB_NAME", flag: "db-name", usage: "database name", value: (*stringValue)(&c.DBConfig.DBName)},
+		{env: "DB_SSLMODE", flag: "db-sslmode", usage: "database sslmode (disable, require, verify-ca, verify-full...)", value: (*stringValue)(&c.DBConfig.SSLMode)},
+		{env: "DB_SSLROOTCERT", flag: "db-sslrootcert", usage: "path to the database root CA certificate", value: (*stringValue)(&c.DBConfig.SSLRootCert)},
+		{env: "DB_MAX_OPEN_CONNS", flag: "db-max-open-conns", usage: "maximum open connections, 0 means unlimited", value: (*intValue)(&c.DBConfig.MaxOpenConns)},
+		{env: "DB_MAX_IDLE_CONNS", flag: "db-max-idle-conns", usage: "maximum idle connections", value: (*intValue)(&c.DBConfig.MaxIdleConns)},
+		{env: "DB_CONN_MAX_LIFETIME", flag: "db-conn-max-lifetime", usage: "maximum lifetime of a connection, 0 means forever", value: &c.DBConfig.ConnMaxLifetime},
+		{env: "DB_CONNECT_RETRIES", flag: "db-connect-retries", usage: "connection attempts at startup", value: (*intValue)(&c.DBConfig.ConnectRetries)},
+		{env: "DB_RETRY_INITIAL_DELAY", flag: "db-retry-initial-delay", usage: "first backoff delay between connection attempts", value: &c.DBConfig.RetryInitialDelay},
+		{env: "DB_RETRY_MAX_DELAY", flag: "db-retry-max-delay", usage: "largest backoff delay between connection attempts", value: &c.DBConfig.RetryMaxDelay},
+
+		{env: "PORT", flag: "port", usage: "HTTP listen port", value: (*stringValue)(&c.ServerConfig.Port)},
+		{env: "PUBLIC_URL", flag: "public-url", usage: "base URL of the share links, taken from the request when empty", value: (*stringValue)(&c.ServerConfig.PublicURL)},
+
+		{env: "AWS_REGION", flag: "s3-region", usage: "S3 region", value: (*stringValue)(&c.S3Config.Region)},
+		{env: "AWS_BUCKET_NAME", flag: "s3-bucket", usage: "S3 bucket name", value: (*stringValue)(&c.S3Config.Bucket)},
+		{env: "AWS_ACCESS_KEY_ID", flag: "s3-access-key-id", usage: "S3 access key id", secret: true, value: (*stringValue)(&c.S3Config.AccessKeyID)},
+		{env: "AWS_SECRET_ACCESS_KEY", flag: "s3-secret-access-key", usage: "S3 secret access key", secret: true, value: (*stringValue)(&c.S3Config.SecretAccessKey)},
+
+		{env: "S3_CREDENTIAL_SOURCE", flag: "s3-credential-source", usage: "default, static, profile, web_identity or assume_role", value: (*stringValue)(&c.S3Config.CredentialSource)},
+		{env: "AWS_PROFILE", flag: "s3-profile", usage: "shared config profile used by the profile source", value: (*stringValue)(&c.S3Config.Profile)},
+		{env: "AWS_ROLE_ARN", flag: "s3-role-arn", usage: "role assumed by the web_identity and assume_role sources", value: (*stringValue)(&c.S3Config.RoleARN)},
+		{env: "AWS_EXTERNAL_ID", flag: "s3-external-id", usage: "external id sent when assuming the role", secret: true, value: (*stringValue)(&c.S3Config.ExternalID)},
+		{env: "AWS_ROLE_SESSION_NAME", flag: "s3-role-session-name", usage: "session name of the assumed role", value: (*stringValue)(&c.S3Config.RoleSessionName)},
+		{env: "AWS_WEB_IDENTITY_TOKEN_FILE", flag: "s3-web-identity-token-file", usage: "token file used by the web_identity source", value: (*stringValue)(&c.S3Config.WebIdentityTokenFile)},
+		{env: "S3_ENDPOINT", flag: "s3-endpoint", usage: "custom S3-compatible endpoint (MinIO, Ceph, LocalStack...)", value: (*stringValue)(&c.S3Config.Endpoint)},
+		{env: "S3_PRESIGN_ENDPOINT", flag: "s3-presign-endpoint", usage: "endpoint used in presigned URLs when clients reach the storage on another host", value: (*stringValue)(&c.S3Config.PresignEndpoint)},
+		{env: "S3_FORCE_PATH_STYLE", flag: "s3-force-path-style", usage: "use path-style bucket addressing", value: (*boolValue)(&c.S3Config.ForcePathStyle)},
+		{env: "S3_DISABLE_SSL", flag: "s3-disable-ssl", usage: "talk plain HTTP to the endpoint", value: (*boolValue)(&c.S3Config.DisableSSL)},
+		{env: "S3_PUBLIC_BASE_URL", flag: "s3-public-base-url", usage: "base URL of the download links handed out", value: (*stringValue)(&c.S3Config.PublicBaseURL)},
+		{env: "S3_SSE_MODE", flag: "s3-sse-mode", usage: "server-side encryption: sse-s3, sse-kms or sse-c", value: (*stringValue)(&c.S3Config.SSEMode)},
+		{env: "S3_SSE_KMS_KEY_ID", flag: "s3-sse-kms-key-id", usage: "KMS key of sse-kms, the AWS managed key when empty", value: (*stringValue)(&c.S3Config.SSEKMSKeyID)},
+		{env: "S3_SSE_CUSTOMER_KEY", flag: "s3-sse-customer-key", usage: "master secret the sse-c object keys are derived from", secret: true, value: (*stringValue)(&c.S3Config.SSECustomerKey)},
+
+		{env: "UPLOAD_PRESIGN_EXPIRY", flag: "upload-presign-expiry", usage: "lifetime of presigned upload URLs", value: &c.UploadConfig.PresignExpiry},
+		{env: "UPLOAD_DEFAULT_TTL", flag: "upload-default-ttl", usage: "expiry of uploads that don't set expires_at", value: &c.UploadConfig.DefaultTTL},
+		{env: "UPLOAD_MAX_FILE_SIZE", flag: "upload-max-file-size", usage: "largest accepted file", value: &c.UploadConfig.MaxFileSize},
+		{env: "UPLOAD_MAX_TTL", flag: "upload-max-ttl", usage: "furthest expires_at accepted", value: &c.UploadConfig.MaxTTL},
+		{env: "UPLOAD_KEY_SHARDING", flag: "upload-key-sharding", usage: "prefix sharding of new object keys: none, date or hash", value: (*stringValue)(&c.UploadConfig.KeySharding)},
+		{env: "UPLOAD_DELETE_GRACE_PERIOD", flag: "upload-delete-grace-period", usage: "how long deleted uploads can be restored", value: &c.UploadConfig.DeleteGracePeriod},
+		{env: "UPLOAD_MIME_ALLOWLIST", flag: "upload-mime-allowlist", usage: "comma separated detected types accepted, empty accepts all", value: (*stringListValue)(&c.UploadConfig.MimeAllowlist)},
+		{env: "UPLOAD_MIME_DENYLIST", flag: "upload-mime-denylist", usage: "comma separated detected types refused", value: (*stringListValue)(&c.UploadConfig.MimeDenylist)},
+		{env: "UPLOAD_MIME_POLICY_ACTION", flag: "upload-mime-policy-action", usage: "what happens to refused uploads: reject or quarantine", value: (*stringValue)(&c.UploadConfig.MimePolicyAction)},
+
+		{env: "ADMIN_TOKEN", flag: "admin-token", usage: "bearer token of the /admin API, empty disables it", secret: true, value: (*stringValue)(&c.AdminConfig.Token)},
+
+		{env: "WEBHOOKS_ENABLED", flag: "webhooks-enabled", usage: "run the webhook dispatcher", value: (*boolValue)(&c.WebhookConfig.Enabled)},
+		{env: "WEBHOOKS_INTERVAL", flag: "webhooks-interval", usage: "time between dispatcher runs", value: &c.WebhookConfig.Interval},
+		{env: "WEBHOOKS_TIMEOUT", flag: "webhooks-timeout", usage: "timeout of a single delivery", value: &c.WebhookConfig.Timeout},
+		{env: "WEBHOOKS_MAX_ATTEMPTS", flag: "webhooks-max-attempts", usage: "attempts before a delivery is dead", value: (*intValue)(&c.WebhookConfig.MaxAttempts)},
+		{env: "WEBHOOKS_RETRY_INITIAL_DELAY", flag: "webhooks-retry-initial-delay", usage: "delay before the first retry", value: &c.WebhookConfig.RetryInitialDelay},
+		{env: "WEBHOOKS_RETRY_MAX_DELAY", flag: "webhooks-retry-max-delay", usage: "largest delay between retries", value: &c.WebhookConfig.RetryMaxDelay},
+
+		{env: "STORAGE_EVENTS_QUEUE_URL", flag: "storage-events-queue-url", usage: "SQS queue of the bucket notifications, empty disables the poller", value: (*stringValue)(&c.StorageEventsConfig.QueueURL)},
+		{env: "STORAGE_EVENTS_QUEUE_ENDPOINT", flag: "storage-events-queue-endpoint", usage: "custom SQS endpoint (LocalStack, ElasticMQ...)", value: (*stringValue)(&c.StorageEventsConfig.QueueEndpoint)},
+		{env: "STORAGE_EVENTS_WAIT_TIME", flag: "storage-events-wait-time", usage: "long polling wait of a single receive", value: &c.StorageEventsConfig.WaitTime},
 
-	dbConfig.DBHost = os.Getenv("DB_HOST")
-	dbConfig.DBPort = os.Getenv("DB_PORT")
-	dbConfig.DBUser = os.Getenv("DB_USER")
-	dbConfig.DBPassword = os.Getenv("DB_PASSWORD")
-	dbConfig.DBName = os.Getenv("DB_NAME")
+		{env: "SCANNER_ADDRESS", flag: "scanner-address", usage: "clamd address (tcp://host:port or unix:///path), empty disables scanning", value: (*stringValue)(&c.ScannerConfig.Address)},
+		{env: "SCANNER_TIMEOUT", flag: "scanner-timeout", usage: "timeout of every exchange with clamd", value: &c.ScannerConfig.Timeout},
+		{env: "SCANNER_INTERVAL", flag: "scanner-interval", usage: "time between scan worker runs", value: &c.ScannerConfig.Interval},
+		{env: "SCANNER_MAX_ATTEMPTS", flag: "scanner-max-attempts", usage: "failed scans before an upload is quarantined", value: (*intValue)(&c.ScannerConfig.MaxAttempts)},
 
-	serverConfig.Port = os.Getenv("PORT")
+		{env: "PREVIEWS_ENABLED", flag: "previews-enabled", usage: "make thumbnails of the image uploads", value: (*boolValue)(&c.PreviewConfig.Enabled)},
+		{env: "PREVIEWS_INTERVAL", flag: "previews-interval", usage: "time between preview worker runs", value: &c.PreviewConfig.Interval},
+		{env: "PREVIEWS_MAX_SOURCE_SIZE", flag: "previews-max-source-size", usage: "largest image a preview is made of", value: &c.PreviewConfig.MaxSourceSize},
+		{env: "PREVIEWS_MAX_PIXELS", flag: "previews-max-pixels", usage: "most pixels of an image a preview is made of", value: (*intValue)(&c.PreviewConfig.MaxPixels)},
+		{env: "PREVIEWS_MAX_ATTEMPTS", flag: "previews-max-attempts", usage: "failed runs before a preview is marked as failed", value: (*intValue)(&c.PreviewConfig.MaxAttempts)},
 
-	s3Config.Region = getEnvOrDefault("AWS_REGION", "us-east-2")
-	s3Config.Bucket = getEnvOrDefault("AWS_BUCKET_NAME", "quickshare-assets")
-	s3Config.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
-	s3Config.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		{env: "QR_CODES_SIZE", flag: "qr-codes-size", usage: "width of the PNG QR codes in pixels", value: (*intValue)(&c.QRCodeConfig.Size)},
+		{env: "QR_CODES_LEVEL", flag: "qr-codes-level", usage: "error correction level of the QR codes: L, M, Q or H", value: (*stringValue)(&c.QRCodeConfig.Level)},
 
+		{env: "JANITOR_ENABLED", flag: "janitor-enabled", usage: "run the background lifecycle rules", value: (*boolValue)(&c.JanitorConfig.Enabled)},
+		{env: "JANITOR_INTERVAL", flag: "janitor-interval", usage: "time between janitor runs", value: &c.JanitorConfig.Interval},
+		{env: "JANITOR_PENDING_TIMEOUT", flag: "janitor-pending-timeout", usage: "pending uploads older than this are marked as failed", value: &c.JanitorConfig.PendingTimeout},
+	}
+}
+
+func defaults() *Config {
 	return &Config{
-		DBConfig:     &dbConfig,
-		ServerConfig: &serverConfig,
-		S3Config:     &s3Config,
+		DBConfig: DBConfig{
+			Enabled:           true,
+			DBPort:            "5432",
+			SSLMode:           "disable",
+			MaxOpenConns:      25,
+			MaxIdleConns:      5,
+			ConnMaxLifetime:   Duration(30 * time.Minute),
+			ConnectRetries:    5,
+			RetryInitialDelay: Duration(500 * time.Millisecond),
+			RetryMaxDelay:     Duration(30 * time.Second),
+		},
+		ServerConfig: ServerConfig{
+			Port: "3000",
+		},
+		S3Config: S3Config{
+			Region:          "us-east-2",
+			Bucket:          "quickshare-assets",
+			RoleSessionName: "quickshare",
+		},
+		UploadConfig: UploadConfig{
+			PresignExpiry: Duration(15 * time.Minute),
+			DefaultTTL:    Duration(24 * time.Hour),
+			MaxFileSize:   5 * GiB,
+			MaxTTL:        Duration(30 * 24 * time.Hour),
+
+			DeleteGracePeriod: Duration(7 * 24 * time.Hour),
+
+			MimeDenylist: []string{
+				"application/vnd.microsoft.portable-executable",
+				"application/x-elf",
+				"application/x-mach-binary",
+				"application/vnd.android.dex",
+			},
+			MimePolicyAction: "reject",
+		},
+		WebhookConfig: WebhookConfig{
+			Enabled:           true,
+			Interval:          Duration(5 * time.Second),
+			Timeout:           Duration(10 * time.Second),
+			MaxAttempts:       10,
+			RetryInitialDelay: Duration(30 * time.Second),
+			RetryMaxDelay:     Duration(6 * time.Hour),
+		},
+		StorageEventsConfig: StorageEventsConfig{
+			WaitTime: Duration(20 * time.Second),
+		},
+		ScannerConfig: ScannerConfig{
+			Timeout:     Duration(30 * time.Second),
+			Interval:    Duration(5 * time.Second),
+			MaxAttempts: 5,
+		},
+		PreviewConfig: PreviewConfig{
+			Enabled:       true,
+			Interval:      Duration(5 * time.Second),
+			MaxSourceSize: 20 * MiB,
+			MaxPixels:     25_000_000,
+			MaxAttempts:   5,
+		},
+		QRCodeConfig: QRCodeConfig{
+			Size:  320,
+			Level: "M",
+		},
+		JanitorConfig: JanitorConfig{
+			Enabled:        true,
+			Interval:       Duration(time.Minute),
+			PendingTimeout: Duration(time.Hour),
+		},
 	}
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// Load builds the config from, in increasing priority: defaults, the YAML file
+// given by --config or CONFIG_FILE, env vars (or their *_FILE variant for secrets) and flags.
+// Every source problem is reported at once, semantic checks are left to Validate.
+func Load(args []string) (*Config, error) {
+	cfg := defaults()
+	var problems []string
+
+	if path := configFilePath(args); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	problems = append(problems, cfg.loadEnv()...)
+
+	fs := flag.NewFlagSet("quickshare", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.String(configFileFlag, "", "path to a YAML config file")
+	for _, b := range cfg.bindings() {
+		fs.Var(b.value, b.flag, b.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
 	}
-	return value
-}
\ No newline at end of file
+	return nil
+}
+
+func (c *Config) loadEnv() []string {
+	var problems []string
+
+	for _, b := range c.bindings() {
+		value, ok := os.LookupEnv(b.env)
+
+		if b.secret {
+			if path := os.Getenv(b.env + "_FILE"); path != "" {
+				content, err := os.ReadFile(path)
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("%s_FILE: %v", b.env, err))
+					continue
+				}
+				value, ok = strings.TrimRight(string(content), "\r\n"), true
+			}
+		}
+
+		if !ok || value == "" {
+			continue
+		}
+		if err := b.value.Set(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", b.env, err))
+		}
+	}
+
+	return problems
+}
+
+// configFilePath looks for --config before the full flag parsing, since the
+// file has to be applied before env vars and flags
+func configFilePath(args []string) string {
+	for i, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+		if name == configFileFlag && i+1 < len(args) {
+			return args[i+1]
+		}
+		if value, ok := strings.CutPrefix(name, configFileFlag+"="); ok {
+			return value
+		}
+	}
+	return os.Getenv(configFileEnv)
+}
+
+// Print writes the effective config as YAML with every secret masked
+func (c *Config) Print(w io.Writer) error {
+	masked := *c
+	for _, b := range masked.bindings() {
+		if b.secret && b.value.String() != "" {
+			b.value.Set(secretMask)
+		}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&masked); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
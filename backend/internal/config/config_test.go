@@ -0,0 +1,128 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestByteSize_Set(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    ByteSize
+		wantErr bool
+	}{
+		{input: "1024", want: 1024},
+		{input: "5GiB", want: 5 * GiB},
+		{input: "500MB", want: 500 * MB},
+		{input: "10 kib", want: 10 * KiB},
+		{input: "-1GB", wantErr: true},
+		{input: "big", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var got ByteSize
+			err := got.Set(tt.input)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	content := "db:\n  host: from-file\n  user: file-user\nupload:\n  presign_expiry: 5m\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, "password")
+	if err := os.WriteFile(secret, []byte("from-secret-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("DB_USER", "env-user")
+	t.Setenv("DB_HOST", "env-host")
+	t.Setenv("DB_PASSWORD_FILE", secret)
+
+	cfg, err := Load([]string{"--config", file, "--db-host", "flag-host"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.DBConfig.DBHost != "flag-host" {
+		t.Errorf("expected flag to win, got host %q", cfg.DBConfig.DBHost)
+	}
+	if cfg.DBConfig.DBUser != "env-user" {
+		t.Errorf("expected env to override file, got user %q", cfg.DBConfig.DBUser)
+	}
+	if cfg.DBConfig.DBPassword != "from-secret-file" {
+		t.Errorf("expected password from secret file, got %q", cfg.DBConfig.DBPassword)
+	}
+	if cfg.UploadConfig.PresignExpiry.Duration() != 5*time.Minute {
+		t.Errorf("expected presign expiry from file, got %s", cfg.UploadConfig.PresignExpiry)
+	}
+	if cfg.S3Config.Bucket != "quickshare-assets" {
+		t.Errorf("expected default bucket, got %q", cfg.S3Config.Bucket)
+	}
+}
+
+func TestConfig_ValidateListsEveryProblem(t *testing.T) {
+	cfg := defaults()
+	cfg.ServerConfig.Port = "abc"
+	cfg.S3Config.Bucket = ""
+
+	err := cfg.Validate()
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected ValidationError, got %v", err)
+	}
+	// port, bucket, db host, db user and db name
+	if len(validationErr.Problems) != 5 {
+		t.Errorf("expected 5 problems, got %d: %v", len(validationErr.Problems), validationErr.Problems)
+	}
+}
+
+func TestConfig_ValidateQRCodes(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		level     string
+		publicURL string
+		wantErr   bool
+	}{
+		{name: "defaults", size: 320, level: "M"},
+		{name: "level by name", size: 320, level: "high", publicURL: "https://share.example.com/"},
+		{name: "unknown level", size: 320, level: "X", wantErr: true},
+		{name: "too small to scan", size: 32, level: "L", wantErr: true},
+		{name: "public URL without scheme", size: 320, level: "M", publicURL: "share.example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaults()
+			cfg.DBConfig.Enabled = false
+			cfg.QRCodeConfig = QRCodeConfig{Size: tt.size, Level: tt.level}
+			cfg.ServerConfig.PublicURL = tt.publicURL
+
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration that reads and prints as "15m", "24h"...
+type Duration time.Duration
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Set(value string) error {
+	parsed, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
+const (
+	KB ByteSize = 1000
+	MB          = 1000 * KB
+	GB          = 1000 * MB
+	TB          = 1000 * GB
+
+	KiB ByteSize = 1024
+	MiB          = 1024 * KiB
+	GiB          = 1024 * MiB
+	TiB          = 1024 * GiB
+)
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   ByteSize
+}{
+	{"TiB", TiB}, {"GiB", GiB}, {"MiB", MiB}, {"KiB", KiB},
+	{"TB", TB}, {"GB", GB}, {"MB", MB}, {"KB", KB},
+	{"B", 1},
+}
+
+// ByteSize is a number of bytes that reads and prints as "512MB", "5GiB"...
+type ByteSize int64
+
+func (b ByteSize) Bytes() int64 {
+	return int64(b)
+}
+
+func (b ByteSize) String() string {
+	if b == 0 {
+		return "0B"
+	}
+	for _, unit := range byteSizeUnits {
+		if b%unit.size == 0 {
+			return fmt.Sprintf("%d%s", b/unit.size, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", int64(b))
+}
+
+func (b *ByteSize) Set(value string) error {
+	value = strings.TrimSpace(value)
+
+	multiplier := ByteSize(1)
+	number := value
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(strings.ToLower(value), strings.ToLower(unit.suffix)) {
+			multiplier = unit.size
+			number = strings.TrimSpace(value[:len(value)-len(unit.suffix)])
+			break
+		}
+	}
+
+	parsed, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || parsed < 0 {
+		return fmt.Errorf("invalid size %q", value)
+	}
+	*b = ByteSize(parsed) * multiplier
+	return nil
+}
+
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	return b.Set(string(text))
+}
+
+type stringValue string
+
+func (s *stringValue) String() string     { return string(*s) }
+func (s *stringValue) Set(v string) error { *s = stringValue(v); return nil }
+
+// stringListValue is a comma separated list, setting it replaces the whole list
+type stringListValue []string
+
+func (l *stringListValue) String() string { return strings.Join(*l, ",") }
+
+func (l *stringListValue) Set(v string) error {
+	list := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*l = list
+	return nil
+}
+
+type intValue int
+
+func (i *intValue) String() string { return strconv.Itoa(int(*i)) }
+
+func (i *intValue) Set(v string) error {
+	parsed, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", v)
+	}
+	*i = intValue(parsed)
+	return nil
+}
+
+type boolValue bool
+
+func (b *boolValue) String() string   { return strconv.FormatBool(bool(*b)) }
+func (b *boolValue) IsBoolFlag() bool { return true }
+
+func (b *boolValue) Set(v string) error {
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q", v)
+	}
+	*b = boolValue(parsed)
+	return nil
+}
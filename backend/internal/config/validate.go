@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"quickshare/pkg/objectkey"
+	"quickshare/pkg/qrcode"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var sslModes = map[string]bool{
+	"disable": true, "allow": true, "prefer": true, "require": true, "verify-ca": true, "verify-full": true,
+}
+
+// S3 refuses presigned URLs that live longer than a week
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+// QR codes get hard to scan below minQRCodeSize pixels, maxQRCodeSize bounds the images rendered per request
+const (
+	minQRCodeSize = 64
+	maxQRCodeSize = 2048
+)
+
+// minSSECustomerKeyLength keeps the sse-c master secret at least as long as the AES-256 keys derived from it
+const minSSECustomerKeyLength = 32
+
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the whole config and lists every problem found, not only the first one
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(validPort(c.ServerConfig.Port), "server.port (PORT) must be a port number, got %q", c.ServerConfig.Port)
+	check(c.ServerConfig.PublicURL == "" || validURL(c.ServerConfig.PublicURL), "server.public_url must be an absolute http(s) URL, got %q", c.ServerConfig.PublicURL)
+
+	if c.DBConfig.Enabled && c.DBConfig.URL == "" {
+		check(c.DBConfig.DBHost != "", "db.host (DB_HOST) is required when the database is enabled")
+		check(validPort(c.DBConfig.DBPort), "db.port (DB_PORT) must be a port number, got %q", c.DBConfig.DBPort)
+		check(c.DBConfig.DBUser != "", "db.user (DB_USER) is required when the database is enabled")
+		check(c.DBConfig.DBName != "", "db.name (DB_NAME) is required when the database is enabled")
+		check(sslModes[c.DBConfig.SSLMode], "db.sslmode (DB_SSLMODE) %q is not a valid sslmode", c.DBConfig.SSLMode)
+	}
+	if c.DBConfig.Enabled {
+		check(c.DBConfig.MaxOpenConns >= 0, "db.max_open_conns must not be negative")
+		check(c.DBConfig.MaxIdleConns >= 0, "db.max_idle_conns must not be negative")
+		check(c.DBConfig.MaxOpenConns == 0 || c.DBConfig.MaxIdleConns <= c.DBConfig.MaxOpenConns,
+			"db.max_idle_conns (%d) must not exceed db.max_open_conns (%d)", c.DBConfig.MaxIdleConns, c.DBConfig.MaxOpenConns)
+		check(c.DBConfig.ConnectRetries > 0, "db.connect_retries must be at least 1")
+		check(c.DBConfig.RetryInitialDelay > 0 && c.DBConfig.RetryInitialDelay <= c.DBConfig.RetryMaxDelay,
+			"db.retry_initial_delay must be positive and not above db.retry_max_delay")
+	}
+
+	check(c.S3Config.Region != "", "s3.region (AWS_REGION) is required")
+	check(c.S3Config.Bucket != "", "s3.bucket (AWS_BUCKET_NAME) is required")
+	for name, value := range map[string]string{
+		"s3.endpoint":         c.S3Config.Endpoint,
+		"s3.presign_endpoint": c.S3Config.PresignEndpoint,
+		"s3.public_base_url":  c.S3Config.PublicBaseURL,
+	} {
+		check(value == "" || validURL(value), "%s must be an absolute http(s) URL, got %q", name, value)
+	}
+	check(c.S3Config.PresignEndpoint == "" || c.S3Config.Endpoint != "", "s3.presign_endpoint requires s3.endpoint")
+	check((c.S3Config.AccessKeyID == "") == (c.S3Config.SecretAccessKey == ""),
+		"s3.access_key_id and s3.secret_access_key must be set together")
+	switch c.S3Config.CredentialSource {
+	case "", "default":
+	case "static":
+		check(c.S3Config.AccessKeyID != "", "s3.access_key_id is required by the static credential source")
+	case "profile":
+		check(c.S3Config.Profile != "", "s3.profile (AWS_PROFILE) is required by the profile credential source")
+	case "web_identity":
+		check(c.S3Config.RoleARN != "", "s3.role_arn (AWS_ROLE_ARN) is required by the web_identity credential source")
+		check(c.S3Config.WebIdentityTokenFile != "", "s3.web_identity_token_file (AWS_WEB_IDENTITY_TOKEN_FILE) is required by the web_identity credential source")
+	case "assume_role":
+		check(c.S3Config.RoleARN != "", "s3.role_arn (AWS_ROLE_ARN) is required by the assume_role credential source")
+	default:
+		check(false, "s3.credential_source must be default, static, profile, web_identity or assume_role, got %q", c.S3Config.CredentialSource)
+	}
+	switch c.S3Config.SSEMode {
+	case "", "sse-s3", "sse-kms":
+	case "sse-c":
+		check(len(c.S3Config.SSECustomerKey) >= minSSECustomerKeyLength,
+			"s3.sse_customer_key (S3_SSE_CUSTOMER_KEY) must be at least %d bytes with sse-c", minSSECustomerKeyLength)
+		// S3 refuses customer keys over plain HTTP
+		check(!c.S3Config.DisableSSL, "s3.sse_mode sse-c can't be used with s3.disable_ssl")
+	default:
+		check(false, "s3.sse_mode must be sse-s3, sse-kms or sse-c, got %q", c.S3Config.SSEMode)
+	}
+	check(c.S3Config.SSEKMSKeyID == "" || c.S3Config.SSEMode == "sse-kms", "s3.sse_kms_key_id requires s3.sse_mode sse-kms")
+	// the key may stay set after a switch away from sse-c, the objects stored until then still need it
+	check(c.S3Config.SSEMode == "sse-c" || c.S3Config.SSECustomerKey == "" || len(c.S3Config.SSECustomerKey) >= minSSECustomerKeyLength,
+		"s3.sse_customer_key (S3_SSE_CUSTOMER_KEY) must be at least %d bytes", minSSECustomerKeyLength)
+
+	check(c.UploadConfig.PresignExpiry > 0 && c.UploadConfig.PresignExpiry.Duration() <= maxPresignExpiry,
+		"upload.presign_expiry must be between 1s and %s, got %s", maxPresignExpiry, c.UploadConfig.PresignExpiry)
+	check(c.UploadConfig.DefaultTTL > 0, "upload.default_ttl must be positive, got %s", c.UploadConfig.DefaultTTL)
+	check(c.UploadConfig.MaxFileSize > 0, "upload.max_file_size must be positive, got %s", c.UploadConfig.MaxFileSize)
+	check(c.UploadConfig.MaxTTL >= c.UploadConfig.DefaultTTL, "upload.max_ttl must be at least upload.default_ttl, got %s", c.UploadConfig.MaxTTL)
+	_, err := objectkey.ParseSharding(c.UploadConfig.KeySharding)
+	check(err == nil, "upload.key_sharding must be none, date or hash, got %q", c.UploadConfig.KeySharding)
+	check(c.UploadConfig.DeleteGracePeriod >= 0, "upload.delete_grace_period must not be negative, got %s", c.UploadConfig.DeleteGracePeriod)
+	check(c.UploadConfig.MimePolicyAction == "reject" || c.UploadConfig.MimePolicyAction == "quarantine",
+		"upload.mime_policy_action must be reject or quarantine, got %q", c.UploadConfig.MimePolicyAction)
+	for name, mimeTypes := range map[string][]string{
+		"upload.mime_allowlist": c.UploadConfig.MimeAllowlist,
+		"upload.mime_denylist":  c.UploadConfig.MimeDenylist,
+	} {
+		for _, mimeType := range mimeTypes {
+			check(strings.Count(mimeType, "/") == 1, "%s entries must be type/subtype or type/*, got %q", name, mimeType)
+		}
+	}
+
+	// the interval also paces the blob deletion worker, which runs even with the janitor disabled
+	check(c.JanitorConfig.Interval > 0, "janitor.interval must be positive, got %s", c.JanitorConfig.Interval)
+	if c.JanitorConfig.Enabled {
+		check(c.JanitorConfig.PendingTimeout >= c.UploadConfig.PresignExpiry,
+			"janitor.pending_timeout (%s) must not be shorter than upload.presign_expiry (%s)", c.JanitorConfig.PendingTimeout, c.UploadConfig.PresignExpiry)
+	}
+
+	if c.WebhookConfig.Enabled {
+		check(c.WebhookConfig.Interval > 0, "webhooks.interval must be positive, got %s", c.WebhookConfig.Interval)
+		check(c.WebhookConfig.Timeout > 0, "webhooks.timeout must be positive, got %s", c.WebhookConfig.Timeout)
+		check(c.WebhookConfig.MaxAttempts > 0, "webhooks.max_attempts must be at least 1")
+		check(c.WebhookConfig.RetryInitialDelay > 0 && c.WebhookConfig.RetryInitialDelay <= c.WebhookConfig.RetryMaxDelay,
+			"webhooks.retry_initial_delay must be positive and not above webhooks.retry_max_delay")
+	}
+
+	if c.StorageEventsConfig.QueueURL != "" {
+		check(validURL(c.StorageEventsConfig.QueueURL), "storage_events.queue_url must be an absolute http(s) URL, got %q", c.StorageEventsConfig.QueueURL)
+		check(c.StorageEventsConfig.QueueEndpoint == "" || validURL(c.StorageEventsConfig.QueueEndpoint),
+			"storage_events.queue_endpoint must be an absolute http(s) URL, got %q", c.StorageEventsConfig.QueueEndpoint)
+		// SQS caps long polling at 20s
+		check(c.StorageEventsConfig.WaitTime >= Duration(time.Second) && c.StorageEventsConfig.WaitTime <= Duration(20*time.Second),
+			"storage_events.wait_time must be between 1s and 20s, got %s", c.StorageEventsConfig.WaitTime)
+	}
+
+	if c.ScannerConfig.Address != "" {
+		// confirmed uploads wait in the database for the scan worker
+		check(c.DBConfig.Enabled, "scanner.address requires the database")
+		check(!strings.Contains(c.ScannerConfig.Address, "://") || strings.HasPrefix(c.ScannerConfig.Address, "tcp://") || strings.HasPrefix(c.ScannerConfig.Address, "unix://"),
+			"scanner.address must be tcp://host:port, unix:///path or host:port, got %q", c.ScannerConfig.Address)
+		check(c.ScannerConfig.Timeout > 0, "scanner.timeout must be positive, got %s", c.ScannerConfig.Timeout)
+		check(c.ScannerConfig.Interval > 0, "scanner.interval must be positive, got %s", c.ScannerConfig.Interval)
+		check(c.ScannerConfig.MaxAttempts > 0, "scanner.max_attempts must be at least 1")
+	}
+
+	if c.PreviewConfig.Enabled {
+		check(c.PreviewConfig.Interval > 0, "previews.interval must be positive, got %s", c.PreviewConfig.Interval)
+		check(c.PreviewConfig.MaxSourceSize > 0, "previews.max_source_size must be positive, got %s", c.PreviewConfig.MaxSourceSize)
+		check(c.PreviewConfig.MaxPixels > 0, "previews.max_pixels must be positive, got %d", c.PreviewConfig.MaxPixels)
+		check(c.PreviewConfig.MaxAttempts > 0, "previews.max_attempts must be at least 1")
+	}
+
+	check(c.QRCodeConfig.Size >= minQRCodeSize && c.QRCodeConfig.Size <= maxQRCodeSize,
+		"qr_codes.size must be between %d and %d pixels, got %d", minQRCodeSize, maxQRCodeSize, c.QRCodeConfig.Size)
+	_, err = qrcode.ParseLevel(c.QRCodeConfig.Level)
+	check(err == nil, "qr_codes.level must be L, M, Q or H, got %q", c.QRCodeConfig.Level)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func validURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
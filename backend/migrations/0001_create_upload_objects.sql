@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS upload_objects (
+    id         TEXT PRIMARY KEY,
+    file_name  TEXT NOT NULL,
+    file_size  BIGINT NOT NULL,
+    mime_type  TEXT NOT NULL,
+    object_key TEXT NOT NULL,
+    status     TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,8 @@
+ALTER TABLE upload_objects
+    ADD COLUMN IF NOT EXISTS owner_id   TEXT,
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- keyset pagination walks (created_at, id) newest first
+CREATE INDEX IF NOT EXISTS upload_objects_created_at_id_idx ON upload_objects (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS upload_objects_owner_created_at_idx ON upload_objects (owner_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS upload_objects_file_name_prefix_idx ON upload_objects (file_name text_pattern_ops);
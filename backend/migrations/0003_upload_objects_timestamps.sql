@@ -0,0 +1,7 @@
+ALTER TABLE upload_objects
+    ADD COLUMN IF NOT EXISTS updated_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN IF NOT EXISTS confirmed_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS deleted_at   TIMESTAMPTZ;
+
+-- the janitor looks for stale pending uploads
+CREATE INDEX IF NOT EXISTS upload_objects_status_created_at_idx ON upload_objects (status, created_at);
@@ -0,0 +1,12 @@
+-- outbox of storage deletes, written in the same transaction that removes the upload row
+CREATE TABLE IF NOT EXISTS blob_deletions (
+    id              BIGSERIAL PRIMARY KEY,
+    upload_id       TEXT NOT NULL,
+    object_key      TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS blob_deletions_next_attempt_at_idx ON blob_deletions (next_attempt_at);
@@ -0,0 +1,2 @@
+ALTER TABLE upload_objects
+    ADD COLUMN IF NOT EXISTS detected_mime_type TEXT;
@@ -0,0 +1,5 @@
+ALTER TABLE upload_objects
+    ADD COLUMN IF NOT EXISTS quarantine_reason TEXT;
+
+-- the scan worker picks up confirmed uploads waiting for their scan
+CREATE INDEX IF NOT EXISTS upload_objects_scanning_idx ON upload_objects (created_at) WHERE status = 'scanning';
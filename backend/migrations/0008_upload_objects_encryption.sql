@@ -0,0 +1,3 @@
+-- client-side encryption metadata (algorithm, key hint, chunk size), NULL for plain uploads
+ALTER TABLE upload_objects
+    ADD COLUMN IF NOT EXISTS encryption JSONB;
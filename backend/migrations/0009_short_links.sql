@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS short_links (
+    id            TEXT PRIMARY KEY,
+    slug          TEXT NOT NULL UNIQUE,
+    -- share path of the upload, never carries the URL fragment with the decryption key
+    original_link TEXT NOT NULL,
+    upload_id     TEXT NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at    TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS short_links_upload_id_idx ON short_links (upload_id);
@@ -0,0 +1,3 @@
+-- server-side encryption of the object (mode and key id), NULL when the bucket default applies
+ALTER TABLE upload_objects
+    ADD COLUMN IF NOT EXISTS storage_encryption JSONB;
@@ -0,0 +1,7 @@
+-- bundles are uploads without an object of their own, their members point to them;
+-- a purged bundle leaves its members to the janitor rather than dropping their rows
+ALTER TABLE upload_objects
+    ADD COLUMN IF NOT EXISTS kind TEXT NOT NULL DEFAULT 'file',
+    ADD COLUMN IF NOT EXISTS bundle_id TEXT REFERENCES upload_objects (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS upload_objects_bundle_id_idx ON upload_objects (bundle_id) WHERE bundle_id IS NOT NULL;
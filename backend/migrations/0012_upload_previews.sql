@@ -0,0 +1,19 @@
+-- NULL for the uploads that get no preview (not an image, encrypted, bundles)
+ALTER TABLE upload_objects
+    ADD COLUMN IF NOT EXISTS preview_status TEXT;
+
+-- the preview worker picks up completed uploads waiting for their thumbnails
+CREATE INDEX IF NOT EXISTS upload_objects_preview_pending_idx ON upload_objects (created_at) WHERE preview_status = 'pending';
+
+-- thumbnails of image uploads; their objects are queued in blob_deletions when the upload is purged
+CREATE TABLE IF NOT EXISTS upload_previews (
+    upload_id  TEXT NOT NULL,
+    size       TEXT NOT NULL,
+    object_key TEXT NOT NULL,
+    mime_type  TEXT NOT NULL,
+    width      INTEGER NOT NULL,
+    height     INTEGER NOT NULL,
+    file_size  BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (upload_id, size)
+);
@@ -0,0 +1,6 @@
+-- failed runs of the scan and preview workers; past their max attempts the
+-- upload is quarantined, or its preview marked as failed, instead of retried forever
+ALTER TABLE upload_objects
+    ADD COLUMN IF NOT EXISTS scan_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS preview_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS last_error TEXT;
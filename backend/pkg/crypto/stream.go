@@ -0,0 +1,374 @@
+// Package crypto implements the chunked streaming AEAD format of client-side
+// encrypted uploads. The server only stores the ciphertext and the metadata
+// needed to decrypt it; the key travels in the URL fragment of the share link.
+//
+// The format is a header followed by sealed chunks:
+//
+//	header: "QSE1" | algorithm (1 byte) | chunk size (uint32 BE) | nonce prefix
+//	chunk:  AEAD(plaintext of chunk size bytes, or less for the last one) | tag
+//
+// The nonce of chunk i is prefix | i (uint32 BE) | last (1 byte), so chunks
+// can't be reordered, and a stream cut at a chunk boundary fails to decrypt
+// because its final chunk doesn't carry the last flag. The header is the
+// additional data of every chunk.
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	AlgorithmAES256GCM         = "AES-256-GCM"
+	AlgorithmXChaCha20Poly1305 = "XChaCha20-Poly1305"
+
+	KeySize          = 32
+	DefaultChunkSize = 64 * 1024
+	MinChunkSize     = 1024
+	MaxChunkSize     = 16 * 1024 * 1024
+
+	magic       = "QSE1"
+	counterSize = 4
+	tagSize     = 16
+)
+
+var (
+	ErrInvalidKey    = errors.New("crypto: key must be 32 bytes")
+	ErrInvalidHeader = errors.New("crypto: invalid header")
+	ErrDecrypt       = errors.New("crypto: message authentication failed")
+	ErrTruncated     = errors.New("crypto: stream is truncated")
+)
+
+var algorithmIDs = map[string]byte{
+	AlgorithmAES256GCM:         1,
+	AlgorithmXChaCha20Poly1305: 2,
+}
+
+// Algorithms lists the supported algorithm names
+func Algorithms() []string {
+	return []string{AlgorithmAES256GCM, AlgorithmXChaCha20Poly1305}
+}
+
+func Supported(algorithm string) bool {
+	_, ok := algorithmIDs[algorithm]
+	return ok
+}
+
+func newAEAD(algorithm string, key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	switch algorithm {
+	case AlgorithmAES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case AlgorithmXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	default:
+		return nil, fmt.Errorf("crypto: unsupported algorithm %q", algorithm)
+	}
+}
+
+// GenerateKey returns a random key for NewWriter
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// EncodeKey formats a key for a URL fragment
+func EncodeKey(key []byte) string {
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+func DecodeKey(encoded string) ([]byte, error) {
+	key, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(key) != KeySize {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// KeyHint identifies a key without revealing it, so a client can tell it
+// holds the right one. It is empty for an invalid key.
+func KeyHint(key []byte) string {
+	if len(key) != KeySize {
+		return ""
+	}
+	block, _ := aes.NewCipher(key)
+	hint := make([]byte, aes.BlockSize)
+	block.Encrypt(hint, []byte("quickshare-hint\x00"))
+	return base64.RawURLEncoding.EncodeToString(hint[:8])
+}
+
+// HeaderPrefixSize is the part of the header ParseHeader reads, before the nonce prefix
+const HeaderPrefixSize = len(magic) + 1 + 4
+
+// Header is what the start of a stream tells without the key
+type Header struct {
+	Algorithm string
+	ChunkSize int
+}
+
+// ParseHeader reads the magic, algorithm and chunk size at the start of a
+// stream, so a server can check that an upload declared as encrypted is one
+func ParseHeader(content []byte) (*Header, error) {
+	if len(content) < HeaderPrefixSize || !bytes.Equal(content[:len(magic)], []byte(magic)) {
+		return nil, ErrInvalidHeader
+	}
+
+	header := &Header{ChunkSize: int(binary.BigEndian.Uint32(content[len(magic)+1:]))}
+	for name, id := range algorithmIDs {
+		if id == content[len(magic)] {
+			header.Algorithm = name
+		}
+	}
+	if header.Algorithm == "" || header.ChunkSize < MinChunkSize || header.ChunkSize > MaxChunkSize {
+		return nil, ErrInvalidHeader
+	}
+	return header, nil
+}
+
+func headerSize(nonceSize int) int {
+	return len(magic) + 1 + 4 + nonceSize - counterSize - 1
+}
+
+// EncryptedSize is the size of the ciphertext of plainSize bytes, what the client declares as file_size
+func EncryptedSize(algorithm string, plainSize int64, chunkSize int) int64 {
+	nonceSize := chacha20poly1305.NonceSizeX
+	if algorithm == AlgorithmAES256GCM {
+		nonceSize = 12
+	}
+	chunks := plainSize/int64(chunkSize) + 1
+	if plainSize > 0 && plainSize%int64(chunkSize) == 0 {
+		chunks--
+	}
+	return int64(headerSize(nonceSize)) + plainSize + chunks*tagSize
+}
+
+type stream struct {
+	aead    cipher.AEAD
+	header  []byte
+	nonce   []byte
+	counter uint32
+}
+
+func (s *stream) seal(dst []byte, plaintext []byte, last bool) []byte {
+	s.setNonce(last)
+	return s.aead.Seal(dst, s.nonce, plaintext, s.header)
+}
+
+func (s *stream) open(dst []byte, ciphertext []byte, last bool) ([]byte, error) {
+	s.setNonce(last)
+	return s.aead.Open(dst, s.nonce, ciphertext, s.header)
+}
+
+func (s *stream) setNonce(last bool) {
+	prefixSize := len(s.nonce) - counterSize - 1
+	binary.BigEndian.PutUint32(s.nonce[prefixSize:], s.counter)
+	s.nonce[len(s.nonce)-1] = 0
+	if last {
+		s.nonce[len(s.nonce)-1] = 1
+	}
+}
+
+type Writer struct {
+	stream
+	dst       io.Writer
+	chunkSize int
+	buffer    []byte
+	sealed    []byte
+	closed    bool
+}
+
+// NewWriter encrypts what is written to it into dst, Close must be called to write the final chunk
+func NewWriter(dst io.Writer, key []byte, algorithm string, chunkSize int) (*Writer, error) {
+	if chunkSize < MinChunkSize || chunkSize > MaxChunkSize {
+		return nil, fmt.Errorf("crypto: chunk size must be between %d and %d", MinChunkSize, MaxChunkSize)
+	}
+	aead, err := newAEAD(algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	prefix := nonce[:len(nonce)-counterSize-1]
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, headerSize(len(nonce)))
+	header = append(header, magic...)
+	header = append(header, algorithmIDs[algorithm])
+	header = binary.BigEndian.AppendUint32(header, uint32(chunkSize))
+	header = append(header, prefix...)
+
+	if _, err := dst.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &Writer{
+		stream:    stream{aead: aead, header: header, nonce: nonce},
+		dst:       dst,
+		chunkSize: chunkSize,
+		buffer:    make([]byte, 0, chunkSize),
+		sealed:    make([]byte, 0, chunkSize+tagSize),
+	}, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("crypto: write on closed writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// a full buffer is only sealed once more data shows it isn't the last chunk
+		if len(w.buffer) == w.chunkSize {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buffer[len(w.buffer):w.chunkSize], p)
+		w.buffer = w.buffer[:len(w.buffer)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close writes the final chunk, it doesn't close dst
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.flush(true)
+}
+
+func (w *Writer) flush(last bool) error {
+	w.sealed = w.seal(w.sealed[:0], w.buffer, last)
+	w.buffer = w.buffer[:0]
+	w.counter++
+	if w.counter == 0 {
+		return errors.New("crypto: stream is too long")
+	}
+	_, err := w.dst.Write(w.sealed)
+	return err
+}
+
+type Reader struct {
+	stream
+	src       io.Reader
+	chunk     []byte
+	opened    []byte
+	plaintext []byte
+	// next holds the first byte of the following chunk, read to find out whether the current one is the last
+	next    []byte
+	done    bool
+	failure error
+}
+
+// NewReader reads the header from src and decrypts the stream as it is read
+func NewReader(src io.Reader, key []byte) (*Reader, error) {
+	fixed := make([]byte, HeaderPrefixSize)
+	if _, err := io.ReadFull(src, fixed); err != nil {
+		return nil, ErrInvalidHeader
+	}
+	parsed, err := ParseHeader(fixed)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(parsed.Algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	prefix := nonce[:len(nonce)-counterSize-1]
+	if _, err := io.ReadFull(src, prefix); err != nil {
+		return nil, ErrInvalidHeader
+	}
+
+	header := append(fixed, prefix...)
+	return &Reader{
+		stream: stream{aead: aead, header: header, nonce: nonce},
+		src:    src,
+		chunk:  make([]byte, parsed.ChunkSize+tagSize+1),
+		opened: make([]byte, 0, parsed.ChunkSize),
+	}, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.plaintext) == 0 {
+		if r.failure != nil {
+			return 0, r.failure
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.readChunk(); err != nil {
+			r.failure = err
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.plaintext)
+	r.plaintext = r.plaintext[n:]
+	return n, nil
+}
+
+func (r *Reader) readChunk() error {
+	sealedSize := len(r.chunk) - 1
+	buffer := r.chunk[:copy(r.chunk, r.next)]
+	r.next = nil
+
+	// read one byte past a full chunk, EOF there means this chunk is the last one
+	n, err := io.ReadFull(r.src, r.chunk[len(buffer):])
+	buffer = r.chunk[:len(buffer)+n]
+	last := false
+	switch {
+	case err == nil:
+		r.next = []byte{buffer[sealedSize]}
+		buffer = buffer[:sealedSize]
+	case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	default:
+		return err
+	}
+
+	if len(buffer) < tagSize {
+		return ErrTruncated
+	}
+
+	plaintext, err := r.open(r.opened[:0], buffer, last)
+	if err != nil {
+		if last {
+			// a stream cut after a full chunk ends on a chunk sealed as not last
+			if _, retry := r.open(r.opened[:0], buffer, false); retry == nil {
+				return ErrTruncated
+			}
+		}
+		return ErrDecrypt
+	}
+
+	r.plaintext = plaintext
+	r.counter++
+	r.done = last
+	return nil
+}
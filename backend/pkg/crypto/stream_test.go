@@ -0,0 +1,142 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func encrypt(t *testing.T, key []byte, algorithm string, chunkSize int, plaintext []byte) []byte {
+	t.Helper()
+
+	var ciphertext bytes.Buffer
+	writer, err := NewWriter(&ciphertext, key, algorithm, chunkSize)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+	// odd sized writes cross the chunk boundaries
+	for len(plaintext) > 0 {
+		n := min(len(plaintext), 777)
+		if _, err := writer.Write(plaintext[:n]); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		plaintext = plaintext[n:]
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	return ciphertext.Bytes()
+}
+
+func decrypt(key []byte, ciphertext []byte) ([]byte, error) {
+	reader, err := NewReader(bytes.NewReader(ciphertext), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+func TestRoundTrip(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	for _, algorithm := range Algorithms() {
+		for _, size := range []int{0, 1, MinChunkSize - 1, MinChunkSize, MinChunkSize + 1, 3 * MinChunkSize, 5*MinChunkSize + 17} {
+			plaintext := bytes.Repeat([]byte("quickshare"), size/10+1)[:size]
+
+			ciphertext := encrypt(t, key, algorithm, MinChunkSize, plaintext)
+			if got := EncryptedSize(algorithm, int64(size), MinChunkSize); got != int64(len(ciphertext)) {
+				t.Errorf("%s/%d: expected encrypted size %d, got %d", algorithm, size, len(ciphertext), got)
+			}
+
+			decrypted, err := decrypt(key, ciphertext)
+			if err != nil {
+				t.Fatalf("%s/%d: unexpected error: %v", algorithm, size, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Errorf("%s/%d: decrypted content differs", algorithm, size)
+			}
+		}
+	}
+}
+
+func TestTampering(t *testing.T) {
+	key, _ := GenerateKey()
+	otherKey, _ := GenerateKey()
+	plaintext := bytes.Repeat([]byte{7}, 3*MinChunkSize)
+	ciphertext := encrypt(t, key, AlgorithmXChaCha20Poly1305, MinChunkSize, plaintext)
+	headerLen := headerSize(24)
+	sealedChunk := MinChunkSize + tagSize
+
+	flipped := bytes.Clone(ciphertext)
+	flipped[headerLen+10] ^= 1
+
+	swapped := bytes.Clone(ciphertext)
+	copy(swapped[headerLen:], ciphertext[headerLen+sealedChunk:headerLen+2*sealedChunk])
+	copy(swapped[headerLen+sealedChunk:], ciphertext[headerLen:headerLen+sealedChunk])
+
+	tests := []struct {
+		name       string
+		key        []byte
+		ciphertext []byte
+		wantErr    error
+	}{
+		{name: "wrong key", key: otherKey, ciphertext: ciphertext, wantErr: ErrDecrypt},
+		{name: "flipped bit", key: key, ciphertext: flipped, wantErr: ErrDecrypt},
+		{name: "reordered chunks", key: key, ciphertext: swapped, wantErr: ErrDecrypt},
+		{name: "cut at a chunk boundary", key: key, ciphertext: ciphertext[:headerLen+2*sealedChunk], wantErr: ErrTruncated},
+		{name: "cut inside a chunk", key: key, ciphertext: ciphertext[:len(ciphertext)-5], wantErr: ErrDecrypt},
+		{name: "not an encrypted stream", key: key, ciphertext: []byte("%PDF-1.7 plain document"), wantErr: ErrInvalidHeader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decrypt(tt.key, tt.ciphertext); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestKeyEncoding(t *testing.T) {
+	key, _ := GenerateKey()
+
+	decoded, err := DecodeKey(EncodeKey(key))
+	if err != nil || !bytes.Equal(decoded, key) {
+		t.Errorf("expected the key back, got %x, %v", decoded, err)
+	}
+	if _, err := DecodeKey("c2hvcnQ"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey for a short key, got %v", err)
+	}
+	otherKey, _ := GenerateKey()
+	if KeyHint(key) != KeyHint(decoded) || KeyHint(key) == KeyHint(otherKey) {
+		t.Error("expected the hint to identify the key")
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	key, _ := GenerateKey()
+	ciphertext := encrypt(t, key, AlgorithmAES256GCM, 4*MinChunkSize, []byte("secret"))
+
+	header, err := ParseHeader(ciphertext)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if header.Algorithm != AlgorithmAES256GCM || header.ChunkSize != 4*MinChunkSize {
+		t.Errorf("expected AES-256-GCM with %d byte chunks, got %+v", 4*MinChunkSize, header)
+	}
+
+	for name, content := range map[string][]byte{
+		"plaintext":          []byte("MZ\x90\x00 plain executable"),
+		"too short":          ciphertext[:HeaderPrefixSize-1],
+		"unknown algorithm":  append([]byte("QSE1\x09"), ciphertext[5:]...),
+		"chunk out of range": append([]byte("QSE1\x01\x00\x00\x00\x10"), ciphertext[9:]...),
+	} {
+		if _, err := ParseHeader(content); !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("%s: expected %v, got %v", name, ErrInvalidHeader, err)
+		}
+	}
+}
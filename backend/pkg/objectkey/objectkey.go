@@ -0,0 +1,135 @@
+// Package objectkey builds the storage keys of uploads out of client file
+// names. A key only holds a sanitized copy of the name, the name as the client
+// gave it is kept apart and only shown to people (pages, Content-Disposition).
+package objectkey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// ShardNone keys are prefix/id/name
+	ShardNone = ""
+	// ShardDate keys are prefix/yyyy/mm/dd/id/name, by creation day in UTC
+	ShardDate = "date"
+	// ShardHash keys are prefix/xx/id/name where xx comes from the hash of the id,
+	// spreading the keys over 256 prefixes that S3 scales on their own
+	ShardHash = "hash"
+)
+
+// MaxNameLength is the longest sanitized name kept in a key, in bytes
+const MaxNameLength = 128
+
+// maxExtLength is the longest extension kept when a name is shortened
+const maxExtLength = 16
+
+// fallbackName stands in for the names with nothing left once sanitized
+const fallbackName = "file"
+
+type Builder struct {
+	// Prefix is the first segment of every key, e.g. "uploads"
+	Prefix string
+	// Sharding is one of the Shard* constants
+	Sharding string
+}
+
+// ParseSharding checks a sharding scheme read from the configuration
+func ParseSharding(sharding string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(sharding)) {
+	case "", "none":
+		return ShardNone, nil
+	case ShardDate:
+		return ShardDate, nil
+	case ShardHash:
+		return ShardHash, nil
+	}
+	return "", fmt.Errorf("objectkey: unknown sharding %q, use none, date or hash", sharding)
+}
+
+// Key returns the key of the upload id named fileName and created at createdAt
+func (b Builder) Key(id string, fileName string, createdAt time.Time) string {
+	segments := []string{strings.Trim(b.Prefix, "/")}
+	switch b.Sharding {
+	case ShardDate:
+		segments = append(segments, createdAt.UTC().Format("2006/01/02"))
+	case ShardHash:
+		sum := sha256.Sum256([]byte(id))
+		segments = append(segments, hex.EncodeToString(sum[:1]))
+	}
+	segments = append(segments, SanitizeSegment(id), SanitizeName(fileName))
+	return strings.Join(segments, "/")
+}
+
+// Normalize returns the name in Unicode NFC without surrounding spaces, so
+// the same name typed on different systems is stored the same way
+func Normalize(name string) string {
+	return strings.TrimSpace(norm.NFC.String(name))
+}
+
+// SanitizeName turns a client file name into a single key segment of at most
+// MaxNameLength bytes. Letters and digits of any script are kept, as well as
+// "-", "_", "." and "+"; everything else, path separators and control
+// characters included, becomes "_". The extension survives the shortening.
+func SanitizeName(name string) string {
+	name = SanitizeSegment(name)
+	if len(name) <= MaxNameLength {
+		return name
+	}
+
+	ext := path.Ext(name)
+	if len(ext) > maxExtLength || len(ext) == len(name) {
+		ext = ""
+	}
+	stem := strings.TrimRight(truncate(strings.TrimSuffix(name, ext), MaxNameLength-len(ext)), "._-")
+	if stem == "" {
+		stem = fallbackName
+	}
+	return stem + ext
+}
+
+// SanitizeSegment is SanitizeName without the length limit
+func SanitizeSegment(name string) string {
+	name = Normalize(name)
+
+	var b strings.Builder
+	replaced := false
+	for _, r := range name {
+		if r == '-' || r == '_' || r == '.' || r == '+' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+			replaced = false
+			continue
+		}
+		// runs of replaced characters collapse into a single "_"
+		if !replaced {
+			b.WriteByte('_')
+			replaced = true
+		}
+	}
+
+	// no hidden files, no "." nor ".." segments
+	sanitized := strings.Trim(b.String(), "._")
+	if sanitized == "" {
+		return fallbackName
+	}
+	return sanitized
+}
+
+// truncate cuts s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
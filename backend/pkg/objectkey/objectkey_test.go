@@ -0,0 +1,93 @@
+package objectkey
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "report.pdf", want: "report.pdf"},
+		{name: "Q3 report (final).pdf", want: "Q3_report_final_.pdf"},
+		{name: "../../etc/passwd", want: "etc_passwd"},
+		{name: `..\..\boot.ini`, want: "boot.ini"},
+		{name: "..", want: "file"},
+		{name: ".env", want: "env"},
+		{name: "a\r\nb\x00.txt", want: "a_b_.txt"},
+		{name: "résumé.pdf", want: "résumé.pdf"},
+		// NFD input, "e" followed by a combining acute accent
+		{name: "re\u0301sume\u0301.pdf", want: "résumé.pdf"},
+		{name: "日本語のファイル.txt", want: "日本語のファイル.txt"},
+		{name: "photo 🎉.jpg", want: "photo_.jpg"},
+		{name: "%2e%2e%2f.txt", want: "2e_2e_2f.txt"},
+		{name: "", want: "file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeName(tt.name); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSanitizeName_Shortens(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantExt string
+	}{
+		{name: strings.Repeat("a", 300) + ".pdf", wantExt: ".pdf"},
+		{name: strings.Repeat("é", 200) + ".tar", wantExt: ".tar"},
+		{name: strings.Repeat("日", 100), wantExt: ""},
+		{name: "a." + strings.Repeat("b", 200), wantExt: ""},
+	}
+
+	for _, tt := range tests {
+		got := SanitizeName(tt.name)
+		if len(got) > MaxNameLength || !utf8.ValidString(got) {
+			t.Errorf("expected at most %d bytes of UTF-8, got %d bytes %q", MaxNameLength, len(got), got)
+		}
+		if !strings.HasSuffix(got, tt.wantExt) {
+			t.Errorf("expected %q to keep the extension %q", got, tt.wantExt)
+		}
+	}
+}
+
+func TestBuilder_Key(t *testing.T) {
+	createdAt := time.Date(2026, 3, 7, 23, 30, 0, 0, time.FixedZone("UTC-3", -3*60*60))
+
+	tests := []struct {
+		sharding string
+		want     string
+	}{
+		{sharding: ShardNone, want: "uploads/0a1b2c/Q3_report.pdf"},
+		{sharding: ShardDate, want: "uploads/2026/03/08/0a1b2c/Q3_report.pdf"},
+		{sharding: ShardHash, want: "uploads/c6/0a1b2c/Q3_report.pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sharding, func(t *testing.T) {
+			got := Builder{Prefix: "uploads", Sharding: tt.sharding}.Key("0a1b2c", "Q3 report.pdf", createdAt)
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseSharding(t *testing.T) {
+	for input, want := range map[string]string{"": ShardNone, "none": ShardNone, "Date": ShardDate, " hash ": ShardHash} {
+		if got, err := ParseSharding(input); err != nil || got != want {
+			t.Errorf("ParseSharding(%q) = %q, %v, expected %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseSharding("monthly"); err == nil {
+		t.Error("expected an error for an unknown sharding")
+	}
+}
@@ -0,0 +1,36 @@
+package qrcode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// PNG renders the symbol with a border of light modules around it, at the
+// largest whole number of pixels per module that fits in size (at least one)
+func (c *Code) PNG(size int, border int) ([]byte, error) {
+	modules := c.Size + 2*border
+	scale := max(size/modules, 1)
+
+	img := image.NewPaletted(image.Rect(0, 0, modules*scale, modules*scale), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				row := img.Pix[img.PixOffset((x+border)*scale, (y+border)*scale+dy):]
+				for dx := 0; dx < scale; dx++ {
+					row[dx] = 1
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,230 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncode_Version(t *testing.T) {
+	tests := []struct {
+		name        string
+		length      int
+		level       Level
+		wantVersion int
+	}{
+		// byte mode capacities of the standard
+		{name: "version 1 low holds 17 bytes", length: 17, level: Low, wantVersion: 1},
+		{name: "one more byte takes version 2", length: 18, level: Low, wantVersion: 2},
+		{name: "version 1 high holds 7 bytes", length: 7, level: High, wantVersion: 1},
+		{name: "the count grows to 16 bits from version 10", length: 271, level: Low, wantVersion: 10},
+		{name: "version 40 low holds 2953 bytes", length: 2953, level: Low, wantVersion: 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Encode(strings.Repeat("a", tt.length), tt.level)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if code.Version != tt.wantVersion || code.Size != tt.wantVersion*4+17 {
+				t.Errorf("expected version %d, got %d with size %d", tt.wantVersion, code.Version, code.Size)
+			}
+		})
+	}
+
+	if _, err := Encode(strings.Repeat("a", 2954), Low); !errors.Is(err, ErrContentTooLong) {
+		t.Errorf("expected ErrContentTooLong, got %v", err)
+	}
+}
+
+// TestEncode_Golden compares whole symbols, data placement and mask choice
+// included, to the ones of an independent encoder (ZXing) kept in testdata/
+func TestEncode_Golden(t *testing.T) {
+	tests := []struct {
+		content     string
+		level       Level
+		golden      string
+		wantVersion int
+		wantMask    int
+	}{
+		{content: "hello", level: Low, golden: "v1-l.txt", wantVersion: 1, wantMask: 7},
+		{content: "https://example.com/s/k3Xb9qRt", level: Medium, golden: "v3-m.txt", wantVersion: 3, wantMask: 2},
+		{content: "https://share.example.com/s/k3Xb9qRt", level: High, golden: "v5-h.txt", wantVersion: 5, wantMask: 2},
+		// from version 7 the symbol carries its version information
+		{content: "https://share.example.com/download/up_2f9c81d4e7b6a5039f1e8d7c6b5a4938?download=1&utm_source=qr", level: Quartile, golden: "v8-q.txt", wantVersion: 8, wantMask: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			golden, err := os.ReadFile(filepath.Join("testdata", tt.golden))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := strings.Fields(string(golden))
+
+			code, err := Encode(tt.content, tt.level)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if code.Version != tt.wantVersion || code.Mask != tt.wantMask {
+				t.Errorf("expected version %d with mask %d, got version %d with mask %d", tt.wantVersion, tt.wantMask, code.Version, code.Mask)
+			}
+			if len(want) != code.Size {
+				t.Fatalf("expected %d rows, got a symbol of size %d", len(want), code.Size)
+			}
+			for y, row := range want {
+				for x, module := range row {
+					if dark := module == '#'; code.Dark(x, y) != dark {
+						t.Errorf("module (%d, %d): expected dark %v", x, y, dark)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncode_FunctionPatterns(t *testing.T) {
+	code, err := Encode("https://quickshare.example/s/k3Xb9q", Medium)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// finder in each corner but the bottom right: dark ring, light ring, dark 3x3 center
+	for _, corner := range [][2]int{{0, 0}, {code.Size - 7, 0}, {0, code.Size - 7}} {
+		for dy := 0; dy < 7; dy++ {
+			for dx := 0; dx < 7; dx++ {
+				ring := max(abs(dx-3), abs(dy-3))
+				if want := ring != 2; code.Dark(corner[0]+dx, corner[1]+dy) != want {
+					t.Fatalf("finder at %v: module (%d, %d) expected dark %v", corner, dx, dy, want)
+				}
+			}
+		}
+	}
+	for i := 8; i < code.Size-8; i++ {
+		if code.Dark(i, 6) != (i%2 == 0) || code.Dark(6, i) != (i%2 == 0) {
+			t.Fatalf("timing patterns broken at %d", i)
+		}
+	}
+	if !code.Dark(8, code.Size-8) {
+		t.Error("expected the dark module")
+	}
+
+	// both copies of the format information carry the level and the mask
+	var first, second int
+	for i := 0; i < 15; i++ {
+		var x, y int
+		switch {
+		case i < 6:
+			x, y = 8, i
+		case i < 8:
+			x, y = 8, i+1
+		case i == 8:
+			x, y = 7, 8
+		default:
+			x, y = 14-i, 8
+		}
+		if code.Dark(x, y) {
+			first |= 1 << i
+		}
+		if i < 8 {
+			x, y = code.Size-1-i, 8
+		} else {
+			x, y = 8, code.Size-15+i
+		}
+		if code.Dark(x, y) {
+			second |= 1 << i
+		}
+	}
+	if first != second || (first^0x5412)>>10 != Medium.formatBits()<<3|code.Mask {
+		t.Errorf("unexpected format information %015b and %015b for mask %d", first, second, code.Mask)
+	}
+}
+
+func TestReedSolomonRemainder(t *testing.T) {
+	// HELLO WORLD in alphanumeric mode, version 1 medium, from the worked example of the standard
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if got := reedSolomonRemainder(data, reedSolomonDivisor(len(want))); !bytes.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for value, want := range map[string]Level{"L": Low, "m": Medium, "quartile": Quartile, "High": High} {
+		if level, err := ParseLevel(value); err != nil || level != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, expected %v", value, level, err, want)
+		}
+	}
+	if _, err := ParseLevel("x"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestSVG(t *testing.T) {
+	code, err := Encode("hello", Low)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svg := string(code.SVG(0, QuietZone))
+	if !strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 29 29"`) {
+		t.Errorf("expected a 29 unit viewBox, got %.80s", svg)
+	}
+	if sized := string(code.SVG(290, QuietZone)); !strings.HasPrefix(sized, `<svg xmlns="http://www.w3.org/2000/svg" width="290" height="290" viewBox="0 0 29 29"`) {
+		t.Errorf("expected a 290 pixels wide image, got %.100s", sized)
+	}
+	// the top left module of the finder, shifted by the quiet zone
+	if !strings.Contains(svg, "M4 4h1v1h-1z") {
+		t.Error("expected the finder drawn inside the quiet zone")
+	}
+}
+
+func TestPNG(t *testing.T) {
+	code, err := Encode("hello", Low)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		size      int
+		wantWidth int
+	}{
+		{name: "scale rounds down to whole pixels per module", size: 300, wantWidth: 290},
+		{name: "exact fit", size: 58, wantWidth: 58},
+		{name: "never below a pixel per module", size: 10, wantWidth: 29},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := code.PNG(tt.size, QuietZone)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			img, err := png.Decode(bytes.NewReader(content))
+			if err != nil {
+				t.Fatalf("not a PNG: %v", err)
+			}
+			if bounds := img.Bounds(); bounds.Dx() != tt.wantWidth || bounds.Dy() != tt.wantWidth {
+				t.Fatalf("expected %dx%d, got %v", tt.wantWidth, tt.wantWidth, bounds)
+			}
+
+			scale := tt.wantWidth / 29
+			for _, probe := range []struct {
+				x, y int
+				dark bool
+			}{{0, 0, false}, {QuietZone, QuietZone, true}, {QuietZone + 1, QuietZone + 1, false}, {QuietZone + 3, QuietZone + 3, true}} {
+				r, _, _, _ := img.At(probe.x*scale+scale-1, probe.y*scale+scale-1).RGBA()
+				if dark := r == 0; dark != probe.dark {
+					t.Errorf("module (%d, %d) expected dark %v", probe.x, probe.y, probe.dark)
+				}
+			}
+		})
+	}
+}
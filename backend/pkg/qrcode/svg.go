@@ -0,0 +1,30 @@
+package qrcode
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// SVG renders the symbol with a border of light modules around it, one unit
+// per module. size sets the width and height of the image in pixels, when 0
+// the consumer scales it to the size it wants.
+func (c *Code) SVG(size int, border int) []byte {
+	modules := c.Size + 2*border
+
+	var buf bytes.Buffer
+	buf.WriteString(`<svg xmlns="http://www.w3.org/2000/svg"`)
+	if size > 0 {
+		fmt.Fprintf(&buf, ` width="%d" height="%d"`, size, size)
+	}
+	fmt.Fprintf(&buf, ` viewBox="0 0 %d %d" shape-rendering="crispEdges">`, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, modules, modules)
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.modules[y][x] {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x+border, y+border)
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
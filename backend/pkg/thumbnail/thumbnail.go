@@ -0,0 +1,103 @@
+// Package thumbnail scales images down for previews, in pure Go. JPEG, PNG,
+// GIF (first frame) and WebP images are read; thumbnails are written as JPEG,
+// or as PNG when the image has transparency. There is no WebP encoder in pure
+// Go, so WebP images get JPEG or PNG thumbnails too.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// JPEGQuality is a good compromise for small previews
+const JPEGQuality = 82
+
+var (
+	ErrUnsupportedFormat = errors.New("thumbnail: unsupported image format")
+	ErrTooLarge          = errors.New("thumbnail: image has too many pixels")
+)
+
+type Thumbnail struct {
+	Content  []byte
+	MimeType string
+	Width    int
+	Height   int
+}
+
+// Decode decodes content, images with more than maxPixels pixels are refused
+// from their header before any pixel is decoded
+func Decode(content []byte, maxPixels int64) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if errors.Is(err, image.ErrFormat) {
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, ErrUnsupportedFormat
+	}
+	if maxPixels > 0 && int64(config.Width)*int64(config.Height) > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	return img, err
+}
+
+// Generate scales img down to fit in a bound x bound box, keeping its aspect
+// ratio. Images that already fit are only re-encoded.
+func Generate(img image.Image, bound int) (*Thumbnail, error) {
+	width, height := fit(img.Bounds().Dx(), img.Bounds().Dy(), bound)
+
+	var scaled draw.Image
+	if opaque(img) {
+		scaled = image.NewRGBA(image.Rect(0, 0, width, height))
+	} else {
+		scaled = image.NewNRGBA(image.Rect(0, 0, width, height))
+	}
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	thumbnail := &Thumbnail{Width: width, Height: height}
+	var buf bytes.Buffer
+	if opaque(img) {
+		thumbnail.MimeType = "image/jpeg"
+		if err := jpeg.Encode(&buf, scaled, &jpeg.Options{Quality: JPEGQuality}); err != nil {
+			return nil, err
+		}
+	} else {
+		thumbnail.MimeType = "image/png"
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := encoder.Encode(&buf, scaled); err != nil {
+			return nil, err
+		}
+	}
+	thumbnail.Content = buf.Bytes()
+	return thumbnail, nil
+}
+
+// fit returns the size of a width x height image scaled down to fit in the box, never below 1 pixel
+func fit(width, height, bound int) (int, int) {
+	if width <= bound && height <= bound {
+		return width, height
+	}
+	if width >= height {
+		return bound, max(1, height*bound/width)
+	}
+	return max(1, width*bound/height), bound
+}
+
+// opaque tells whether img has no transparent pixel, the decoders know it for most formats
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenerate(t *testing.T) {
+	landscape := image.NewRGBA(image.Rect(0, 0, 1200, 600))
+	for x := 0; x < 1200; x++ {
+		for y := 0; y < 600; y++ {
+			landscape.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var photo bytes.Buffer
+	if err := jpeg.Encode(&photo, landscape, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	transparent := image.NewNRGBA(image.Rect(0, 0, 300, 900))
+	transparent.Set(10, 10, color.NRGBA{R: 255, A: 128})
+
+	tests := []struct {
+		name       string
+		content    []byte
+		bound      int
+		wantType   string
+		wantWidth  int
+		wantHeight int
+	}{
+		{name: "opaque image becomes a JPEG", content: photo.Bytes(), bound: 480, wantType: "image/jpeg", wantWidth: 480, wantHeight: 240},
+		{name: "transparent image stays a PNG", content: encodePNG(t, transparent), bound: 300, wantType: "image/png", wantWidth: 100, wantHeight: 300},
+		{name: "small image is not enlarged", content: encodePNG(t, landscape.SubImage(image.Rect(0, 0, 64, 32))), bound: 480, wantType: "image/jpeg", wantWidth: 64, wantHeight: 32},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := Decode(tt.content, 0)
+			if err != nil {
+				t.Fatalf("failed to decode: %v", err)
+			}
+
+			thumbnail, err := Generate(img, tt.bound)
+			if err != nil {
+				t.Fatalf("failed to generate: %v", err)
+			}
+			if thumbnail.MimeType != tt.wantType || thumbnail.Width != tt.wantWidth || thumbnail.Height != tt.wantHeight {
+				t.Errorf("expected a %dx%d %s, got a %dx%d %s", tt.wantWidth, tt.wantHeight, tt.wantType, thumbnail.Width, thumbnail.Height, thumbnail.MimeType)
+			}
+
+			decoded, format, err := image.Decode(bytes.NewReader(thumbnail.Content))
+			if err != nil {
+				t.Fatalf("failed to decode the thumbnail: %v", err)
+			}
+			if "image/"+format != tt.wantType || decoded.Bounds().Dx() != tt.wantWidth || decoded.Bounds().Dy() != tt.wantHeight {
+				t.Errorf("the thumbnail content doesn't match, got a %dx%d %s", decoded.Bounds().Dx(), decoded.Bounds().Dy(), format)
+			}
+		})
+	}
+}
+
+func TestDecodeRefusals(t *testing.T) {
+	large := encodePNG(t, image.NewGray(image.Rect(0, 0, 2000, 2000)))
+
+	tests := []struct {
+		name      string
+		content   []byte
+		maxPixels int64
+		wantErr   error
+	}{
+		{name: "too many pixels", content: large, maxPixels: 1000 * 1000, wantErr: ErrTooLarge},
+		{name: "not an image", content: []byte("%PDF-1.7\n"), wantErr: ErrUnsupportedFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.content, tt.maxPixels); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package pkg
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 )
 
 func WriteJSON(w http.ResponseWriter, status int, data interface{}) {
@@ -14,3 +15,42 @@ func WriteJSON(w http.ResponseWriter, status int, data interface{}) {
 func ReadJSON(r *http.Request, v interface{}) error {
 	return json.NewDecoder(r.Body).Decode(v)
 }
+
+// ContentDisposition formats the header of RFC 6266 for a file name of any
+// script: filename holds an ASCII fallback and filename* (RFC 5987) the name
+// encoded in UTF-8, which the clients that understand it prefer
+func ContentDisposition(disposition string, fileName string) string {
+	var fallback strings.Builder
+	for _, r := range fileName {
+		// % is left out too, some clients percent-decode filename
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '%' {
+			fallback.WriteByte('_')
+			continue
+		}
+		fallback.WriteRune(r)
+	}
+
+	value := disposition + `; filename="` + fallback.String() + `"`
+	if fallback.String() != fileName {
+		value += "; filename*=UTF-8''" + encodeExtValue(fileName)
+	}
+	return value
+}
+
+// encodeExtValue percent-encodes every byte that isn't an attr-char of RFC 5987
+func encodeExtValue(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0x0f])
+	}
+	return b.String()
+}
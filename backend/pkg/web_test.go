@@ -0,0 +1,25 @@
+package pkg
+
+import "testing"
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		fileName string
+		want     string
+	}{
+		{fileName: "report.pdf", want: `attachment; filename="report.pdf"`},
+		{fileName: "Q3 report (final).pdf", want: `attachment; filename="Q3 report (final).pdf"`},
+		{fileName: "résumé.pdf", want: `attachment; filename="r_sum_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`},
+		{fileName: "日本.txt", want: `attachment; filename="__.txt"; filename*=UTF-8''%E6%97%A5%E6%9C%AC.txt`},
+		{fileName: `say "hi"\.txt`, want: `attachment; filename="say _hi__.txt"; filename*=UTF-8''say%20%22hi%22%5C.txt`},
+		{fileName: "100%.txt", want: `attachment; filename="100_.txt"; filename*=UTF-8''100%25.txt`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			if got := ContentDisposition("attachment", tt.fileName); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}